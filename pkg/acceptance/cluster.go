@@ -83,7 +83,7 @@ func (c *Cluster) Master() *docker.Container {
 // Roles returns a triple of master, sync, async docker containers. When a role doesn't
 // exist, the container will be nil.
 func (c *Cluster) Roles() (*docker.Container, *docker.Container, *docker.Container) {
-	crm := pacemaker.NewPacemaker(c.Executor())
+	crm := pacemaker.NewPacemaker(c.Executor(), nil, pacemaker.PgsqlProfile)
 	nodes, err := crm.Get(c.ctx, pacemaker.MasterXPath, pacemaker.SyncXPath, pacemaker.AsyncXPath)
 
 	if err != nil {
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/failover"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// apiClient issues requests that can be served by any failover API endpoint, such as
+// those that only read or modify the cib, which is shared by all nodes.
+type apiClient struct {
+	out       io.Writer
+	endpoints []string
+	timeout   time.Duration
+}
+
+func newAPIClient() *apiClient {
+	return &apiClient{
+		out:       os.Stdout,
+		endpoints: viper.GetStringSlice("failover-api-endpoints"),
+		timeout:   viper.GetDuration("pacemaker-timeout"),
+	}
+}
+
+// Run performs the action against the first endpoint that responds successfully
+func (c *apiClient) Run(ctx context.Context, logger kitlog.Logger, action func(context.Context, failover.FailoverClient) error) (err error) {
+	for _, endpoint := range c.endpoints {
+		if err = c.request(ctx, logger, endpoint, action); err != nil {
+			logger.Log("event", "client.error", "endpoint", endpoint, "error", err)
+			continue
+		}
+
+		return nil
+	}
+
+	return errors.Wrap(err, "no endpoint responded successfully")
+}
+
+func (c *apiClient) request(ctx context.Context, logger kitlog.Logger, endpoint string, action func(context.Context, failover.FailoverClient) error) error {
+	logger.Log("event", "client.connecting", "endpoint", endpoint)
+	conn, err := grpc.Dial(endpoint, grpc.WithInsecure())
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return action(ctx, failover.NewFailoverClient(conn))
+}
@@ -7,15 +7,18 @@ import (
 	"encoding/binary"
 	"io/ioutil"
 	stdlog "log"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"golang.org/x/crypto/ssh/terminal"
 
 	kitlog "github.com/go-kit/kit/log"
 	level "github.com/go-kit/kit/log/level"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pgbouncer"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
@@ -82,7 +85,8 @@ func NewPgcmCommand(ctx context.Context) *cobra.Command {
 	}
 
 	c.PersistentFlags().StringVar(&pgcm.ConfigFile, "config-file", "", "Load configuration from confile file")
-	addEtcdFlags(c.PersistentFlags())
+	addStoreFlags(c.PersistentFlags())
+	addMetricsFlags(c.PersistentFlags())
 	viper.BindPFlags(c.PersistentFlags())
 
 	// Automatically clean-up resources when we receive a quit signal
@@ -92,14 +96,66 @@ func NewPgcmCommand(ctx context.Context) *cobra.Command {
 		cancel()
 	})
 
+	c.AddCommand(NewCleanupCommand(ctx))
 	c.AddCommand(NewConfigCommand(ctx))
+	c.AddCommand(NewConstraintsCommand(ctx))
+	c.AddCommand(NewEtcdCommand(ctx))
+	c.AddCommand(NewEvacuateCommand(ctx))
 	c.AddCommand(NewFailoverCommand(ctx))
 	c.AddCommand(NewProxyCommand(ctx))
+	c.AddCommand(NewRestoreCommand(ctx))
+	c.AddCommand(NewRollingRestartCommand(ctx))
+	c.AddCommand(NewStatusCommand(ctx))
 	c.AddCommand(NewSuperviseCommand(ctx))
 
 	return c
 }
 
+// serveMetrics serves Prometheus metrics on the given address until the context is done,
+// including pools and stats read from PgBouncer on each scrape.
+func serveMetrics(ctx context.Context, logger kitlog.Logger, address string, bouncer *pgbouncer.PgBouncer, timeout time.Duration) error {
+	prometheus.MustRegister(pgbouncer.NewCollector(logger, bouncer, timeout))
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", prometheus.UninstrumentedHandler())
+	server := &http.Server{Addr: address, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	logger.Log("event", "metrics.listen", "address", address)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return errors.Wrap(err, "failed to serve metrics")
+	}
+
+	return nil
+}
+
+// pingPgBouncer checks our PgBouncer admin connection on each interval until the context
+// is done, so a connection that broke while idle is replaced before we next need it.
+func pingPgBouncer(ctx context.Context, logger kitlog.Logger, bouncer *pgbouncer.PgBouncer, interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := bouncer.Ping(pingCtx)
+		cancel()
+
+		if err != nil {
+			logger.Log("event", "pgbouncer.ping_error", "error", err)
+		}
+	}
+}
+
 type pgcmCommand struct {
 	ConfigFile string
 }
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"google.golang.org/grpc"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/failover"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func NewConstraintsCommand(ctx context.Context) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "constraints <subcommand>",
+		Short: "Manage pacemaker constraints left behind by migrations",
+	}
+
+	c.AddCommand(NewConstraintsListCommand(ctx))
+	c.AddCommand(NewConstraintsClearCommand(ctx))
+
+	return c
+}
+
+func NewConstraintsListCommand(ctx context.Context) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "list",
+		Short: "List cli- location constraints in the cib",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return newConstraintsCommand().Run(ctx, logger, failover.FailoverClient.ListConstraints)
+		},
+	}
+
+	addFailoverFlags(c.Flags())
+	viper.BindPFlags(c.Flags())
+
+	return c
+}
+
+func NewConstraintsClearCommand(ctx context.Context) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "clear",
+		Short: "Remove all cli- location constraints from the cib",
+		Long: `Remove all cli- location constraints from the cib, printing those
+that were removed. These constraints are created by migrations, and if
+left in place will prevent future failovers from taking effect.`,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return newConstraintsCommand().Run(ctx, logger, failover.FailoverClient.ClearConstraints)
+		},
+	}
+
+	addFailoverFlags(c.Flags())
+	viper.BindPFlags(c.Flags())
+
+	return c
+}
+
+type constraintsAction func(failover.FailoverClient, context.Context, *failover.Empty, ...grpc.CallOption) (*failover.ConstraintsResponse, error)
+
+type constraintsCommand struct{ *apiClient }
+
+func newConstraintsCommand() *constraintsCommand {
+	return &constraintsCommand{newAPIClient()}
+}
+
+// Run performs the action against the first endpoint that responds, as all nodes share
+// the same cib.
+func (c *constraintsCommand) Run(ctx context.Context, logger kitlog.Logger, action constraintsAction) error {
+	return c.apiClient.Run(ctx, logger, func(ctx context.Context, client failover.FailoverClient) error {
+		resp, err := action(client, ctx, &failover.Empty{})
+		if err != nil {
+			return err
+		}
+
+		return c.print(resp.Constraints)
+	})
+}
+
+func (c *constraintsCommand) print(constraints []*failover.Constraint) error {
+	w := tabwriter.NewWriter(c.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tRESOURCE\tNODE\tROLE\tSCORE\tEXPIRES")
+	for _, constraint := range constraints {
+		expires := constraint.Expires
+		if expires == "" {
+			expires = "never"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			constraint.Id, constraint.Resource, constraint.Node, constraint.Role, constraint.Score, expires)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var etcdRestoreLongDescription = `
+Write keys from a dump produced by pgcm etcd dump into the store, such as
+when rebuilding an etcd cluster or moving to a new namespace.
+
+Locks and election keys are skipped, as they belong to processes that no
+longer hold them. Keys that were attached to a lease are restored without
+one, and supervise will attach its own lease once running.
+
+We refuse to overwrite existing keys unless --overwrite is given. If the
+dump was taken from an older release, run pgcm etcd migrate afterwards.
+`
+
+var etcdMigrateLongDescription = `
+Upgrade the layout of our keys to the schema version of this release,
+recorded in etcd-schema-version-key. Migrations are applied in order,
+recording the version after each, so an interrupted migration can be
+resumed by running migrate again.
+`
+
+func NewEtcdCommand(ctx context.Context) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "etcd <subcommand>",
+		Short: "Manage the keys pgcm stores in etcd (or Consul)",
+	}
+
+	c.AddCommand(NewEtcdDumpCommand(ctx))
+	c.AddCommand(NewEtcdRestoreCommand(ctx))
+	c.AddCommand(NewEtcdMigrateCommand(ctx))
+
+	return c
+}
+
+func NewEtcdDumpCommand(ctx context.Context) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "dump [file]",
+		Short: "Write every key pgcm owns as JSON, to stdout or the given file",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			ctx, cancel := context.WithTimeout(ctx, viper.GetDuration("etcd-timeout"))
+			defer cancel()
+
+			dump, err := store.DumpKeys(ctx, mustStore(), storeKeys())
+			if err != nil {
+				return err
+			}
+
+			var out io.Writer = os.Stdout
+			if len(args) > 0 {
+				file, err := os.Create(args[0])
+				if err != nil {
+					return errors.Wrap(err, "failed to create dump file")
+				}
+
+				defer file.Close()
+				out = file
+			}
+
+			encoder := json.NewEncoder(out)
+			encoder.SetIndent("", "  ")
+
+			return encoder.Encode(dump)
+		},
+		Example: `
+  # Copy our keys into a new namespace
+  pgcm etcd dump keys.json
+  pgcm etcd restore keys.json --etcd-namespace /postgres-new`,
+	}
+
+	return c
+}
+
+func NewEtcdRestoreCommand(ctx context.Context) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "restore <file>",
+		Short: "Restore keys from a dump, reading stdin if file is -",
+		Long:  etcdRestoreLongDescription,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			var in io.Reader = os.Stdin
+			if args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return errors.Wrap(err, "failed to open dump file")
+				}
+
+				defer file.Close()
+				in = file
+			}
+
+			var dump store.Dump
+			if err := json.NewDecoder(in).Decode(&dump); err != nil {
+				return errors.Wrap(err, "failed to parse dump")
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, viper.GetDuration("etcd-timeout"))
+			defer cancel()
+
+			err := store.RestoreKeys(ctx, logger, mustStore(), storeKeys(), &dump, viper.GetBool("overwrite"))
+			if err == nil {
+				logger.Log("event", "restore.complete", "keys", len(dump.Keys), "version", dump.Version)
+			}
+
+			return err
+		},
+	}
+
+	c.Flags().Bool("overwrite", false, "Restore keys even if they already exist")
+	viper.BindPFlags(c.Flags())
+
+	return c
+}
+
+func NewEtcdMigrateCommand(ctx context.Context) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade the key layout to the current schema version",
+		Long:  etcdMigrateLongDescription,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if viper.GetBool("list") {
+				for _, migration := range store.Migrations {
+					fmt.Printf("%d\t%s\n", migration.Version, migration.Description)
+				}
+
+				return nil
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, viper.GetDuration("etcd-timeout"))
+			defer cancel()
+
+			return store.Migrate(ctx, logger, mustStore(), storeKeys())
+		},
+	}
+
+	c.Flags().Bool("list", false, "List migrations instead of applying them")
+	viper.BindPFlags(c.Flags())
+
+	return c
+}
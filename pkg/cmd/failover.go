@@ -6,10 +6,9 @@ import (
 
 	"google.golang.org/grpc"
 
-	"github.com/coreos/etcd/clientv3"
-	"github.com/coreos/etcd/clientv3/concurrency"
 	kitlog "github.com/go-kit/kit/log"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/failover"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -46,6 +45,20 @@ commands. This timeout DOES NOT apply to the affect being seen from
 executing such a command- as an example, a failover command may take
 anywhere up to 20s to complete but applying the failover constraint may
 succeed instantly. This timeout applies to the latter only.
+
+# migration-lifetime
+
+Lifetime of the constraint created by the pacemaker migration. Should we
+fail to unmigrate, perhaps because this process was killed, pacemaker
+will remove the constraint itself once the lifetime has elapsed. Note
+pacemaker only evaluates lifetimes every cluster-recheck-interval.
+
+# force
+
+Before migrating, the API checks pacemaker for conditions that make a
+migration unsafe, such as leftover migration constraints, a pending
+transition, disabled stonith, maintenance mode or fail counts on the
+sync node. Migration is refused if any are found, unless forced.
 `
 
 func NewFailoverCommand(ctx context.Context) *cobra.Command {
@@ -54,21 +67,7 @@ func NewFailoverCommand(ctx context.Context) *cobra.Command {
 		Short: "Run a zero-downtime failover of the Postgres primary",
 		Long:  failoverLongDescription,
 		RunE: func(_ *cobra.Command, _ []string) error {
-			failover := &failoverCommand{
-				client:    mustEtcdClient(),
-				endpoints: viper.GetStringSlice("failover-api-endpoints"),
-				opt: failover.FailoverOptions{
-					EtcdHostKey:        viper.GetString("etcd-postgres-master-key"),
-					HealthCheckTimeout: viper.GetDuration("health-check-timeout"),
-					LockTimeout:        viper.GetDuration("lock-timeout"),
-					PauseTimeout:       viper.GetDuration("pause-timeout"),
-					PauseExpiry:        viper.GetDuration("pause-expiry"),
-					ResumeTimeout:      viper.GetDuration("resume-timeout"),
-					PacemakerTimeout:   viper.GetDuration("pacemaker-timeout"),
-				},
-			}
-
-			return failover.Run(ctx, logger)
+			return newFailoverCommand().Run(ctx, logger)
 		},
 	}
 
@@ -78,20 +77,47 @@ func NewFailoverCommand(ctx context.Context) *cobra.Command {
 	return c
 }
 
+// lockTTL is how long the failover lock outlives us, should we die holding it
+const lockTTL = time.Minute
+
 type failoverCommand struct {
-	client    *clientv3.Client
+	store     store.Store
 	endpoints []string
 	opt       failover.FailoverOptions
 }
 
-func (f *failoverCommand) Run(ctx context.Context, logger kitlog.Logger) error {
-	session, err := concurrency.NewSession(f.client)
-	if err != nil {
-		return err
+func newFailoverCommand() *failoverCommand {
+	return &failoverCommand{
+		store:     mustStore(),
+		endpoints: viper.GetStringSlice("failover-api-endpoints"),
+		opt: failover.FailoverOptions{
+			EtcdHostKey:        viper.GetString("etcd-postgres-master-key"),
+			EtcdGenerationKey:  viper.GetString("etcd-postgres-generation-key"),
+			EtcdTopologyKey:    viper.GetString("etcd-postgres-topology-key"),
+			EtcdRestartKey:     viper.GetString("etcd-postgres-restart-key"),
+			HealthCheckTimeout: viper.GetDuration("health-check-timeout"),
+			LockTimeout:        viper.GetDuration("lock-timeout"),
+			PauseTimeout:       viper.GetDuration("pause-timeout"),
+			PauseExpiry:        viper.GetDuration("pause-expiry"),
+			ResumeTimeout:      viper.GetDuration("resume-timeout"),
+			PacemakerTimeout:   viper.GetDuration("pacemaker-timeout"),
+			RestartTimeout:     viper.GetDuration("restart-timeout"),
+			MigrationLifetime:  viper.GetDuration("migration-lifetime"),
+			SettleTimeout:      viper.GetDuration("settle-timeout"),
+			Force:              viper.GetBool("force"),
+		},
 	}
+}
 
-	locker := concurrency.NewMutex(session, f.opt.EtcdHostKey)
+func (f *failoverCommand) Run(ctx context.Context, logger kitlog.Logger) error {
+	return f.with(ctx, logger, func(fo *failover.Failover, deferCtx context.Context) error {
+		return fo.Run(ctx, deferCtx)
+	})
+}
 
+// with connects to each failover endpoint and constructs a Failover, calling action with
+// a context that should be used for deferred cleanup tasks.
+func (f *failoverCommand) with(ctx context.Context, logger kitlog.Logger, action func(*failover.Failover, context.Context) error) error {
 	clients := map[string]failover.FailoverClient{}
 	for _, endpoint := range f.endpoints {
 		logger.Log("event", "client.connecting", "endpoint", endpoint)
@@ -110,9 +136,14 @@ func (f *failoverCommand) Run(ctx context.Context, logger kitlog.Logger) error {
 	go func() { ctx.Done(); time.Sleep(10 * time.Second); cancel() }()
 	defer cancel()
 
-	return failover.NewFailover(
-		logger, f.client, clients, locker, f.opt,
-	).Run(
-		ctx, deferCtx,
-	)
+	// Our lock is held for the lifetime of this lease, which must outlive any deferred
+	// actions that release it.
+	lease, _, err := store.KeepAlive(deferCtx, kitlog.With(logger, "component", "store.lease"), f.store, lockTTL)
+	if err != nil {
+		return err
+	}
+
+	locker := f.store.Locker(f.opt.EtcdHostKey+"/lock", lease)
+
+	return action(failover.NewFailover(logger, f.store, clients, locker, f.opt), deferCtx)
 }
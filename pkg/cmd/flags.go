@@ -1,12 +1,18 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/clientv3/namespace"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/consul"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/etcd"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pacemaker"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/pgbouncer"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
@@ -14,28 +20,184 @@ import (
 func addPgBouncerFlags(flags *pflag.FlagSet) {
 	flags.String("pgbouncer-user", "pgbouncer", "Admin user of PgBouncer")
 	flags.String("pgbouncer-password", "", "Password for admin user")
+	flags.String("pgbouncer-password-file", "", "Read the admin user's password from this file")
 	flags.String("pgbouncer-database", "pgbouncer", "PgBouncer special database (inadvisable to change)")
 	flags.String("pgbouncer-socket-dir", "/var/run/postgresql", "Directory in which the unix socket resides")
 	flags.String("pgbouncer-port", "6432", "Port that PgBouncer is listening on")
+	flags.String("pgbouncer-host", "", "Connect to PgBouncer over TCP at this host, instead of the unix socket")
+	flags.String("pgbouncer-sslmode", "", "TLS mode for PgBouncer connections (disable, allow, prefer, require, verify-ca, verify-full), defaulting to prefer over TCP")
+	flags.String("pgbouncer-sslrootcert", "", "CA certificates used to verify PgBouncer")
+	flags.String("pgbouncer-sslcert", "", "Client certificate presented to PgBouncer")
+	flags.String("pgbouncer-sslkey", "", "Key for the client certificate")
 	flags.String("pgbouncer-config-file", "/etc/pgbouncer/pgbouncer.ini", "Path to PgBouncer config file")
 	flags.String("pgbouncer-config-template-file", "/etc/pgbouncer/pgbouncer.ini.template", "Path to PgBouncer config template file")
 	flags.Duration("pgbouncer-timeout", 5*time.Second, "Timeout for PgBouncer operations")
+	flags.Duration("pgbouncer-ping-interval", 30*time.Second, "Check the PgBouncer admin connection on this interval, reconnecting if broken (disabled if zero)")
+}
+
+func addMetricsFlags(flags *pflag.FlagSet) {
+	flags.String("metrics-address", "", "Serve Prometheus metrics, including PgBouncer pools and stats, on this address (disabled if empty)")
+	flags.Duration("metrics-pgbouncer-timeout", time.Second, "Timeout for reading PgBouncer metrics on each scrape")
 }
 
 func mustPgBouncer() *pgbouncer.PgBouncer {
 	return &pgbouncer.PgBouncer{
 		ConfigFile:         viper.GetString("pgbouncer-config-file"),
 		ConfigTemplateFile: viper.GetString("pgbouncer-config-template-file"),
-		Executor: pgbouncer.AuthorizedExecutor{
+		Executor: &pgbouncer.AuthorizedExecutor{
 			User:      viper.GetString("pgbouncer-user"),
 			Password:  viper.GetString("pgbouncer-password"),
 			Database:  viper.GetString("pgbouncer-database"),
 			SocketDir: viper.GetString("pgbouncer-socket-dir"),
 			Port:      viper.GetString("pgbouncer-port"),
+
+			Host:         viper.GetString("pgbouncer-host"),
+			PasswordFile: viper.GetString("pgbouncer-password-file"),
+			SSLMode:      viper.GetString("pgbouncer-sslmode"),
+			SSLRootCert:  viper.GetString("pgbouncer-sslrootcert"),
+			SSLCert:      viper.GetString("pgbouncer-sslcert"),
+			SSLKey:       viper.GetString("pgbouncer-sslkey"),
 		},
 	}
 }
 
+func addPacemakerFlags(flags *pflag.FlagSet) {
+	flags.String("pacemaker-backend", "auto", "Tooling used to run pacemaker commands (auto, crmsh, pcs, native)")
+	flags.String("pacemaker-profile", "pgsql", "Resource agent profile (pgsql, paf)")
+	flags.String("pacemaker-resource", "", "Override the profile master/slave resource ID")
+	flags.String("pacemaker-role-attribute", "", "Override the profile node attribute that denotes Postgres role")
+	flags.String("pacemaker-master-value", "", "Override the profile role attribute value for the master")
+	flags.String("pacemaker-sync-value", "", "Override the profile role attribute value for the sync")
+	flags.String("pacemaker-async-value", "", "Override the profile role attribute value for asyncs")
+	flags.String("pacemaker-role-attribute-type", "", "Override whether the role attribute is a transient or permanent node attribute")
+	flags.String("pacemaker-async-scores", "", "Override the profile range of role attribute scores denoting asyncs, as exclusive low,high bounds")
+	flags.StringSlice("address-resolvers", []string{"corosync"}, "Resolvers used to find node addresses, tried in order (corosync, static, dns, attribute)")
+	flags.String("address-family", "any", "Address family to publish (any, ipv4, ipv6, prefer-ipv4, prefer-ipv6)")
+	flags.Int("address-corosync-ring", -1, "Corosync ring to resolve addresses from (-1 for all rings)")
+	flags.StringSlice("address-static", []string{}, "Static node addresses, as node=address (repeat for multiple addresses)")
+	flags.String("address-dns-suffix", "", "Suffix appended to node names before DNS lookup")
+	flags.String("address-attribute", "", "Pacemaker node attribute containing node addresses")
+}
+
+func mustPacemaker() *pacemaker.Pacemaker {
+	backend, err := pacemaker.NewBackend(viper.GetString("pacemaker-backend"))
+	if err != nil {
+		logger.Log("event", "pacemaker.failed", "error", err)
+		os.Exit(1)
+	}
+
+	profile, err := pacemaker.NewProfile(viper.GetString("pacemaker-profile"))
+	if err != nil {
+		logger.Log("event", "pacemaker.failed", "error", err)
+		os.Exit(1)
+	}
+
+	override := func(field *string, flag string) {
+		if value := viper.GetString(flag); value != "" {
+			*field = value
+		}
+	}
+
+	override(&profile.Resource, "pacemaker-resource")
+	override(&profile.Attribute, "pacemaker-role-attribute")
+	override(&profile.Master, "pacemaker-master-value")
+	override(&profile.Sync, "pacemaker-sync-value")
+	override(&profile.Async, "pacemaker-async-value")
+
+	switch attributeType := viper.GetString("pacemaker-role-attribute-type"); attributeType {
+	case "":
+	case "transient", "permanent":
+		profile.Transient = attributeType == "transient"
+	default:
+		logger.Log("event", "pacemaker.failed", "error", "invalid pacemaker-role-attribute-type", "type", attributeType)
+		os.Exit(1)
+	}
+
+	if scores := viper.GetString("pacemaker-async-scores"); scores != "" {
+		profile.AsyncScores, err = pacemaker.ParseScoreRange(scores)
+		if err != nil {
+			logger.Log("event", "pacemaker.failed", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	logger.Log("event", "pacemaker.configured", "backend", backend.Name(),
+		"profile", profile.Name, "resource", profile.Resource)
+
+	resolver, family := mustResolver()
+
+	return pacemaker.NewPacemaker(nil, backend, profile).WithResolver(resolver, family)
+}
+
+func mustResolver() (pacemaker.Resolver, pacemaker.AddressFamily) {
+	family, err := pacemaker.NewAddressFamily(viper.GetString("address-family"))
+	if err != nil {
+		logger.Log("event", "pacemaker.failed", "error", err)
+		os.Exit(1)
+	}
+
+	resolvers := pacemaker.ChainResolver{}
+	for _, name := range viper.GetStringSlice("address-resolvers") {
+		switch name {
+		case "corosync":
+			resolvers = append(resolvers, pacemaker.CorosyncResolver{Ring: viper.GetInt("address-corosync-ring")})
+		case "static":
+			static := pacemaker.StaticResolver{}
+			for _, entry := range viper.GetStringSlice("address-static") {
+				parts := strings.SplitN(entry, "=", 2)
+				if len(parts) != 2 {
+					logger.Log("event", "pacemaker.failed", "error", "invalid address-static entry", "entry", entry)
+					os.Exit(1)
+				}
+
+				static[parts[0]] = append(static[parts[0]], parts[1])
+			}
+
+			resolvers = append(resolvers, static)
+		case "dns":
+			resolvers = append(resolvers, pacemaker.DNSResolver{Suffix: viper.GetString("address-dns-suffix")})
+		case "attribute":
+			resolvers = append(resolvers, pacemaker.AttributeResolver{Attribute: viper.GetString("address-attribute")})
+		default:
+			logger.Log("event", "pacemaker.failed", "error", pacemaker.UnknownResolverError(name))
+			os.Exit(1)
+		}
+	}
+
+	logger.Log("event", "pacemaker.resolver", "resolvers", strings.Join(viper.GetStringSlice("address-resolvers"), ","),
+		"family", family)
+
+	return resolvers, family
+}
+
+func addStoreFlags(flags *pflag.FlagSet) {
+	flags.String("store", "etcd", "Key-value store that holds cluster state (etcd, consul)")
+	flags.String("consul-address", "http://127.0.0.1:8500", "Address of the Consul agent HTTP API")
+	flags.String("consul-token", "", "ACL token for Consul requests")
+	flags.String("consul-prefix", "pgsql-cluster-manager", "Prefix all Consul keys with this value")
+	addEtcdFlags(flags)
+}
+
+// mustStore connects to the configured store. Key flags are named for etcd, as it was
+// our only store, but apply to whichever is used.
+func mustStore() store.Store {
+	switch backend := viper.GetString("store"); backend {
+	case "etcd":
+		return etcd.NewStore(mustEtcdClient())
+	case "consul":
+		return consul.NewStore(
+			viper.GetString("consul-address"),
+			viper.GetString("consul-token"),
+			viper.GetString("consul-prefix"),
+		)
+	default:
+		logger.Log("event", "store.failed", "error", fmt.Sprintf("unknown store: '%s'", backend))
+		os.Exit(1)
+	}
+
+	return nil
+}
+
 func addEtcdFlags(flags *pflag.FlagSet) {
 	flags.String("etcd-namespace", "", "Namespace all requests to etcd under this value")
 	flags.StringSlice("etcd-endpoints", []string{"http://127.0.0.1:2379"}, "gRPC etcd endpoints")
@@ -44,6 +206,23 @@ func addEtcdFlags(flags *pflag.FlagSet) {
 	flags.Duration("etcd-keep-alive-time", 30*time.Second, "Time after which client pings server to check transport")
 	flags.Duration("etcd-keep-alive-timeout", 5*time.Second, "Timeout for the keep alive probe")
 	flags.String("etcd-postgres-master-key", "/master", "etcd key that stores current Postgres primary")
+	flags.String("etcd-postgres-generation-key", "/master-generation", "etcd key that stores the generation of the current Postgres primary")
+	flags.String("etcd-postgres-topology-key", "/topology", "etcd key that stores the cluster topology")
+	flags.String("etcd-postgres-restart-key", "/rolling-restart", "etcd key that stores rolling restart progress")
+	flags.String("etcd-election-key", "/supervise-election", "etcd key under which supervise processes elect a leader to publish state (empty to disable)")
+	flags.String("etcd-schema-version-key", "/schema-version", "etcd key that stores the schema version of our keys")
+}
+
+// storeKeys returns the location of every key we own in the store
+func storeKeys() store.Keys {
+	return store.Keys{
+		Master:     viper.GetString("etcd-postgres-master-key"),
+		Generation: viper.GetString("etcd-postgres-generation-key"),
+		Topology:   viper.GetString("etcd-postgres-topology-key"),
+		Restart:    viper.GetString("etcd-postgres-restart-key"),
+		Election:   viper.GetString("etcd-election-key"),
+		Schema:     viper.GetString("etcd-schema-version-key"),
+	}
 }
 
 func mustEtcdClient() *clientv3.Client {
@@ -79,4 +258,8 @@ func addFailoverFlags(flags *pflag.FlagSet) {
 	flags.Duration("pause-expiry", 25*time.Second, "Time after which PgBouncer will automatically lift pause")
 	flags.Duration("resume-timeout", 5*time.Second, "Timeout for PgBouncer resume operations")
 	flags.Duration("pacemaker-timeout", 20*time.Second, "Timeout for executing (not necessarily to completion) pacemaker commands")
+	flags.Duration("migration-lifetime", 2*time.Minute, "Lifetime of migration constraints, after which pacemaker removes them")
+	flags.Bool("force", false, "Migrate even if pacemaker prechecks find problems")
+	flags.Duration("settle-timeout", 2*time.Minute, "Timeout for the cluster to settle after maintenance operations")
+	flags.Duration("restart-timeout", 5*time.Minute, "Timeout for pacemaker to stop and start Postgres on each node during a rolling restart")
 }
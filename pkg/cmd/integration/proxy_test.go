@@ -7,6 +7,7 @@ import (
 	"github.com/gocardless/pgsql-cluster-manager/pkg/cmd"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/etcd"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/pgbouncer"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/streams"
 
 	. "github.com/gocardless/pgsql-cluster-manager/pkg/etcd/integration"
@@ -33,17 +34,20 @@ var _ = Describe("$ pgcm proxy", func() {
 		etcdHostKey = RandomKey()
 
 		proxy = &cmd.ProxyOptions{
-			etcd.StreamOptions{
+			store.StreamOptions{
 				Ctx:          ctx,
 				GetTimeout:   time.Second,
 				PollInterval: 250 * time.Millisecond,
-				Keys:         []string{etcdHostKey},
+				Keys:         []string{etcdHostKey, etcdHostKey + "-topology"},
 			},
 			streams.RetryFoldOptions{
 				Ctx:      ctx,
 				Interval: 250 * time.Millisecond,
 				Timeout:  time.Second,
 			},
+			cmd.UnknownMasterDisable,
+			etcdHostKey + "-generation",
+			etcdHostKey + "-topology",
 		}
 	})
 
@@ -64,7 +68,7 @@ var _ = Describe("$ pgcm proxy", func() {
 	Context("When etcd key exists", func() {
 		It("Configures PgBouncer host in response to changes", func() {
 			put(etcdHostKey, "127.0.0.123")
-			go proxy.Run(ctx, logger, client, bouncer)
+			go proxy.Run(ctx, logger, etcd.NewStore(client), bouncer)
 
 			Eventually(showDatabases).Should(
 				ContainElement(
@@ -88,5 +92,106 @@ var _ = Describe("$ pgcm proxy", func() {
 				),
 			)
 		})
+
+		It("Configures PgBouncer from JSON master records", func() {
+			put(etcdHostKey, `{"version": 1, "host": "127.0.0.123", "port": 5432, "node": "pg01"}`)
+			go proxy.Run(ctx, logger, etcd.NewStore(client), bouncer)
+
+			Eventually(showDatabases).Should(
+				ContainElement(
+					pgbouncer.Database{
+						Name: "postgres",
+						Port: "5432",
+						Host: "127.0.0.123",
+					},
+				),
+			)
+		})
+
+		It("Recovers once a deleted key reappears", func() {
+			put(etcdHostKey, "127.0.0.123")
+			go proxy.Run(ctx, logger, etcd.NewStore(client), bouncer)
+
+			Eventually(showDatabases).Should(
+				ContainElement(
+					pgbouncer.Database{
+						Name: "postgres",
+						Port: "5432",
+						Host: "127.0.0.123",
+					},
+				),
+			)
+
+			_, err := client.Delete(ctx, etcdHostKey)
+			Expect(err).NotTo(HaveOccurred())
+
+			put(etcdHostKey, "127.0.0.456")
+
+			Eventually(showDatabases).Should(
+				ContainElement(
+					pgbouncer.Database{
+						Name: "postgres",
+						Port: "5432",
+						Host: "127.0.0.456",
+					},
+				),
+			)
+		})
+
+		It("Configures replica pools from the topology", func() {
+			put(etcdHostKey, "127.0.0.123")
+			go proxy.Run(ctx, logger, etcd.NewStore(client), bouncer)
+
+			Eventually(showDatabases).Should(
+				ContainElement(
+					pgbouncer.Database{
+						Name: "postgres",
+						Port: "5432",
+						Host: "127.0.0.123",
+					},
+				),
+			)
+
+			put(etcdHostKey+"-topology", `{"quorate": true, "nodes": [{"name": "pg02", "address": "127.0.0.124", "role": "sync"}]}`)
+
+			Eventually(showDatabases).Should(
+				ContainElement(
+					pgbouncer.Database{
+						Name: "postgres_sync",
+						Port: "5432",
+						Host: "127.0.0.124",
+					},
+				),
+			)
+		})
+
+		It("Ignores masters with an older generation", func() {
+			put(etcdHostKey+"-generation", "10")
+			put(etcdHostKey, "127.0.0.123")
+			go proxy.Run(ctx, logger, etcd.NewStore(client), bouncer)
+
+			Eventually(showDatabases).Should(
+				ContainElement(
+					pgbouncer.Database{
+						Name: "postgres",
+						Port: "5432",
+						Host: "127.0.0.123",
+					},
+				),
+			)
+
+			put(etcdHostKey+"-generation", "5")
+			put(etcdHostKey, "127.0.0.456")
+
+			Consistently(showDatabases, time.Second).ShouldNot(
+				ContainElement(
+					pgbouncer.Database{
+						Name: "postgres",
+						Port: "5432",
+						Host: "127.0.0.456",
+					},
+				),
+			)
+		})
 	})
 })
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/gocardless/pgsql-cluster-manager/pkg/failover"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var evacuateLongDescription = `
+Prepare a Postgres node for maintenance, such as kernel patching, by
+moving all Postgres roles away from it and placing it into pacemaker
+standby.
+
+If the node is the current primary, we first perform a zero-downtime
+failover to the sync node (see failover --help). If the node is the
+sync, we wait for another replica to become sync once the node has been
+placed into standby.
+
+The evacuation completes once the cluster reports quorum with an
+online primary, using the topology that supervise publishes to etcd.
+
+# settle-timeout
+
+Bounds the time we wait for the cluster to settle after placing the
+node into standby.
+`
+
+var restoreLongDescription = `
+Bring a node evacuated for maintenance out of pacemaker standby, waiting
+until it rejoins the cluster as a replica.
+`
+
+var rollingRestartLongDescription = `
+Restart Postgres on every node, one at a time, such as when applying
+configuration or minor version changes that require a restart.
+
+Replicas are restarted first, waiting for each to resume streaming
+before moving on. We then perform a zero-downtime failover away from the
+primary (see failover --help) and restart the old primary last.
+
+Progress is stored in etcd after each node is restarted. If the restart
+is interrupted, running rolling-restart again will resume from where it
+left off.
+
+# restart-timeout
+
+Bounds the time pacemaker has to stop and start Postgres on each node.
+This should exceed the time Postgres takes to shut down and recover, as
+pacemaker's restart is interrupted once it elapses.
+`
+
+func NewEvacuateCommand(ctx context.Context) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "evacuate <node>",
+		Short: "Move all Postgres roles off a node and place it in standby",
+		Long:  evacuateLongDescription,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return newFailoverCommand().with(ctx, logger, func(fo *failover.Failover, deferCtx context.Context) error {
+				return fo.Evacuate(ctx, deferCtx, args[0])
+			})
+		},
+	}
+
+	addFailoverFlags(c.Flags())
+	viper.BindPFlags(c.Flags())
+
+	return c
+}
+
+func NewRestoreCommand(ctx context.Context) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "restore <node>",
+		Short: "Bring an evacuated node out of standby",
+		Long:  restoreLongDescription,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return newFailoverCommand().with(ctx, logger, func(fo *failover.Failover, deferCtx context.Context) error {
+				return fo.Restore(ctx, deferCtx, args[0])
+			})
+		},
+	}
+
+	addFailoverFlags(c.Flags())
+	viper.BindPFlags(c.Flags())
+
+	return c
+}
+
+func NewRollingRestartCommand(ctx context.Context) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "rolling-restart",
+		Short: "Restart Postgres on each node, one at a time",
+		Long:  rollingRestartLongDescription,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return newFailoverCommand().with(ctx, logger, func(fo *failover.Failover, deferCtx context.Context) error {
+				return fo.RollingRestart(ctx, deferCtx)
+			})
+		},
+	}
+
+	addFailoverFlags(c.Flags())
+	viper.BindPFlags(c.Flags())
+
+	return c
+}
@@ -2,14 +2,18 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
 	"time"
 
-	"github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/mvcc/mvccpb"
 	kitlog "github.com/go-kit/kit/log"
-	"github.com/gocardless/pgsql-cluster-manager/pkg/etcd"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pacemaker"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/pgbouncer"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/streams"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -19,15 +23,16 @@ func NewProxyCommand(ctx context.Context) *cobra.Command {
 		Use:   "proxy",
 		Short: "Manages PgBouncer proxy",
 		Long: "Controls a PgBouncer by templating its config file to point pools at the host " +
-			"located at --etcd-postgres-master-etcd-key",
+			"located at --etcd-postgres-master-etcd-key, and replicas from --etcd-postgres-topology-key",
 		RunE: func(_ *cobra.Command, _ []string) error {
 			proxy := &ProxyOptions{
-				etcd.StreamOptions{
+				store.StreamOptions{
 					Ctx:          ctx,
 					GetTimeout:   viper.GetDuration("etcd-get-timeout"),
 					PollInterval: viper.GetDuration("etcd-stream-poll-interval"),
 					Keys: []string{
 						viper.GetString("etcd-postgres-master-key"),
+						viper.GetString("etcd-postgres-topology-key"),
 					},
 				},
 				streams.RetryFoldOptions{
@@ -35,17 +40,91 @@ func NewProxyCommand(ctx context.Context) *cobra.Command {
 					Interval: viper.GetDuration("pgbouncer-retry-timeout"),
 					Timeout:  viper.GetDuration("pgbouncer-timeout"),
 				},
+				UnknownMasterAction(viper.GetString("unknown-master")),
+				viper.GetString("etcd-postgres-generation-key"),
+				viper.GetString("etcd-postgres-topology-key"),
 			}
 
-			return proxy.Run(ctx, logger, mustEtcdClient(), mustPgBouncer())
+			pgBouncer := mustPgBouncer()
+			if interval := viper.GetDuration("pgbouncer-ping-interval"); interval > 0 {
+				logger := kitlog.With(logger, "component", "pgbouncer")
+				go pingPgBouncer(ctx, logger, pgBouncer, interval, viper.GetDuration("pgbouncer-timeout"))
+			}
+
+			if address := viper.GetString("metrics-address"); address != "" {
+				go func() {
+					logger := kitlog.With(logger, "component", "metrics")
+					err := serveMetrics(ctx, logger, address, pgBouncer, viper.GetDuration("metrics-pgbouncer-timeout"))
+					if err != nil {
+						logger.Log("event", "metrics.error", "error", err)
+					}
+				}()
+			}
+
+			return proxy.Run(ctx, logger, mustStore(), pgBouncer)
 		},
 	}
 
-	addPgBouncerFlags(c.Flags())
+	// Shared with subcommands such as render, which need to find the config template
+	addPgBouncerFlags(c.PersistentFlags())
+	viper.BindPFlags(c.PersistentFlags())
 
 	c.Flags().Duration("etcd-stream-poll-interval", time.Minute, "poll etcd on this interval")
 	c.Flags().Duration("etcd-get-timeout", 5*time.Second, "timeout for etcd get operation")
 	c.Flags().Duration("pgbouncer-retry-interval", 5*time.Second, "retry failed PgBouncer operations at this interval")
+	c.Flags().String("unknown-master", "keep", "action when the master key is missing or expired (keep, pause, disable)")
+
+	viper.BindPFlags(c.Flags())
+
+	c.AddCommand(NewProxyRenderCommand(ctx))
+
+	return c
+}
+
+func NewProxyRenderCommand(ctx context.Context) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "render",
+		Short: "Print the PgBouncer config that proxy would write for the given master",
+		Long: "Renders and validates the PgBouncer config template without writing the config " +
+			"file or contacting PgBouncer, failing if the result breaks any lint rules",
+		RunE: func(_ *cobra.Command, _ []string) error {
+			master := store.Master{
+				Version: store.MasterVersion,
+				Host:    viper.GetString("host"),
+				Port:    viper.GetInt("port"),
+				Node:    viper.GetString("node"),
+			}
+
+			if master.Host == "" {
+				return fmt.Errorf("no --host given")
+			}
+
+			topology := &pacemaker.Topology{}
+			if sync := viper.GetString("sync"); sync != "" {
+				topology.Nodes = append(topology.Nodes, pacemaker.Node{Address: sync, Role: pacemaker.RoleSync})
+			}
+
+			for _, async := range viper.GetStringSlice("async") {
+				topology.Nodes = append(topology.Nodes, pacemaker.Node{Address: async, Role: pacemaker.RoleAsync})
+			}
+
+			config, err := mustPgBouncer().RenderConfig(pgbouncer.NewConfigData(master, topology))
+			if config != nil {
+				os.Stdout.Write(config)
+			}
+
+			return err
+		},
+		Example: `
+  # Preview config with a sync replica, checking the template is valid
+  pgcm proxy render --host 10.0.0.1 --sync 10.0.0.2`,
+	}
+
+	c.Flags().String("host", "", "Address of the master to render")
+	c.Flags().Int("port", 5432, "Postgres port of the master")
+	c.Flags().String("node", "", "Pacemaker node name of the master")
+	c.Flags().String("sync", "", "Address of the sync replica, if any")
+	c.Flags().StringSlice("async", []string{}, "Addresses of async replicas (repeat for multiple addresses)")
 
 	viper.BindPFlags(c.Flags())
 
@@ -53,27 +132,145 @@ func NewProxyCommand(ctx context.Context) *cobra.Command {
 }
 
 type ProxyOptions struct {
-	etcd.StreamOptions
+	store.StreamOptions
 	streams.RetryFoldOptions
+	UnknownMaster UnknownMasterAction
+	GenerationKey string // if set, ignore masters older than one we've already applied
+	TopologyKey   string // if set, render replicas from the topology published by supervise
 }
 
-func (opt *ProxyOptions) Run(ctx context.Context, logger kitlog.Logger, client *clientv3.Client, pgBouncer *pgbouncer.PgBouncer) (err error) {
-	kvs, _ := etcd.NewStream(logger, client, opt.StreamOptions)
+// UnknownMasterAction determines how we configure PgBouncer when the master key is
+// missing, such as when every supervise has died and the key's lease has expired.
+type UnknownMasterAction string
+
+const (
+	UnknownMasterKeep    UnknownMasterAction = "keep"    // continue routing to the last master
+	UnknownMasterPause   UnknownMasterAction = "pause"   // queue queries until a master is known
+	UnknownMasterDisable UnknownMasterAction = "disable" // reject new client connections
+)
+
+func (opt *ProxyOptions) Run(ctx context.Context, logger kitlog.Logger, st store.Store, pgBouncer *pgbouncer.PgBouncer) (err error) {
+	switch opt.UnknownMaster {
+	case "":
+		opt.UnknownMaster = UnknownMasterKeep
+	case UnknownMasterKeep, UnknownMasterPause, UnknownMasterDisable:
+	default:
+		return fmt.Errorf("invalid unknown-master action: '%s'", opt.UnknownMaster)
+	}
+
+	// Watch errors are retried by the stream, but mean we may be routing to a stale master
+	// until it recovers, which operators should know about.
+	errs := make(chan error)
+	go func() {
+		for err := range errs {
+			logger.Log("event", "store.stream_error", "error", err,
+				"msg", "failed to watch master key, PgBouncer may be routing to a stale master")
+		}
+	}()
+
+	streamOptions := opt.StreamOptions
+	streamOptions.Errors = errs
+
+	kvs, done := store.NewStream(logger, st, streamOptions)
+	go func() { <-done; close(errs) }()
 
 	// etcd provides events out-of-order, and potentially duplicated. We need to use the
 	// RevisionFilter to ensure we only fold our events in their logical order, without
 	// duplicates.
 	kvs = streams.RevisionFilter(logger, kvs)
 
+	// Stale writers may publish an old master long after a newer one was applied, which the
+	// RevisionFilter can't detect. Each master is published with a generation that
+	// increases with every promotion, allowing us to refuse any that move backwards.
+	if opt.GenerationKey != "" {
+		kvs = store.GenerationFilter(ctx, logger, st, opt.Keys[0], opt.GenerationKey, opt.GetTimeout, kvs)
+	}
+
+	// Tracks whether we've applied the unknown master action, which we need to reverse
+	// once a master is known again.
+	unknown := false
+
+	// We render from the latest master and topology, so changes to either require a reload
+	var master *store.Master
+	var topology *pacemaker.Topology
+
+	reload := func(ctx context.Context) error {
+		logger.Log("event", "pgbouncer.reload_configuration", "host", master.Host, "node", master.Node,
+			"age", master.Age(time.Now()))
+		return pgBouncer.ApplyConfig(ctx, pgbouncer.NewConfigData(*master, topology))
+	}
+
 	err = streams.RetryFold(
 		logger, kvs, opt.RetryFoldOptions,
 		func(ctx context.Context, kv *mvccpb.KeyValue) error {
-			logger.Log("event", "pgbouncer.reload_configuration", "host", string(kv.Value))
-			if err := pgBouncer.GenerateConfig(string(kv.Value)); err != nil {
+			if opt.TopologyKey != "" && string(kv.Key) == opt.TopologyKey {
+				topology = nil
+				if len(kv.Value) > 0 {
+					topology = &pacemaker.Topology{}
+					if err := json.Unmarshal(kv.Value, topology); err != nil {
+						return errors.Wrap(err, "failed to parse topology")
+					}
+				}
+
+				// Until we know the master there's nothing to render, and we'll pick up this
+				// topology once we do.
+				if master == nil {
+					return nil
+				}
+
+				return reload(ctx)
+			}
+
+			if len(kv.Value) == 0 {
+				logger.Log("event", "master.unknown", "action", opt.UnknownMaster,
+					"msg", "master key is missing or expired (is supervise running?)")
+
+				// Set before acting, as a PAUSE that times out still takes effect, and must be
+				// reversed even if a master reappears before we retry.
+				unknown = true
+
+				switch opt.UnknownMaster {
+				case UnknownMasterPause:
+					if err := pgBouncer.Pause(ctx); err != nil {
+						return err
+					}
+				case UnknownMasterDisable:
+					if err := pgBouncer.Disable(ctx); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			}
+
+			parsed, err := store.ParseMaster(string(kv.Value))
+			if err != nil {
+				return err
+			}
+
+			master = parsed
+			if err := reload(ctx); err != nil {
 				return err
 			}
 
-			return pgBouncer.Reload(ctx)
+			if unknown {
+				logger.Log("event", "master.known", "host", master.Host)
+
+				switch opt.UnknownMaster {
+				case UnknownMasterPause:
+					if err := pgBouncer.Resume(ctx); err != nil {
+						return err
+					}
+				case UnknownMasterDisable:
+					if err := pgBouncer.Enable(ctx); err != nil {
+						return err
+					}
+				}
+
+				unknown = false
+			}
+
+			return nil
 		},
 	)
 
@@ -83,5 +280,7 @@ func (opt *ProxyOptions) Run(ctx context.Context, logger kitlog.Logger, client *
 	}
 
 	logger.Log("event", "proxy.shutdown")
+	pgBouncer.Close()
+
 	return err
 }
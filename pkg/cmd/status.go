@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/gocardless/pgsql-cluster-manager/pkg/failover"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var statusLongDescription = `
+Display pacemaker resource fail counts and failed actions for each node,
+as would be shown by crm_mon -Afr on a cluster node.
+
+Fail counts remain until cleaned up, and once they reach the resource
+migration-threshold will prevent pacemaker from running Postgres on that
+node. This can stop a node being promoted or rejoining the cluster. Use
+pgcm cleanup <node> to clear them once the cause has been resolved.
+`
+
+func NewStatusCommand(ctx context.Context) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "status",
+		Short: "Display resource fail counts and failed actions",
+		Long:  statusLongDescription,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			client := newAPIClient()
+			return client.Run(ctx, logger, func(ctx context.Context, api failover.FailoverClient) error {
+				resp, err := api.Failures(ctx, &failover.Empty{})
+				if err != nil {
+					return err
+				}
+
+				return printFailures(client, resp)
+			})
+		},
+	}
+
+	addFailoverFlags(c.Flags())
+	viper.BindPFlags(c.Flags())
+
+	return c
+}
+
+func NewCleanupCommand(ctx context.Context) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "cleanup <node>",
+		Short: "Clear resource fail counts and failed actions for a node",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return newAPIClient().Run(ctx, logger, func(ctx context.Context, api failover.FailoverClient) error {
+				_, err := api.Cleanup(ctx, &failover.NodeRequest{Node: args[0]})
+				if err == nil {
+					logger.Log("event", "cleanup.success", "node", args[0])
+				}
+
+				return err
+			})
+		},
+	}
+
+	addFailoverFlags(c.Flags())
+	viper.BindPFlags(c.Flags())
+
+	return c
+}
+
+func printFailures(c *apiClient, resp *failover.FailuresResponse) error {
+	w := tabwriter.NewWriter(c.out, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "Fail counts:")
+	if len(resp.FailCounts) == 0 {
+		fmt.Fprintln(w, "  none")
+	} else {
+		fmt.Fprintln(w, "  NODE\tRESOURCE\tOPERATION\tCOUNT")
+		for _, count := range resp.FailCounts {
+			operation := count.Operation
+			if operation == "" {
+				operation = "-"
+			}
+
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", count.Node, count.Resource, operation, count.Count)
+		}
+	}
+
+	fmt.Fprintln(w, "\nFailed actions:")
+	if len(resp.FailedActions) == 0 {
+		fmt.Fprintln(w, "  none")
+	} else {
+		fmt.Fprintln(w, "  NODE\tRESOURCE\tOPERATION\tRESULT\tLAST CHANGE\tEXIT REASON")
+		for _, action := range resp.FailedActions {
+			lastChange := "-"
+			if ts, err := ptypes.Timestamp(action.LastChange); err == nil {
+				lastChange = ts.Format("2006-01-02 15:04:05Z")
+			}
+
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s (%d)\t%s\t%s\n",
+				action.Node, action.Resource, action.Operation, action.Result, action.Rc, lastChange, action.ExitReason)
+		}
+	}
+
+	return w.Flush()
+}
@@ -2,18 +2,20 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net"
+	"strconv"
 	"time"
 
 	"google.golang.org/grpc"
 
-	"github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/mvcc/mvccpb"
 	kitlog "github.com/go-kit/kit/log"
-	"github.com/gocardless/pgsql-cluster-manager/pkg/etcd"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/failover"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/pacemaker"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/pgbouncer"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/streams"
 	"github.com/oklog/run"
 	"github.com/pkg/errors"
@@ -25,24 +27,49 @@ func NewSuperviseCommand(ctx context.Context) *cobra.Command {
 	c := &cobra.Command{
 		Use:   "supervise",
 		Short: "Supervise a cluster member",
-		Long:  "Sync pacemaker state to etcd and expose a failover API",
+		Long:  "Sync pacemaker state to etcd or Consul and expose a failover API",
 		RunE: func(_ *cobra.Command, _ []string) error {
+			crm := mustPacemaker()
+			masterXPath := viper.GetString("postgres-master-crm-xpath")
+			if masterXPath == "" {
+				masterXPath = crm.Profile().MasterXPath()
+			}
+
 			supervise := &SuperviseCommand{
-				client:      mustEtcdClient(),
-				pgBouncer:   mustPgBouncer(),
-				crm:         pacemaker.NewPacemaker(nil),
-				bindAddress: viper.GetString("bind-address"),
+				store:          mustStore(),
+				keys:           storeKeys(),
+				pgBouncer:      mustPgBouncer(),
+				pgBouncerPing:  viper.GetDuration("pgbouncer-ping-interval"),
+				crm:            crm,
+				bindAddress:    viper.GetString("bind-address"),
+				metricsAddress: viper.GetString("metrics-address"),
+				metricsTimeout: viper.GetDuration("metrics-pgbouncer-timeout"),
+				topologyKey:    viper.GetString("etcd-postgres-topology-key"),
+				generationKey:  viper.GetString("etcd-postgres-generation-key"),
+				masterTTL:      viper.GetDuration("etcd-master-key-ttl"),
+				masterFormat:   store.MasterFormat(viper.GetString("master-format")),
+				postgresPort:   viper.GetInt("postgres-port"),
+				timelineAttr:   viper.GetString("pacemaker-timeline-attribute"),
+				election: store.ElectionOptions{
+					Key:   viper.GetString("etcd-election-key"),
+					TTL:   electionTTL(viper.GetDuration("etcd-master-key-ttl")),
+					Delay: viper.GetDuration("election-dc-grace"),
+					// Handing over leadership shouldn't remove the master, as proxies would act
+					// as if it were unknown until our successor rewrites it.
+					Retain: []string{viper.GetString("etcd-postgres-master-key")},
+				},
 				StreamOptions: pacemaker.StreamOptions{
 					Ctx:       ctx,
 					Attribute: "id",
 					XPaths: []pacemaker.AliasedXPath{
 						pacemaker.AliasXPath(
 							viper.GetString("etcd-postgres-master-key"),
-							viper.GetString("postgres-master-crm-xpath"),
+							masterXPath,
 						),
 					},
-					PollInterval: viper.GetDuration("pacemaker-poll-interval"),
-					GetTimeout:   viper.GetDuration("pacemaker-get-timeout"),
+					PollInterval:   viper.GetDuration("pacemaker-poll-interval"),
+					ResyncInterval: viper.GetDuration("pacemaker-resync-interval"),
+					GetTimeout:     viper.GetDuration("pacemaker-get-timeout"),
 				},
 				RetryFoldOptions: streams.RetryFoldOptions{
 					Ctx:      ctx,
@@ -55,10 +82,18 @@ func NewSuperviseCommand(ctx context.Context) *cobra.Command {
 		},
 	}
 
-	c.Flags().String("postgres-master-crm-xpath", pacemaker.MasterXPath, "XPath selector into cibadmin that finds current master")
+	addPacemakerFlags(c.Flags())
+
+	c.Flags().String("postgres-master-crm-xpath", "", "XPath selector into cibadmin that finds current master (defaults to profile)")
 	c.Flags().String("bind-address", ":8080", "Bind API to this address")
 	c.Flags().Duration("host-key-update-retry-interval", time.Second, "Interval to retry etcd update of host key")
-	c.Flags().Duration("pacemaker-poll-interval", time.Second, "Interval to poll pacemaker for state changes")
+	c.Flags().Duration("etcd-master-key-ttl", 10*time.Second, "TTL of the lease attached to the master key (0 to disable)")
+	c.Flags().String("master-format", "json", "Format of the master key value (json, ip)")
+	c.Flags().Int("postgres-port", 5432, "Port that Postgres listens on, published in the master record")
+	c.Flags().String("pacemaker-timeline-attribute", "", "Node attribute containing the Postgres timeline, published in the master record")
+	c.Flags().Duration("election-dc-grace", 5*time.Second, "Time non-DC nodes wait before campaigning, giving way to the pacemaker DC")
+	c.Flags().Duration("pacemaker-poll-interval", 250*time.Millisecond, "Interval to poll the cib version for changes")
+	c.Flags().Duration("pacemaker-resync-interval", 30*time.Second, "Interval to query the full cib, even if unchanged")
 	c.Flags().Duration("pacemaker-get-timeout", 500*time.Millisecond, "Timeout for cib query operation")
 
 	viper.BindPFlags(c.Flags())
@@ -66,11 +101,32 @@ func NewSuperviseCommand(ctx context.Context) *cobra.Command {
 	return c
 }
 
+// electionTTL is the session TTL for leader election, which matches the master key TTL
+// as the leader attaches the key to its session lease.
+func electionTTL(masterTTL time.Duration) time.Duration {
+	if masterTTL > 0 {
+		return masterTTL
+	}
+
+	return 10 * time.Second
+}
+
 type SuperviseCommand struct {
-	client      *clientv3.Client
-	pgBouncer   *pgbouncer.PgBouncer
-	crm         *pacemaker.Pacemaker
-	bindAddress string
+	store          store.Store
+	keys           store.Keys
+	pgBouncer      *pgbouncer.PgBouncer
+	pgBouncerPing  time.Duration
+	crm            *pacemaker.Pacemaker
+	bindAddress    string
+	metricsAddress string
+	metricsTimeout time.Duration
+	topologyKey    string
+	generationKey  string
+	masterTTL      time.Duration
+	masterFormat   store.MasterFormat
+	postgresPort   int
+	timelineAttr   string
+	election       store.ElectionOptions
 	pacemaker.StreamOptions
 	streams.RetryFoldOptions
 }
@@ -78,42 +134,149 @@ type SuperviseCommand struct {
 func (c *SuperviseCommand) Run(ctx context.Context, logger kitlog.Logger) error {
 	logger = kitlog.With(logger, "role", "supervise")
 
+	switch c.masterFormat {
+	case "":
+		c.masterFormat = store.MasterFormatJSON
+	case store.MasterFormatJSON, store.MasterFormatIP:
+	default:
+		return fmt.Errorf("invalid master format: '%s'", c.masterFormat)
+	}
+
+	// Generations are the timeline of the published master, so without one every master
+	// would share generation zero and we couldn't refuse stale writes.
+	if c.generationKey != "" && c.timelineAttr == "" {
+		return errors.New("etcd-postgres-generation-key requires pacemaker-timeline-attribute, " +
+			"or set etcd-postgres-generation-key to an empty string to disable generations")
+	}
+
+	// Refuse to run against keys laid out by a newer release, whose format we may not
+	// understand. Failing to read the version shouldn't stop us supervising, as the store
+	// may only be temporarily unavailable.
+	{
+		var logger = kitlog.With(logger, "component", "store.schema")
+
+		checkCtx, checkCancel := context.WithTimeout(ctx, c.RetryFoldOptions.Timeout)
+		err := store.CheckSchemaVersion(checkCtx, logger, c.store, c.keys)
+		checkCancel()
+
+		if _, newer := err.(store.NewerSchemaError); newer {
+			return err
+		}
+
+		if err != nil {
+			logger.Log("event", "schema.check_error", "error", err)
+		}
+	}
+
+	// Open our PgBouncer admin connection ahead of any failover, so pausing doesn't wait on
+	// connection setup. PgBouncer may not have started yet, in which case we'll connect
+	// once it's first needed.
+	{
+		connectCtx, connectCancel := context.WithTimeout(ctx, c.RetryFoldOptions.Timeout)
+		if err := c.pgBouncer.Connect(connectCtx); err != nil {
+			logger.Log("event", "pgbouncer.connect_error", "error", err)
+		}
+		connectCancel()
+	}
+
+	defer c.pgBouncer.Close()
+
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	var g run.Group
 
-	{
-		var logger = kitlog.With(logger, "component", "pacemaker.stream")
-
-		kvs, _ := pacemaker.NewStream(logger, c.crm, c.StreamOptions)
-		kvs = streams.DedupeFilter(logger, kvs)
+	if c.pgBouncerPing > 0 {
+		var logger = kitlog.With(logger, "component", "pgbouncer")
 
 		g.Add(
 			func() error {
-				return streams.RetryFold(
-					logger, kvs, c.RetryFoldOptions,
-					func(ctx context.Context, kv *mvccpb.KeyValue) error {
-						hostKey, nodeID := string(kv.Key), string(kv.Value)
+				pingPgBouncer(ctx, logger, c.pgBouncer, c.pgBouncerPing, c.RetryFoldOptions.Timeout)
+				return nil
+			},
+			func(error) { cancel() },
+		)
+	}
 
-						logger := kitlog.With(logger, "hostKey", hostKey, "nodeID", nodeID)
-						logger.Log("event", "node.change")
+	if c.election.Key != "" {
+		if c.election.Candidate == "" {
+			candidate, err := c.crm.LocalNode(ctx)
+			if err != nil {
+				return errors.Wrap(err, "failed to identify local node for election")
+			}
 
-						// We get updates for the node ID, the numeric value that represents a
-						// corosync member node. We first need to resolve this into an IP address,
-						// then push it to etcd.
-						addr, err := c.crm.ResolveAddress(ctx, nodeID)
-						if err != nil {
-							logger.Log("event", "node.resolve.error", "error", err)
-							return err
+			c.election.Candidate = candidate
+		}
+
+		// Prefer the supervise running on the pacemaker DC, as it has the most up-to-date
+		// view of the cluster.
+		c.election.Preferred = func(ctx context.Context) (string, error) {
+			topology, err := c.crm.Topology(ctx)
+			if err != nil {
+				return "", err
+			}
+
+			return topology.DC, nil
+		}
+
+		g.Add(
+			func() error {
+				return store.Lead(ctx, kitlog.With(logger, "component", "store.election"), c.store, c.election,
+					func(ctx context.Context, lease store.LeaseID) error {
+						// Only the leader writes the master key, and attaching it to the session
+						// lease ensures it expires should we stop leading without resigning. When
+						// we do resign the key is released, and we'll attach it to our lease as
+						// soon as we publish, even if the master is unchanged.
+						if c.masterTTL == 0 {
+							lease = store.NoLease
 						}
 
-						logger.Log("event", "etcd.update", "addr", addr)
-						return etcd.CompareAndUpdate(ctx, c.client, hostKey, addr)
+						update := func(ctx context.Context, key, value string, generation int64) error {
+							return c.set(ctx, key, value, generation, lease)
+						}
+
+						return c.publish(ctx, logger, update, false)
 					},
 				)
 			},
 			func(error) { cancel() },
 		)
+	} else {
+		// The master key is attached to a lease that we keep alive for as long as we run. If
+		// every supervise dies, the key will expire and proxies will know the master is
+		// unknown, rather than continuing to route to a stale address.
+		update := func(ctx context.Context, key, value string, generation int64) error {
+			return c.set(ctx, key, value, generation, store.NoLease)
+		}
+
+		if c.masterTTL > 0 {
+			var logger = kitlog.With(logger, "component", "store.lease")
+
+			lease, lost, err := store.KeepAlive(ctx, logger, c.store, c.masterTTL)
+			if err != nil {
+				return err
+			}
+
+			update = func(ctx context.Context, key, value string, generation int64) error {
+				return c.set(ctx, key, value, generation, lease)
+			}
+
+			g.Add(
+				func() error {
+					select {
+					case <-lost:
+						return errors.New("lost lease for master key")
+					case <-ctx.Done():
+						return nil
+					}
+				},
+				func(error) { cancel() },
+			)
+		}
+
+		g.Add(
+			func() error { return c.publish(ctx, logger, update, c.masterTTL > 0) },
+			func(error) { cancel() },
+		)
 	}
 
 	{
@@ -140,6 +303,15 @@ func (c *SuperviseCommand) Run(ctx context.Context, logger kitlog.Logger) error
 		)
 	}
 
+	if c.metricsAddress != "" {
+		var logger = kitlog.With(logger, "component", "metrics")
+
+		g.Add(
+			func() error { return serveMetrics(ctx, logger, c.metricsAddress, c.pgBouncer, c.metricsTimeout) },
+			func(error) { cancel() },
+		)
+	}
+
 	if err := g.Run(); err != nil {
 		logger.Log("event", "supervise.finish", "error", err)
 		return err
@@ -147,3 +319,201 @@ func (c *SuperviseCommand) Run(ctx context.Context, logger kitlog.Logger) error
 
 	return nil
 }
+
+// publish streams the master and topology from pacemaker into etcd until the context is
+// done. When restore is set, we rewrite the master key should another writer's lease
+// expire.
+//
+// The master is published with its Postgres timeline as the generation, which increases
+// with every promotion. Should our view of pacemaker lag behind whoever published the
+// current master, our timeline will be older and the store refuses our write.
+func (c *SuperviseCommand) publish(ctx context.Context, logger kitlog.Logger, update func(context.Context, string, string, int64) error, restore bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var g run.Group
+
+	streamOptions, retryFoldOptions := c.StreamOptions, c.RetryFoldOptions
+	streamOptions.Ctx, retryFoldOptions.Ctx = ctx, ctx
+
+	{
+		var logger = kitlog.With(logger, "component", "pacemaker.stream")
+
+		kvs, _ := pacemaker.NewStream(logger, c.crm, streamOptions)
+		kvs = streams.DedupeFilter(logger, kvs)
+
+		// Other supervise processes may hold the lease on the master key, in which case we
+		// need to rewrite it should their lease expire.
+		if restore {
+			kvs = store.RestoreOnDelete(ctx, logger, c.store, kvs)
+		}
+
+		g.Add(
+			func() error {
+				return streams.RetryFold(
+					logger, kvs, retryFoldOptions,
+					func(ctx context.Context, kv *mvccpb.KeyValue) error {
+						hostKey, nodeID := string(kv.Key), string(kv.Value)
+
+						logger := kitlog.With(logger, "hostKey", hostKey, "nodeID", nodeID)
+						logger.Log("event", "node.change")
+
+						// We get updates for the node ID, the numeric value that represents a
+						// corosync member node. We first need to resolve this into an IP address,
+						// then push it to etcd.
+						addr, err := c.crm.ResolveAddress(ctx, nodeID)
+						if err != nil {
+							logger.Log("event", "node.resolve.error", "error", err)
+							return err
+						}
+
+						master, err := c.masterRecord(ctx, logger, nodeID, addr)
+						if err != nil {
+							logger.Log("event", "timeline.error", "error", err)
+							return err
+						}
+
+						c.keepUpdatedAt(ctx, logger, hostKey, &master)
+
+						value, err := master.Encode(c.masterFormat)
+						if err != nil {
+							return err
+						}
+
+						logger.Log("event", "etcd.update", "addr", addr, "generation", master.Timeline)
+						err = update(ctx, hostKey, value, master.Timeline)
+
+						// Retrying won't help, as we'd need pacemaker to tell us of a newer
+						// promotion, which we'll see as another change.
+						if err == store.ErrStaleGeneration {
+							logger.Log("event", "etcd.stale_generation", "generation", master.Timeline,
+								"msg", "refusing to publish master older than the current generation")
+							return nil
+						}
+
+						return err
+					},
+				)
+			},
+			func(error) { cancel() },
+		)
+	}
+
+	{
+		var logger = kitlog.With(logger, "component", "pacemaker.topology")
+
+		kvs, _ := pacemaker.NewTopologyStream(logger, c.crm, c.topologyKey, streamOptions)
+		kvs = streams.DedupeFilter(logger, kvs)
+
+		g.Add(
+			func() error {
+				return streams.RetryFold(
+					logger, kvs, retryFoldOptions,
+					func(ctx context.Context, kv *mvccpb.KeyValue) error {
+						var topology pacemaker.Topology
+						if err := json.Unmarshal(kv.Value, &topology); err != nil {
+							return err
+						}
+
+						logger.Log("event", "topology.change", "quorate", topology.Quorate)
+
+						// Failing to resolve a single node shouldn't prevent us publishing the
+						// rest of the topology, as it's likely that node is unhealthy.
+						for idx, node := range topology.Nodes {
+							addr, err := c.crm.ResolveAddress(ctx, node.ID)
+							if err != nil {
+								logger.Log("event", "node.resolve.error", "node", node.Name, "error", err)
+								continue
+							}
+
+							topology.Nodes[idx].Address = addr
+						}
+
+						value, err := json.Marshal(topology)
+						if err != nil {
+							return err
+						}
+
+						logger.Log("event", "etcd.update")
+						return c.store.CompareAndSet(ctx, string(kv.Key), string(value), store.NoLease)
+					},
+				)
+			},
+			func(error) { cancel() },
+		)
+	}
+
+	return g.Run()
+}
+
+// keepUpdatedAt reuses the timestamp of the published record if it describes the same
+// master. Otherwise republishing an unchanged master, such as after pacemaker resyncs or
+// we take over leadership, would look like a change to the store and every proxy.
+func (c *SuperviseCommand) keepUpdatedAt(ctx context.Context, logger kitlog.Logger, key string, master *store.Master) {
+	kv, _, err := c.store.Get(ctx, key, 0)
+	if err != nil {
+		logger.Log("event", "etcd.get_error", "error", err)
+		return
+	}
+
+	if kv == nil {
+		return
+	}
+
+	if published, err := store.ParseMaster(kv.Value); err == nil && published.Describes(*master) && !published.UpdatedAt.IsZero() {
+		master.UpdatedAt = published.UpdatedAt
+	}
+}
+
+// set writes the master key, along with its generation if enabled
+func (c *SuperviseCommand) set(ctx context.Context, key, value string, generation int64, lease store.LeaseID) error {
+	if c.generationKey == "" {
+		return c.store.CompareAndSet(ctx, key, value, lease)
+	}
+
+	return c.store.SetWithGeneration(ctx, key, c.generationKey, value, generation, lease)
+}
+
+// masterRecord describes the master at the given node. Failing to find the node in the
+// topology only loses detail from the record, so we log and publish what we have, unless
+// we need its timeline. The timeline is the generation we publish, and publishing a
+// master without one would look stale, so we fail and retry until we can read it.
+func (c *SuperviseCommand) masterRecord(ctx context.Context, logger kitlog.Logger, nodeID, addr string) (store.Master, error) {
+	master := store.Master{Host: addr, Port: c.postgresPort, NodeID: nodeID, UpdatedAt: time.Now().UTC()}
+
+	topology, err := c.crm.Topology(ctx)
+	if err != nil {
+		if c.timelineAttr != "" {
+			return master, errors.Wrap(err, "failed to read master timeline")
+		}
+
+		logger.Log("event", "topology.error", "error", err)
+		return master, nil
+	}
+
+	var node *pacemaker.Node
+	for idx := range topology.Nodes {
+		if topology.Nodes[idx].ID == nodeID {
+			node = &topology.Nodes[idx]
+			master.Node = node.Name
+		}
+	}
+
+	if c.timelineAttr == "" {
+		return master, nil
+	}
+
+	if node == nil {
+		return master, fmt.Errorf("failed to find node %s to read its timeline", nodeID)
+	}
+
+	timeline, ok := node.Attributes[c.timelineAttr]
+	if !ok {
+		return master, fmt.Errorf("node %s has no %s attribute", node.Name, c.timelineAttr)
+	}
+
+	if master.Timeline, err = strconv.ParseInt(timeline, 10, 64); err != nil {
+		return master, errors.Wrapf(err, "failed to parse timeline '%s'", timeline)
+	}
+
+	return master, nil
+}
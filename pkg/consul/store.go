@@ -0,0 +1,563 @@
+// Package consul implements our store using the Consul KV HTTP API. Leases are Consul
+// sessions that delete their keys when invalidated, watches are blocking queries, and
+// locks are session acquisitions.
+//
+// Consul retains no history, so reads at a past revision return the latest value, and
+// the revision of a key is its ModifyIndex.
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+	"github.com/pkg/errors"
+)
+
+// MinimumTTL is the shortest session TTL Consul will accept
+const MinimumTTL = 10 * time.Second
+
+// blockingWait is how long blocking queries wait for changes before returning
+var blockingWait = 5 * time.Minute
+
+type Store struct {
+	address string
+	token   string
+	prefix  string
+	client  *http.Client
+
+	mu   sync.Mutex
+	ttls map[store.LeaseID]time.Duration
+}
+
+var _ store.Store = &Store{}
+
+// NewStore connects to the Consul agent at address, such as http://127.0.0.1:8500. All
+// keys are placed beneath prefix, which serves the same purpose as the etcd namespace.
+func NewStore(address, token, prefix string) *Store {
+	if prefix != "" {
+		prefix = "/" + strings.Trim(prefix, "/")
+	}
+
+	return &Store{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		prefix:  prefix,
+		client:  &http.Client{},
+		ttls:    map[store.LeaseID]time.Duration{},
+	}
+}
+
+// kvPair is the representation of keys in the Consul API. Values are base64 encoded,
+// which encoding/json handles for us.
+type kvPair struct {
+	Key         string
+	Value       []byte
+	ModifyIndex int64
+	Session     string
+}
+
+func (s *Store) Get(ctx context.Context, key string, revision int64) (*store.KeyValue, int64, error) {
+	pairs, index, err := s.get(ctx, key, url.Values{})
+	if err != nil || len(pairs) == 0 {
+		return nil, index, err
+	}
+
+	return s.toKeyValue(pairs[0]), index, nil
+}
+
+func (s *Store) List(ctx context.Context, prefix string) ([]*store.KeyValue, error) {
+	pairs, _, err := s.get(ctx, prefix, url.Values{"recurse": {"true"}})
+	if err != nil {
+		return nil, err
+	}
+
+	kvs := make([]*store.KeyValue, 0, len(pairs))
+	for _, pair := range pairs {
+		kvs = append(kvs, s.toKeyValue(pair))
+	}
+
+	return kvs, nil
+}
+
+// Put writes the key, acquiring it with the session if a lease is given. Consul refuses
+// to acquire keys held by another session, so we unlock them first, as etcd would
+// replace the lease. Should the key change between reading and writing it, we try again.
+func (s *Store) Put(ctx context.Context, key, value string, lease store.LeaseID) error {
+	for {
+		pairs, _, err := s.get(ctx, key, url.Values{})
+		if err != nil {
+			return err
+		}
+
+		err = s.txn(ctx, append([]txnOp{s.check(key, pairs)}, s.set(key, value, lease, pairs)...)...)
+		if err != store.ErrConcurrentUpdate {
+			return err
+		}
+	}
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	return s.do(ctx, "DELETE", "/v1/kv"+s.consulKey(key), url.Values{}, nil, nil)
+}
+
+func (s *Store) CompareAndSet(ctx context.Context, key, value string, lease store.LeaseID) error {
+	pairs, _, err := s.get(ctx, key, url.Values{})
+	if err != nil {
+		return err
+	}
+
+	if len(pairs) > 0 && string(pairs[0].Value) == value {
+		if lease == store.NoLease || pairs[0].Session != "" {
+			return nil
+		}
+	}
+
+	return s.txn(ctx, append([]txnOp{s.check(key, pairs)}, s.set(key, value, lease, pairs)...)...)
+}
+
+// SetWithGeneration reads both keys, then writes in a transaction that fails should
+// either have changed since we read them.
+func (s *Store) SetWithGeneration(ctx context.Context, key, generationKey, value string, generation int64, lease store.LeaseID) error {
+	pairs, _, err := s.get(ctx, key, url.Values{})
+	if err != nil {
+		return err
+	}
+
+	generations, _, err := s.get(ctx, generationKey, url.Values{})
+	if err != nil {
+		return err
+	}
+
+	var currentGeneration int64
+	if len(generations) > 0 {
+		if currentGeneration, err = store.ParseGeneration(string(generations[0].Value)); err != nil {
+			return err
+		}
+	}
+
+	if generation < currentGeneration {
+		return store.ErrStaleGeneration
+	}
+
+	if generation == currentGeneration && len(pairs) > 0 && string(pairs[0].Value) == value {
+		if lease == store.NoLease || pairs[0].Session != "" {
+			return nil
+		}
+	}
+
+	ops := append([]txnOp{s.check(key, pairs), s.check(generationKey, generations)}, s.set(key, value, lease, pairs)...)
+	if len(generations) == 0 || generation != currentGeneration {
+		ops = append(ops, s.set(generationKey, strconv.FormatInt(generation, 10), store.NoLease, generations)...)
+	}
+
+	return s.txn(ctx, ops...)
+}
+
+// Watch uses blocking queries to wait for the key to change. Consul returns whenever the
+// index of the key advances, so we compare against what we last saw to avoid emitting
+// anything but real changes.
+func (s *Store) Watch(ctx context.Context, key string, revision int64) <-chan store.WatchResponse {
+	out := make(chan store.WatchResponse)
+
+	go func() {
+		defer close(out)
+
+		var last *kvPair // last state we saw, nil if the key was missing
+		known := false   // whether last reflects the state of the key at index
+
+		index := revision
+		if index == 0 {
+			pairs, current, err := s.get(ctx, key, url.Values{})
+			if err != nil {
+				s.sendError(ctx, out, err)
+				return
+			}
+
+			last, known, index = first(pairs), true, current
+		}
+
+		for {
+			query := url.Values{"index": {strconv.FormatInt(index, 10)}, "wait": {blockingWait.String()}}
+			pairs, current, err := s.get(ctx, key, query)
+			if err != nil {
+				s.sendError(ctx, out, err)
+				return
+			}
+
+			// Consul may reset its index, in which case we must start our queries again
+			if current < index {
+				index = 0
+				continue
+			}
+
+			pair := first(pairs)
+
+			var changed bool
+			switch {
+			case !known:
+				changed = pair == nil || pair.ModifyIndex > revision
+			case pair == nil:
+				changed = last != nil
+			default:
+				changed = last == nil || pair.ModifyIndex != last.ModifyIndex
+			}
+
+			last, known, index = pair, true, current
+			if !changed {
+				continue
+			}
+
+			kv := &store.KeyValue{Key: key, Revision: current}
+			if pair != nil {
+				kv = s.toKeyValue(*pair)
+			}
+
+			if !s.send(ctx, out, store.WatchResponse{KeyValues: []*store.KeyValue{kv}, Revision: current}) {
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Grant creates a session that deletes its keys when invalidated. Consul requires a TTL
+// of at least ten seconds, and we apply no lock delay so a new leader can immediately
+// acquire any locks we held.
+func (s *Store) Grant(ctx context.Context, ttl time.Duration) (store.LeaseID, error) {
+	if ttl < MinimumTTL {
+		ttl = MinimumTTL
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"Name":      "pgsql-cluster-manager",
+		"TTL":       ttl.String(),
+		"Behavior":  "delete",
+		"LockDelay": "0s",
+	})
+	if err != nil {
+		return store.NoLease, err
+	}
+
+	var session struct{ ID string }
+	if err := s.do(ctx, "PUT", "/v1/session/create", url.Values{}, bytes.NewReader(body), &session); err != nil {
+		return store.NoLease, errors.Wrap(err, "failed to create session")
+	}
+
+	lease := store.LeaseID(session.ID)
+
+	s.mu.Lock()
+	s.ttls[lease] = ttl
+	s.mu.Unlock()
+
+	return lease, nil
+}
+
+// KeepAlive renews the session three times per TTL, giving up once the session has
+// expired or we've failed to renew it for an entire TTL.
+func (s *Store) KeepAlive(ctx context.Context, lease store.LeaseID) (<-chan struct{}, error) {
+	s.mu.Lock()
+	ttl, ok := s.ttls[lease]
+	s.mu.Unlock()
+
+	if !ok {
+		ttl = MinimumTTL
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		renewed := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ttl / 3):
+			}
+
+			err := s.do(ctx, "PUT", "/v1/session/renew/"+string(lease), url.Values{}, nil, nil)
+			if err == nil {
+				renewed = time.Now()
+				continue
+			}
+
+			if err == errNotFound || time.Since(renewed) > ttl {
+				return
+			}
+		}
+	}()
+
+	return stopped, nil
+}
+
+func (s *Store) Revoke(ctx context.Context, lease store.LeaseID) error {
+	s.mu.Lock()
+	delete(s.ttls, lease)
+	s.mu.Unlock()
+
+	return s.do(ctx, "PUT", "/v1/session/destroy/"+string(lease), url.Values{}, nil, nil)
+}
+
+// Release unlocks the key, which Consul leaves in place without a session
+func (s *Store) Release(ctx context.Context, key string, lease store.LeaseID) error {
+	pairs, _, err := s.get(ctx, key, url.Values{})
+	if err != nil {
+		return err
+	}
+
+	if len(pairs) == 0 || pairs[0].Session != string(lease) {
+		return nil
+	}
+
+	var op txnOp
+	op.KV.Key, op.KV.Value = s.consulKey(key)[1:], pairs[0].Value
+	op.KV.Verb, op.KV.Session = "unlock", string(lease)
+
+	return s.txn(ctx, s.check(key, pairs), op)
+}
+
+func (s *Store) Locker(key string, lease store.LeaseID) store.Locker {
+	return &locker{store: s, key: key, lease: lease}
+}
+
+// locker acquires the key with our session, waiting for the holder to release it
+type locker struct {
+	store *Store
+	key   string
+	lease store.LeaseID
+}
+
+func (l *locker) Lock(ctx context.Context) error {
+	var index int64
+	for {
+		query := url.Values{"acquire": {string(l.lease)}}
+
+		var acquired bool
+		if err := l.store.do(ctx, "PUT", "/v1/kv"+l.store.consulKey(l.key), query, nil, &acquired); err != nil {
+			return err
+		}
+
+		if acquired {
+			return nil
+		}
+
+		// Block until the key changes, such as the holder releasing it
+		query = url.Values{"index": {strconv.FormatInt(index, 10)}, "wait": {blockingWait.String()}}
+		_, current, err := l.store.get(ctx, l.key, query)
+		if err != nil {
+			return err
+		}
+
+		index = current
+	}
+}
+
+func (l *locker) Unlock(ctx context.Context) error {
+	query := url.Values{"release": {string(l.lease)}}
+	return l.store.do(ctx, "PUT", "/v1/kv"+l.store.consulKey(l.key), query, nil, nil)
+}
+
+// txnOp is a KV operation within a Consul transaction
+type txnOp struct {
+	KV struct {
+		Verb    string
+		Key     string
+		Value   []byte `json:",omitempty"`
+		Index   int64  `json:",omitempty"`
+		Session string `json:",omitempty"`
+	}
+}
+
+// check ensures the key is unmodified since we read pairs, or still missing
+func (s *Store) check(key string, pairs []kvPair) txnOp {
+	var op txnOp
+	op.KV.Key = s.consulKey(key)[1:]
+	op.KV.Verb = "check-not-exists"
+	if len(pairs) > 0 {
+		op.KV.Verb, op.KV.Index = "check-index", pairs[0].ModifyIndex
+	}
+
+	return op
+}
+
+// set writes the key, which we last read as pairs. Keys held by another session must be
+// unlocked before we can lock them with ours, or write them without a session, matching
+// etcd where writes replace the lease.
+func (s *Store) set(key, value string, lease store.LeaseID, pairs []kvPair) []txnOp {
+	ops := []txnOp{}
+	if len(pairs) > 0 && pairs[0].Session != "" && pairs[0].Session != string(lease) {
+		var op txnOp
+		op.KV.Key, op.KV.Value = s.consulKey(key)[1:], []byte(value)
+		op.KV.Verb, op.KV.Session = "unlock", pairs[0].Session
+		ops = append(ops, op)
+	}
+
+	var op txnOp
+	op.KV.Key, op.KV.Value = s.consulKey(key)[1:], []byte(value)
+	op.KV.Verb = "set"
+	if lease != store.NoLease {
+		op.KV.Verb, op.KV.Session = "lock", string(lease)
+	}
+
+	return append(ops, op)
+}
+
+// txn applies the operations atomically. Consul rolls back the transaction with a 409
+// should any check fail.
+func (s *Store) txn(ctx context.Context, ops ...txnOp) error {
+	body, err := json.Marshal(ops)
+	if err != nil {
+		return err
+	}
+
+	err = s.do(ctx, "PUT", "/v1/txn", url.Values{}, bytes.NewReader(body), nil)
+	if err == errConflict {
+		return store.ErrConcurrentUpdate
+	}
+
+	return err
+}
+
+// get reads the key, or keys if recursing, returning the Consul index of the response.
+// Missing keys are returned as no pairs.
+func (s *Store) get(ctx context.Context, key string, query url.Values) ([]kvPair, int64, error) {
+	req, err := s.request(ctx, "GET", "/v1/kv"+s.consulKey(key), query, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer resp.Body.Close()
+
+	index, _ := strconv.ParseInt(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, index, nil
+	}
+
+	if err := checkResponse(resp); err != nil {
+		return nil, 0, err
+	}
+
+	var pairs []kvPair
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to decode consul response")
+	}
+
+	return pairs, index, nil
+}
+
+var (
+	errNotFound = errors.New("consul returned not found")
+	errConflict = errors.New("consul transaction rolled back")
+)
+
+// do issues a request to Consul, decoding the JSON response into result if given
+func (s *Store) do(ctx context.Context, method, path string, query url.Values, body io.Reader, result interface{}) error {
+	req, err := s.request(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(result), "failed to decode consul response")
+}
+
+func (s *Store) request(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, s.address+path+"?"+query.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.token != "" {
+		req.Header.Set("X-Consul-Token", s.token)
+	}
+
+	return req.WithContext(ctx), nil
+}
+
+func checkResponse(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return errNotFound
+	case http.StatusConflict:
+		return errConflict
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("consul returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+func (s *Store) send(ctx context.Context, out chan<- store.WatchResponse, resp store.WatchResponse) bool {
+	select {
+	case out <- resp:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *Store) sendError(ctx context.Context, out chan<- store.WatchResponse, err error) {
+	if ctx.Err() == nil {
+		s.send(ctx, out, store.WatchResponse{Err: err})
+	}
+}
+
+// consulKey places our key beneath the prefix. Consul keys are paths without a leading
+// slash, so the result begins with one ready to append to /v1/kv.
+func (s *Store) consulKey(key string) string {
+	return "/" + strings.TrimLeft(s.prefix+key, "/")
+}
+
+// storeKey reverses consulKey
+func (s *Store) storeKey(key string) string {
+	return strings.TrimPrefix("/"+key, s.prefix)
+}
+
+func (s *Store) toKeyValue(pair kvPair) *store.KeyValue {
+	return &store.KeyValue{
+		Key:      s.storeKey(pair.Key),
+		Value:    string(pair.Value),
+		Revision: pair.ModifyIndex,
+		Lease:    store.LeaseID(pair.Session),
+	}
+}
+
+func first(pairs []kvPair) *kvPair {
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	return &pairs[0]
+}
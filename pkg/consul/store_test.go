@@ -0,0 +1,522 @@
+package consul_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocardless/pgsql-cluster-manager/pkg/consul"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store/storetest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakePair struct {
+	Key         string
+	Value       []byte
+	ModifyIndex int64
+	Session     string `json:",omitempty"`
+}
+
+// fakeConsul implements just enough of the Consul KV, transaction and session APIs to
+// exercise our store. Blocking queries wait for the index to advance beyond the one
+// given, and every session behaves as if created with Behavior=delete, removing the keys
+// it holds when destroyed or expired.
+type fakeConsul struct {
+	sync.Mutex
+	index    int64
+	kvs      map[string]fakePair
+	sessions map[string]bool
+	changed  chan struct{} // closed whenever the index advances
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{
+		index:    1,
+		kvs:      map[string]fakePair{},
+		sessions: map[string]bool{},
+		changed:  make(chan struct{}),
+	}
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Blocking queries must wait without holding the lock, so they can observe writes
+	if r.Method == "GET" {
+		f.block(r)
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	switch {
+	case r.URL.Path == "/v1/txn":
+		f.txn(w, r)
+	case strings.HasPrefix(r.URL.Path, "/v1/session/"):
+		f.session(w, r)
+	case r.Method == "GET":
+		f.get(w, r)
+	case r.Method == "PUT":
+		f.put(w, r)
+	case r.Method == "DELETE":
+		f.delete(strings.TrimPrefix(r.URL.Path, "/v1/kv/"))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// block waits until the index exceeds that of the query, the wait elapses or the client
+// goes away, returning immediately for queries without an index.
+func (f *fakeConsul) block(r *http.Request) {
+	index, _ := strconv.ParseInt(r.URL.Query().Get("index"), 10, 64)
+	if index == 0 {
+		return
+	}
+
+	wait, err := time.ParseDuration(r.URL.Query().Get("wait"))
+	if err != nil {
+		wait = 5 * time.Minute
+	}
+
+	timeout := time.After(wait)
+	for {
+		f.Lock()
+		current, changed := f.index, f.changed
+		f.Unlock()
+
+		if current > index {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-timeout:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (f *fakeConsul) get(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	w.Header().Set("X-Consul-Index", strconv.FormatInt(f.index, 10))
+
+	pairs := []fakePair{}
+	for _, pair := range f.kvs {
+		if pair.Key == key || (r.URL.Query().Get("recurse") != "" && strings.HasPrefix(pair.Key, key)) {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	if len(pairs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	json.NewEncoder(w).Encode(pairs)
+}
+
+// put writes the key, honouring acquire and release like Consul: acquiring fails for
+// keys held by another session and releasing fails unless we hold the key.
+func (f *fakeConsul) put(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	body, _ := ioutil.ReadAll(r.Body)
+	pair, exists := f.kvs[key]
+
+	if session := r.URL.Query().Get("acquire"); session != "" {
+		if !f.sessions[session] {
+			http.Error(w, "invalid session "+session, http.StatusInternalServerError)
+			return
+		}
+
+		if exists && pair.Session != "" && pair.Session != session {
+			json.NewEncoder(w).Encode(false)
+			return
+		}
+
+		f.set(key, body, session)
+		json.NewEncoder(w).Encode(true)
+		return
+	}
+
+	if session := r.URL.Query().Get("release"); session != "" {
+		if !exists || pair.Session != session {
+			json.NewEncoder(w).Encode(false)
+			return
+		}
+
+		f.set(key, pair.Value, "")
+		json.NewEncoder(w).Encode(true)
+		return
+	}
+
+	f.set(key, body, pair.Session)
+	json.NewEncoder(w).Encode(true)
+}
+
+func (f *fakeConsul) session(w http.ResponseWriter, r *http.Request) {
+	switch path := strings.TrimPrefix(r.URL.Path, "/v1/session/"); {
+	case path == "create":
+		var options struct{ Behavior string }
+		Expect(json.NewDecoder(r.Body).Decode(&options)).To(Succeed())
+		Expect(options.Behavior).To(Equal("delete"))
+
+		id := fmt.Sprintf("session-%d", len(f.sessions)+1)
+		f.sessions[id] = true
+		json.NewEncoder(w).Encode(map[string]string{"ID": id})
+	case strings.HasPrefix(path, "renew/"):
+		if !f.sessions[strings.TrimPrefix(path, "renew/")] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode([]interface{}{})
+	case strings.HasPrefix(path, "destroy/"):
+		f.invalidate(strings.TrimPrefix(path, "destroy/"))
+		json.NewEncoder(w).Encode(true)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// Expire invalidates the session as if its TTL had elapsed
+func (f *fakeConsul) Expire(session string) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.invalidate(session)
+}
+
+// invalidate forgets the session, deleting the keys it holds
+func (f *fakeConsul) invalidate(session string) {
+	if !f.sessions[session] {
+		return
+	}
+
+	f.sessions[session] = false
+	for key, pair := range f.kvs {
+		if pair.Session == session {
+			f.delete(key)
+		}
+	}
+}
+
+func (f *fakeConsul) txn(w http.ResponseWriter, r *http.Request) {
+	var ops []struct {
+		KV struct {
+			Verb, Key, Session string
+			Value              []byte
+			Index              int64
+		}
+	}
+
+	Expect(json.NewDecoder(r.Body).Decode(&ops)).To(Succeed())
+
+	// Consul applies the operations in order, so track who holds each key as we go
+	holders := map[string]string{}
+	for key, pair := range f.kvs {
+		holders[key] = pair.Session
+	}
+
+	for _, op := range ops {
+		pair, exists := f.kvs[op.KV.Key]
+		holder := holders[op.KV.Key]
+		switch {
+		case op.KV.Verb == "check-not-exists" && exists,
+			op.KV.Verb == "check-index" && pair.ModifyIndex != op.KV.Index,
+			op.KV.Verb == "lock" && (!f.sessions[op.KV.Session] || (holder != "" && holder != op.KV.Session)),
+			op.KV.Verb == "unlock" && holder != op.KV.Session:
+			w.WriteHeader(http.StatusConflict)
+			return
+		case op.KV.Verb == "lock":
+			holders[op.KV.Key] = op.KV.Session
+		case op.KV.Verb == "unlock":
+			holders[op.KV.Key] = ""
+		}
+	}
+
+	for _, op := range ops {
+		switch op.KV.Verb {
+		case "set":
+			f.set(op.KV.Key, op.KV.Value, f.kvs[op.KV.Key].Session)
+		case "lock":
+			f.set(op.KV.Key, op.KV.Value, op.KV.Session)
+		case "unlock":
+			f.set(op.KV.Key, op.KV.Value, "")
+		}
+	}
+}
+
+func (f *fakeConsul) set(key string, value []byte, session string) {
+	f.kvs[key] = fakePair{Key: key, Value: value, ModifyIndex: f.advance(), Session: session}
+}
+
+func (f *fakeConsul) delete(key string) {
+	if _, exists := f.kvs[key]; exists {
+		delete(f.kvs, key)
+		f.advance()
+	}
+}
+
+// advance increments the index, waking any blocking queries
+func (f *fakeConsul) advance() int64 {
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+
+	return f.index
+}
+
+var _ = Describe("Store", func() {
+	var (
+		ctx    context.Context
+		cancel func()
+		fake   *fakeConsul
+		server *httptest.Server
+		st     *consul.Store
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		fake = newFakeConsul()
+		server = httptest.NewServer(fake)
+		st = consul.NewStore(server.URL, "", "/pgsql/")
+	})
+
+	AfterEach(func() {
+		cancel()
+		server.Close()
+	})
+
+	get := func(key string) *store.KeyValue {
+		kv, _, err := st.Get(ctx, key, 0)
+		Expect(err).NotTo(HaveOccurred())
+		return kv
+	}
+
+	It("Returns nil for missing keys", func() {
+		Expect(get("/master")).To(BeNil())
+	})
+
+	It("Places keys beneath the prefix", func() {
+		Expect(st.Put(ctx, "/master", "pg01", store.NoLease)).To(Succeed())
+
+		Expect(fake.kvs).To(HaveKey("pgsql/master"))
+		Expect(get("/master").Value).To(Equal("pg01"))
+		Expect(get("/master").Key).To(Equal("/master"))
+	})
+
+	It("Lists keys by prefix", func() {
+		Expect(st.Put(ctx, "/election/candidates/a", "pg01", store.NoLease)).To(Succeed())
+		Expect(st.Put(ctx, "/election/candidates/b", "pg02", store.NoLease)).To(Succeed())
+		Expect(st.Put(ctx, "/master", "pg01", store.NoLease)).To(Succeed())
+
+		kvs, err := st.List(ctx, "/election/candidates/")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kvs).To(HaveLen(2))
+		Expect(kvs[0].Value).To(Equal("pg01"))
+		Expect(kvs[1].Key).To(Equal("/election/candidates/b"))
+	})
+
+	Describe("CompareAndSet", func() {
+		It("Creates missing keys", func() {
+			Expect(st.CompareAndSet(ctx, "/master", "pg01", store.NoLease)).To(Succeed())
+			Expect(get("/master").Value).To(Equal("pg01"))
+		})
+
+		It("No-ops when the value is unchanged", func() {
+			Expect(st.Put(ctx, "/master", "pg01", store.NoLease)).To(Succeed())
+			initial := get("/master")
+
+			Expect(st.CompareAndSet(ctx, "/master", "pg01", store.NoLease)).To(Succeed())
+			Expect(get("/master")).To(Equal(initial))
+		})
+
+		It("Updates changed values", func() {
+			Expect(st.Put(ctx, "/master", "pg01", store.NoLease)).To(Succeed())
+			initial := get("/master")
+
+			Expect(st.CompareAndSet(ctx, "/master", "pg02", store.NoLease)).To(Succeed())
+			Expect(get("/master").Value).To(Equal("pg02"))
+			Expect(get("/master").Revision).To(BeNumerically(">", initial.Revision))
+		})
+	})
+
+	Describe("Release", func() {
+		It("Unlocks keys held by the session, leaving them in place", func() {
+			fake.set("pgsql/master", []byte("pg01"), "session")
+
+			Expect(st.Release(ctx, "/master", "session")).To(Succeed())
+			Expect(get("/master").Value).To(Equal("pg01"))
+			Expect(get("/master").Lease).To(Equal(store.NoLease))
+		})
+
+		It("Leaves keys held by other sessions", func() {
+			fake.set("pgsql/master", []byte("pg01"), "other")
+
+			Expect(st.Release(ctx, "/master", "session")).To(Succeed())
+			Expect(get("/master").Lease).To(Equal(store.LeaseID("other")))
+		})
+	})
+
+	Describe("SetWithGeneration", func() {
+		generation := func() string {
+			return get("/master-generation").Value
+		}
+
+		It("Writes the writer's generation", func() {
+			Expect(st.SetWithGeneration(ctx, "/master", "/master-generation", "pg01", 3, store.NoLease)).To(Succeed())
+			Expect(generation()).To(Equal("3"))
+		})
+
+		It("Only writes when the value or generation changes", func() {
+			Expect(st.SetWithGeneration(ctx, "/master", "/master-generation", "pg01", 3, store.NoLease)).To(Succeed())
+			initial := get("/master")
+
+			Expect(st.SetWithGeneration(ctx, "/master", "/master-generation", "pg01", 3, store.NoLease)).To(Succeed())
+			Expect(get("/master").Revision).To(Equal(initial.Revision))
+
+			Expect(st.SetWithGeneration(ctx, "/master", "/master-generation", "pg01", 4, store.NoLease)).To(Succeed())
+			Expect(get("/master").Revision).To(BeNumerically(">", initial.Revision))
+			Expect(generation()).To(Equal("4"))
+		})
+
+		It("Refuses writers with an older generation", func() {
+			Expect(st.SetWithGeneration(ctx, "/master", "/master-generation", "pg02", 4, store.NoLease)).To(Succeed())
+
+			err := st.SetWithGeneration(ctx, "/master", "/master-generation", "pg01", 3, store.NoLease)
+			Expect(err).To(Equal(store.ErrStaleGeneration))
+			Expect(get("/master").Value).To(Equal("pg02"))
+			Expect(generation()).To(Equal("4"))
+		})
+
+		It("Returns ErrConcurrentUpdate when the transaction is rolled back", func() {
+			Expect(st.Put(ctx, "/master", "pg01", store.NoLease)).To(Succeed())
+
+			// Put writes through a transaction too, so mark ourselves before interleaving it
+			var interleaved bool
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/v1/txn" && !interleaved {
+					interleaved = true
+					st.Put(ctx, "/master", "pg03", store.NoLease)
+				}
+
+				fake.ServeHTTP(w, r)
+			})
+
+			err := st.SetWithGeneration(ctx, "/master", "/master-generation", "pg02", 1, store.NoLease)
+			Expect(err).To(Equal(store.ErrConcurrentUpdate))
+			Expect(get("/master").Value).To(Equal("pg03"))
+		})
+	})
+
+	Describe("Watch", func() {
+		It("Delivers changes made after the watch started", func() {
+			Expect(st.Put(ctx, "/master", "pg01", store.NoLease)).To(Succeed())
+
+			watch := st.Watch(ctx, "/master", 0)
+
+			// Let the watch settle into its blocking query before changing the key
+			time.Sleep(50 * time.Millisecond)
+			Expect(st.Put(ctx, "/master", "pg02", store.NoLease)).To(Succeed())
+
+			var resp store.WatchResponse
+			Eventually(watch).Should(Receive(&resp))
+			Expect(resp.Err).NotTo(HaveOccurred())
+			Expect(resp.KeyValues[0].Value).To(Equal("pg02"))
+		})
+	})
+
+	Describe("Locker", func() {
+		var first, second store.LeaseID
+
+		BeforeEach(func() {
+			var err error
+
+			first, err = st.Grant(ctx, consul.MinimumTTL)
+			Expect(err).NotTo(HaveOccurred())
+
+			second, err = st.Grant(ctx, consul.MinimumTTL)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(st.Locker("/lock", first).Lock(ctx)).To(Succeed())
+		})
+
+		lock := func(lease store.LeaseID) <-chan error {
+			locked := make(chan error, 1)
+			go func() { locked <- st.Locker("/lock", lease).Lock(ctx) }()
+
+			return locked
+		}
+
+		It("Blocks a second holder until the first unlocks", func() {
+			locked := lock(second)
+			Consistently(locked, 100*time.Millisecond).ShouldNot(Receive())
+
+			Expect(st.Locker("/lock", first).Unlock(ctx)).To(Succeed())
+			Eventually(locked).Should(Receive(BeNil()))
+			Expect(get("/lock").Lease).To(Equal(second))
+		})
+
+		It("Blocks a second holder until the first session is destroyed", func() {
+			locked := lock(second)
+			Consistently(locked, 100*time.Millisecond).ShouldNot(Receive())
+
+			Expect(st.Revoke(ctx, first)).To(Succeed())
+			Eventually(locked).Should(Receive(BeNil()))
+			Expect(get("/lock").Lease).To(Equal(second))
+		})
+	})
+
+	Describe("Sessions", func() {
+		var lease store.LeaseID
+
+		BeforeEach(func() {
+			var err error
+
+			lease, err = st.Grant(ctx, consul.MinimumTTL)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(st.Put(ctx, "/master", "pg01", lease)).To(Succeed())
+			Expect(st.Put(ctx, "/other", "pg02", store.NoLease)).To(Succeed())
+		})
+
+		It("Takes over keys held by another session", func() {
+			other, err := st.Grant(ctx, consul.MinimumTTL)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(st.Put(ctx, "/master", "pg03", other)).To(Succeed())
+			Expect(get("/master").Value).To(Equal("pg03"))
+			Expect(get("/master").Lease).To(Equal(other))
+
+			Expect(st.Revoke(ctx, lease)).To(Succeed())
+			Expect(get("/master").Value).To(Equal("pg03"))
+		})
+
+		It("Removes keys held by the session when revoked", func() {
+			Expect(st.Revoke(ctx, lease)).To(Succeed())
+			Expect(get("/master")).To(BeNil())
+			Expect(get("/other").Value).To(Equal("pg02"))
+		})
+
+		It("Removes keys held by the session when it expires", func() {
+			fake.Expire(string(lease))
+
+			Expect(get("/master")).To(BeNil())
+			Expect(get("/other").Value).To(Equal("pg02"))
+		})
+	})
+
+	storetest.Conformance(func() store.Store { return st })
+})
@@ -0,0 +1,76 @@
+package integration
+
+import (
+	"context"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/etcd"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lead", func() {
+	var (
+		ctx    context.Context
+		cancel func()
+		key    string
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), 20*time.Second)
+		key = RandomKey()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// campaign runs a candidate that records when it leads, resigning once its context is
+	// cancelled.
+	campaign := func(ctx context.Context, opt store.ElectionOptions, leading chan<- string) {
+		go store.Lead(ctx, kitlog.NewNopLogger(), etcd.NewStore(client), opt,
+			func(ctx context.Context, _ store.LeaseID) error {
+				leading <- opt.Candidate
+				<-ctx.Done()
+				return nil
+			},
+		)
+	}
+
+	It("Elects a single leader, replacing it once it stops", func() {
+		leading := make(chan string, 2)
+		firstCtx, stopFirst := context.WithCancel(ctx)
+		defer stopFirst()
+
+		campaign(firstCtx, store.ElectionOptions{Key: key, Candidate: "first", TTL: 5 * time.Second}, leading)
+		Eventually(leading).Should(Receive(Equal("first")))
+
+		campaign(ctx, store.ElectionOptions{Key: key, Candidate: "second", TTL: 5 * time.Second}, leading)
+		Consistently(leading).ShouldNot(Receive())
+
+		stopFirst()
+		Eventually(leading, 5*time.Second).Should(Receive(Equal("second")))
+	})
+
+	It("Hands over to the preferred candidate", func() {
+		leading := make(chan string, 2)
+		preferred := func(context.Context) (string, error) { return "dc", nil }
+
+		campaign(ctx, store.ElectionOptions{
+			Key: key, Candidate: "other", TTL: 5 * time.Second, Preferred: preferred, Delay: 100 * time.Millisecond,
+		}, leading)
+		Eventually(leading).Should(Receive(Equal("other")))
+
+		campaign(ctx, store.ElectionOptions{
+			Key: key, Candidate: "dc", TTL: 5 * time.Second, Preferred: preferred, Delay: 100 * time.Millisecond,
+		}, leading)
+		Eventually(leading, 5*time.Second).Should(Receive(Equal("dc")))
+
+		candidates, err := store.Candidates(ctx, etcd.NewStore(client), key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(candidates).To(ContainElement("dc"))
+	})
+})
@@ -0,0 +1,111 @@
+package integration
+
+import (
+	"context"
+	"time"
+
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/etcd"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SetWithGeneration", func() {
+	var (
+		ctx           context.Context
+		cancel        func()
+		key           string
+		generationKey string
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		key = RandomKey()
+		generationKey = key + "-generation"
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	update := func(value string, generation int64) error {
+		return etcd.NewStore(client).SetWithGeneration(ctx, key, generationKey, value, generation, store.NoLease)
+	}
+
+	generation := func() int64 {
+		resp, err := client.Get(ctx, key)
+		Expect(err).NotTo(HaveOccurred())
+
+		generation, err := store.Generation(ctx, etcd.NewStore(client), generationKey, resp.Kvs[0].ModRevision)
+		Expect(err).NotTo(HaveOccurred())
+
+		return generation
+	}
+
+	It("Writes the writer's generation with the value", func() {
+		Expect(update("10.0.0.1", 3)).To(Succeed())
+		Expect(generation()).To(Equal(int64(3)))
+
+		Expect(update("10.0.0.2", 4)).To(Succeed())
+		Expect(generation()).To(Equal(int64(4)))
+	})
+
+	It("Refuses writers with an older generation", func() {
+		Expect(update("10.0.0.2", 4)).To(Succeed())
+		Expect(update("10.0.0.1", 3)).To(Equal(store.ErrStaleGeneration))
+
+		resp, err := client.Get(ctx, key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(resp.Kvs[0].Value)).To(Equal("10.0.0.2"))
+	})
+})
+
+var _ = Describe("GenerationFilter", func() {
+	var (
+		ctx           context.Context
+		cancel        func()
+		key           string
+		generationKey string
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		key = RandomKey()
+		generationKey = key + "-generation"
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	put := func(value, generation string) *mvccpb.KeyValue {
+		_, err := client.Put(ctx, generationKey, generation)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.Put(ctx, key, value)
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := client.Get(ctx, key)
+		Expect(err).NotTo(HaveOccurred())
+
+		return resp.Kvs[0]
+	}
+
+	It("Drops values with an older generation", func() {
+		in := make(chan *mvccpb.KeyValue, 3)
+		in <- put("10.0.0.1", "10")
+		in <- put("10.0.0.2", "5")
+		in <- put("10.0.0.3", "11")
+		close(in)
+
+		values := []string{}
+		for kv := range store.GenerationFilter(ctx, kitlog.NewNopLogger(), etcd.NewStore(client), key, generationKey, time.Second, in) {
+			values = append(values, string(kv.Value))
+		}
+
+		Expect(values).To(Equal([]string{"10.0.0.1", "10.0.0.3"}))
+	})
+})
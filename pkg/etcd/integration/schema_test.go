@@ -0,0 +1,153 @@
+package integration
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/etcd"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Schema", func() {
+	var (
+		ctx    context.Context
+		cancel func()
+		st     store.Store
+		prefix string
+		keys   store.Keys
+	)
+
+	// keysUnder generates a key layout beneath a random prefix, standing in for a namespace
+	keysUnder := func(prefix string) store.Keys {
+		return store.Keys{
+			Master:     prefix + "/master",
+			Generation: prefix + "/master-generation",
+			Topology:   prefix + "/topology",
+			Restart:    prefix + "/rolling-restart",
+			Election:   prefix + "/supervise-election",
+			Schema:     prefix + "/schema-version",
+		}
+	}
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		st = etcd.NewStore(client)
+		prefix = RandomKey()
+		keys = keysUnder(prefix)
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	put := func(key, value string) {
+		Expect(st.Put(ctx, key, value, store.NoLease)).To(Succeed())
+	}
+
+	get := func(key string) string {
+		kv, _, err := st.Get(ctx, key, 0)
+		Expect(err).NotTo(HaveOccurred())
+		if kv == nil {
+			return ""
+		}
+
+		return kv.Value
+	}
+
+	Describe("DumpKeys and RestoreKeys", func() {
+		BeforeEach(func() {
+			put(keys.Schema, "1")
+			put(keys.Master, "172.17.0.2")
+			put(keys.Generation, "10")
+			put(keys.Topology, `{"quorate":true}`)
+			put(keys.Lock()+"/694d6", "")
+			put(keys.Election+"/candidates/694d6", "pg01")
+		})
+
+		It("Dumps every key we own", func() {
+			dump, err := store.DumpKeys(ctx, st, keys)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(dump.Version).To(Equal(1))
+			Expect(dump.Keys).To(HaveLen(6))
+			Expect(dump.Keys).To(ContainElement(store.DumpedKV{Key: keys.Master, Value: "172.17.0.2"}))
+		})
+
+		It("Restores all but locks and election keys into another namespace", func() {
+			dump, err := store.DumpKeys(ctx, st, keys)
+			Expect(err).NotTo(HaveOccurred())
+
+			targetPrefix := RandomKey()
+			target := keysUnder(targetPrefix)
+			for idx, kv := range dump.Keys {
+				dump.Keys[idx].Key = targetPrefix + strings.TrimPrefix(kv.Key, prefix)
+			}
+
+			Expect(store.RestoreKeys(ctx, kitlog.NewNopLogger(), st, target, dump, false)).To(Succeed())
+
+			Expect(get(target.Master)).To(Equal("172.17.0.2"))
+			Expect(get(target.Generation)).To(Equal("10"))
+			Expect(get(target.Schema)).To(Equal("1"))
+			Expect(get(target.Election + "/candidates/694d6")).To(BeEmpty())
+
+			restored, err := store.DumpKeys(ctx, st, target)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored.Keys).To(HaveLen(4))
+		})
+
+		It("Refuses to overwrite existing keys", func() {
+			dump, err := store.DumpKeys(ctx, st, keys)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = store.RestoreKeys(ctx, kitlog.NewNopLogger(), st, keys, dump, false)
+			Expect(err).To(MatchError(ContainSubstring("refusing to overwrite existing key")))
+			Expect(store.RestoreKeys(ctx, kitlog.NewNopLogger(), st, keys, dump, true)).To(Succeed())
+		})
+
+		It("Refuses dumps from a newer schema", func() {
+			dump := &store.Dump{Version: store.SchemaVersion + 1}
+			err := store.RestoreKeys(ctx, kitlog.NewNopLogger(), st, keys, dump, false)
+			Expect(err).To(Equal(store.NewerSchemaError(store.SchemaVersion + 1)))
+		})
+	})
+
+	Describe("ReadSchemaVersion", func() {
+		It("Reports the current version for empty stores", func() {
+			Expect(store.ReadSchemaVersion(ctx, st, keys)).To(Equal(store.SchemaVersion))
+		})
+
+		It("Reports version zero for unversioned stores", func() {
+			put(keys.Master, "172.17.0.2")
+			Expect(store.ReadSchemaVersion(ctx, st, keys)).To(Equal(0))
+		})
+	})
+
+	Describe("CheckSchemaVersion", func() {
+		It("Records our version in empty stores", func() {
+			Expect(store.CheckSchemaVersion(ctx, kitlog.NewNopLogger(), st, keys)).To(Succeed())
+			Expect(get(keys.Schema)).To(Equal("1"))
+		})
+
+		It("Rejects newer versions", func() {
+			put(keys.Schema, "99")
+			Expect(store.CheckSchemaVersion(ctx, kitlog.NewNopLogger(), st, keys)).To(
+				Equal(store.NewerSchemaError(99)),
+			)
+		})
+	})
+
+	Describe("Migrate", func() {
+		It("Upgrades unversioned stores to the current version", func() {
+			put(keys.Master, "172.17.0.2")
+
+			Expect(store.Migrate(ctx, kitlog.NewNopLogger(), st, keys)).To(Succeed())
+			Expect(get(keys.Schema)).To(Equal("1"))
+			Expect(get(keys.Master)).To(Equal("172.17.0.2"))
+		})
+	})
+})
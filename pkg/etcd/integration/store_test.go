@@ -0,0 +1,125 @@
+package integration
+
+import (
+	"context"
+	"time"
+
+	"github.com/gocardless/pgsql-cluster-manager/pkg/etcd"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store/storetest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	"github.com/onsi/gomega/types"
+)
+
+var _ = Describe("CompareAndSet", func() {
+	var (
+		ctx    context.Context
+		cancel func()
+		key    string
+		st     store.Store
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		key = RandomKey()
+		st = etcd.NewStore(client)
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	compareAndSet := func(value string) error {
+		return st.CompareAndSet(ctx, key, value, store.NoLease)
+	}
+
+	get := func() *store.KeyValue {
+		kv, _, err := st.Get(ctx, key, 0)
+		Expect(err).NotTo(HaveOccurred())
+		return kv
+	}
+
+	matchValueRevision := func(value string, revision types.GomegaMatcher) types.GomegaMatcher {
+		return PointTo(
+			MatchFields(IgnoreExtras, Fields{
+				"Value":    Equal(value),
+				"Revision": revision,
+			}),
+		)
+	}
+
+	Context("When key does not exist", func() {
+		It("Creates key", func() {
+			Expect(compareAndSet("initial")).To(Succeed())
+			Expect(get()).To(matchValueRevision("initial", BeNumerically(">", 0)))
+		})
+	})
+
+	Context("When key exists", func() {
+		var (
+			initial *store.KeyValue
+		)
+
+		BeforeEach(func() {
+			Expect(st.Put(ctx, key, "initial", store.NoLease)).To(Succeed())
+			initial = get()
+		})
+
+		Context("With same value", func() {
+			It("No-ops update", func() {
+				Expect(compareAndSet(initial.Value)).To(Succeed())
+				Expect(get()).To(Equal(initial))
+			})
+		})
+
+		Context("With different value", func() {
+			It("Performs update", func() {
+				Expect(compareAndSet("changed")).To(Succeed())
+				Expect(get()).To(matchValueRevision(
+					"changed", BeNumerically(">", initial.Revision),
+				))
+			})
+		})
+	})
+
+	Context("With lease", func() {
+		var (
+			lease store.LeaseID
+		)
+
+		BeforeEach(func() {
+			var err error
+			lease, err = st.Grant(ctx, 5*time.Second)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Attaches lease to unleased keys of the same value", func() {
+			Expect(st.Put(ctx, key, "initial", store.NoLease)).To(Succeed())
+
+			Expect(st.CompareAndSet(ctx, key, "initial", lease)).To(Succeed())
+			Expect(get().Lease).To(Equal(lease))
+		})
+
+		It("Removes key when lease is revoked", func() {
+			Expect(st.CompareAndSet(ctx, key, "initial", lease)).To(Succeed())
+			Expect(st.Revoke(ctx, lease)).To(Succeed())
+			Expect(get()).To(BeNil())
+		})
+
+		It("Keeps key released from the lease when it is revoked", func() {
+			Expect(st.CompareAndSet(ctx, key, "initial", lease)).To(Succeed())
+			Expect(st.Release(ctx, key, lease)).To(Succeed())
+			Expect(st.Revoke(ctx, lease)).To(Succeed())
+
+			Expect(get().Value).To(Equal("initial"))
+			Expect(get().Lease).To(Equal(store.NoLease))
+		})
+	})
+})
+
+var _ = Describe("Store", func() {
+	storetest.Conformance(func() store.Store { return etcd.NewStore(client) })
+})
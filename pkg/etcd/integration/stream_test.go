@@ -6,6 +6,7 @@ import (
 
 	"github.com/coreos/etcd/mvcc/mvccpb"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/etcd"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
 
 	kitlog "github.com/go-kit/kit/log"
 
@@ -32,10 +33,10 @@ var _ = Describe("Stream", func() {
 	})
 
 	createStream := func() <-chan *mvccpb.KeyValue {
-		stream, _ := etcd.NewStream(
+		stream, _ := store.NewStream(
 			kitlog.NewLogfmtLogger(GinkgoWriter),
-			client,
-			etcd.StreamOptions{
+			etcd.NewStore(client),
+			store.StreamOptions{
 				Ctx:          ctx,
 				Keys:         []string{key},
 				PollInterval: time.Second,
@@ -82,5 +83,27 @@ var _ = Describe("Stream", func() {
 			put(key, "changed")
 			Eventually(stream).Should(Receive(matchKv(key, "changed")))
 		})
+
+		It("Ignores changes to other keys", func() {
+			stream := createStream()
+			Eventually(stream).Should(Receive(matchKv(key, "initial")))
+
+			put(key+"-other", "other")
+			Consistently(stream, 500*time.Millisecond).ShouldNot(Receive(matchKv(key+"-other", "other")))
+		})
+
+		It("Re-reads the current value once its revision is compacted", func() {
+			stream := createStream()
+			Eventually(stream).Should(Receive(matchKv(key, "initial")))
+
+			put(key, "changed")
+			resp, err := client.Get(ctx, key)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.Compact(ctx, resp.Header.Revision)
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(stream).Should(Receive(matchKv(key, "changed")))
+		})
 	})
 })
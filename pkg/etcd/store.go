@@ -0,0 +1,293 @@
+// Package etcd implements our store using etcd v3, which supports everything we require
+// natively. Lease comparisons require etcd >= 3.3.
+package etcd
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+)
+
+type Store struct {
+	client *clientv3.Client
+}
+
+var _ store.Store = &Store{}
+
+// NewStore wraps the given client, which should already be namespaced if required
+func NewStore(client *clientv3.Client) *Store {
+	return &Store{client: client}
+}
+
+func (s *Store) Get(ctx context.Context, key string, revision int64) (*store.KeyValue, int64, error) {
+	opts := []clientv3.OpOption{}
+	if revision > 0 {
+		opts = append(opts, clientv3.WithRev(revision))
+	}
+
+	resp, err := s.client.Get(ctx, key, opts...)
+	if err != nil {
+		return nil, 0, toStoreError(err)
+	}
+
+	if len(resp.Kvs) == 0 {
+		return nil, resp.Header.GetRevision(), nil
+	}
+
+	return toKeyValue(resp.Kvs[0]), resp.Header.GetRevision(), nil
+}
+
+func (s *Store) List(ctx context.Context, prefix string) ([]*store.KeyValue, error) {
+	resp, err := s.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, toStoreError(err)
+	}
+
+	kvs := make([]*store.KeyValue, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs = append(kvs, toKeyValue(kv))
+	}
+
+	return kvs, nil
+}
+
+func (s *Store) Put(ctx context.Context, key, value string, lease store.LeaseID) error {
+	_, err := s.client.Put(ctx, key, value, withLease(lease)...)
+	return err
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	_, err := s.client.Delete(ctx, key)
+	return err
+}
+
+func (s *Store) CompareAndSet(ctx context.Context, key, value string, lease store.LeaseID) error {
+	conditions := []clientv3.Cmp{clientv3.Compare(clientv3.Value(key), "=", value)}
+	if lease != store.NoLease {
+		conditions = append(conditions, clientv3.Compare(clientv3.LeaseValue(key), "!=", clientv3.NoLease))
+	}
+
+	_, err := s.client.Txn(ctx).
+		If(conditions...).
+		Else(clientv3.OpPut(key, value, withLease(lease)...)).
+		Commit()
+
+	return err
+}
+
+// SetWithGeneration reads both keys, then writes in a transaction that fails should
+// either have changed since we read them.
+func (s *Store) SetWithGeneration(ctx context.Context, key, generationKey, value string, generation int64, lease store.LeaseID) error {
+	resp, err := s.client.Txn(ctx).Then(clientv3.OpGet(key), clientv3.OpGet(generationKey)).Commit()
+	if err != nil {
+		return err
+	}
+
+	current := resp.Responses[0].GetResponseRange().GetKvs()
+	generations := resp.Responses[1].GetResponseRange().GetKvs()
+
+	var modRevision, generationModRevision, currentGeneration int64
+	if len(current) > 0 {
+		modRevision = current[0].ModRevision
+	}
+	if len(generations) > 0 {
+		generationModRevision = generations[0].ModRevision
+		if currentGeneration, err = store.ParseGeneration(string(generations[0].Value)); err != nil {
+			return err
+		}
+	}
+
+	if generation < currentGeneration {
+		return store.ErrStaleGeneration
+	}
+
+	if generation == currentGeneration && len(current) > 0 && string(current[0].Value) == value {
+		if lease == store.NoLease || current[0].Lease != int64(clientv3.NoLease) {
+			return nil
+		}
+	}
+
+	ops := []clientv3.Op{clientv3.OpPut(key, value, withLease(lease)...)}
+	if len(generations) == 0 || generation != currentGeneration {
+		ops = append(ops, clientv3.OpPut(generationKey, strconv.FormatInt(generation, 10)))
+	}
+
+	txn, err := s.client.Txn(ctx).
+		If(
+			clientv3.Compare(clientv3.ModRevision(key), "=", modRevision),
+			clientv3.Compare(clientv3.ModRevision(generationKey), "=", generationModRevision),
+		).
+		Then(ops...).
+		Commit()
+
+	if err != nil {
+		return err
+	}
+
+	if !txn.Succeeded {
+		return store.ErrConcurrentUpdate
+	}
+
+	return nil
+}
+
+func (s *Store) Watch(ctx context.Context, key string, revision int64) <-chan store.WatchResponse {
+	out := make(chan store.WatchResponse)
+
+	opts := []clientv3.OpOption{}
+	if revision > 0 {
+		opts = append(opts, clientv3.WithRev(revision+1))
+	}
+
+	go func() {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		defer close(out)
+
+		// Requiring a leader ensures partitioned etcd members cancel our watch, rather than
+		// leaving us watching a node that will never see changes.
+		for resp := range s.client.Watch(clientv3.WithRequireLeader(ctx), key, opts...) {
+			response := store.WatchResponse{Revision: resp.Header.GetRevision()}
+			if err := resp.Err(); err != nil {
+				response.Err = toStoreError(err)
+			}
+
+			for _, event := range resp.Events {
+				response.KeyValues = append(response.KeyValues, toKeyValue(event.Kv))
+			}
+
+			select {
+			case out <- response:
+			case <-ctx.Done():
+				return
+			}
+
+			if response.Err != nil {
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+func (s *Store) Grant(ctx context.Context, ttl time.Duration) (store.LeaseID, error) {
+	resp, err := s.client.Grant(ctx, int64(ttl.Seconds()))
+	if err != nil {
+		return store.NoLease, err
+	}
+
+	return toLeaseID(resp.ID), nil
+}
+
+func (s *Store) KeepAlive(ctx context.Context, lease store.LeaseID) (<-chan struct{}, error) {
+	keepAlives, err := s.client.KeepAlive(ctx, fromLeaseID(lease))
+	if err != nil {
+		return nil, err
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		for range keepAlives {
+			// Drain responses, as the client will log warnings if the channel is full
+		}
+
+		close(stopped)
+	}()
+
+	return stopped, nil
+}
+
+func (s *Store) Revoke(ctx context.Context, lease store.LeaseID) error {
+	_, err := s.client.Revoke(ctx, fromLeaseID(lease))
+	return err
+}
+
+// Release rewrites the key without a lease, provided it's still attached to ours
+func (s *Store) Release(ctx context.Context, key string, lease store.LeaseID) error {
+	_, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.LeaseValue(key), "=", fromLeaseID(lease))).
+		Then(clientv3.OpPut(key, "", clientv3.WithIgnoreValue())).
+		Commit()
+
+	return err
+}
+
+func (s *Store) Locker(key string, lease store.LeaseID) store.Locker {
+	return &locker{client: s.client, key: key, lease: fromLeaseID(lease)}
+}
+
+// locker wraps the etcd mutex, which requires a session. We create the session from our
+// existing lease, orphaning it once we're done so the lease outlives the mutex.
+type locker struct {
+	client  *clientv3.Client
+	key     string
+	lease   clientv3.LeaseID
+	session *concurrency.Session
+	mutex   *concurrency.Mutex
+}
+
+func (l *locker) Lock(ctx context.Context) error {
+	session, err := concurrency.NewSession(l.client, concurrency.WithLease(l.lease))
+	if err != nil {
+		return err
+	}
+
+	mutex := concurrency.NewMutex(session, l.key)
+	if err := mutex.Lock(ctx); err != nil {
+		session.Orphan()
+		return err
+	}
+
+	l.session, l.mutex = session, mutex
+	return nil
+}
+
+func (l *locker) Unlock(ctx context.Context) error {
+	defer l.session.Orphan()
+	return l.mutex.Unlock(ctx)
+}
+
+func withLease(lease store.LeaseID) []clientv3.OpOption {
+	if lease == store.NoLease {
+		return nil
+	}
+
+	return []clientv3.OpOption{clientv3.WithLease(fromLeaseID(lease))}
+}
+
+func toLeaseID(id clientv3.LeaseID) store.LeaseID {
+	if id == clientv3.NoLease {
+		return store.NoLease
+	}
+
+	return store.LeaseID(strconv.FormatInt(int64(id), 16))
+}
+
+func fromLeaseID(lease store.LeaseID) clientv3.LeaseID {
+	id, _ := strconv.ParseInt(string(lease), 16, 64)
+	return clientv3.LeaseID(id)
+}
+
+func toKeyValue(kv *mvccpb.KeyValue) *store.KeyValue {
+	return &store.KeyValue{
+		Key:      string(kv.Key),
+		Value:    string(kv.Value),
+		Revision: kv.ModRevision,
+		Lease:    toLeaseID(clientv3.LeaseID(kv.Lease)),
+	}
+}
+
+func toStoreError(err error) error {
+	if err == rpctypes.ErrCompacted {
+		return store.ErrCompacted
+	}
+
+	return err
+}
@@ -8,45 +8,46 @@ import (
 	"sync"
 	"time"
 
-	"github.com/coreos/etcd/clientv3"
 	kitlog "github.com/go-kit/kit/log"
-	"github.com/gocardless/pgsql-cluster-manager/pkg/etcd"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/streams"
 	"github.com/pkg/errors"
 )
 
 type FailoverOptions struct {
 	EtcdHostKey        string
+	EtcdGenerationKey  string
+	EtcdTopologyKey    string
+	EtcdRestartKey     string
 	HealthCheckTimeout time.Duration
 	LockTimeout        time.Duration
 	PauseTimeout       time.Duration
 	PauseExpiry        time.Duration
 	ResumeTimeout      time.Duration
 	PacemakerTimeout   time.Duration
+	RestartTimeout     time.Duration
+	MigrationLifetime  time.Duration
+	SettleTimeout      time.Duration
+	Force              bool
 }
 
 type Failover struct {
 	logger  kitlog.Logger
-	client  etcdGetter
+	store   store.Store
 	clients map[string]FailoverClient
 	locker  locker
 	opt     FailoverOptions
 }
 
-type etcdGetter interface {
-	Get(context.Context, string, ...clientv3.OpOption) (*clientv3.GetResponse, error)
-	Watch(context.Context, string, ...clientv3.OpOption) clientv3.WatchChan
-}
-
 type locker interface {
 	Lock(context.Context) error
 	Unlock(context.Context) error
 }
 
-func NewFailover(logger kitlog.Logger, client etcdGetter, clients map[string]FailoverClient, locker locker, opt FailoverOptions) *Failover {
+func NewFailover(logger kitlog.Logger, store store.Store, clients map[string]FailoverClient, locker locker, opt FailoverOptions) *Failover {
 	return &Failover{
 		logger:  logger,
-		client:  client,
+		store:   store,
 		clients: clients,
 		locker:  locker,
 		opt:     opt,
@@ -188,7 +189,10 @@ func (f *Failover) Migrate(ctx context.Context) error {
 	migrateCtx, cancel := context.WithTimeout(ctx, f.opt.PacemakerTimeout)
 	defer cancel()
 
-	resp, err := client.Migrate(migrateCtx, &Empty{})
+	resp, err := client.Migrate(migrateCtx, &MigrateRequest{
+		Force:    f.opt.Force,
+		Lifetime: int32(f.opt.MigrationLifetime / time.Second),
+	})
 	if err != nil {
 		logger.Log("error", err.Error(),
 			"msg", "failed to migrate, manual inspection of cluster state is recommended")
@@ -230,10 +234,10 @@ func (f *Failover) NotifyWhenMaster(ctx context.Context, logger kitlog.Logger, t
 	logger = kitlog.With(logger, "key", f.opt.EtcdHostKey, "target", targetAddr)
 	logger.Log("msg", "waiting for etcd to update with master key")
 
-	kvs, _ := etcd.NewStream(
+	kvs, _ := store.NewStream(
 		f.logger,
-		f.client,
-		etcd.StreamOptions{
+		f.store,
+		store.StreamOptions{
 			Ctx:          ctx,
 			Keys:         []string{f.opt.EtcdHostKey},
 			PollInterval: time.Second,
@@ -242,13 +246,28 @@ func (f *Failover) NotifyWhenMaster(ctx context.Context, logger kitlog.Logger, t
 	)
 
 	kvs = streams.RevisionFilter(f.logger, kvs)
+	if f.opt.EtcdGenerationKey != "" {
+		kvs = store.GenerationFilter(ctx, f.logger, f.store, f.opt.EtcdHostKey, f.opt.EtcdGenerationKey, time.Second, kvs)
+	}
 
 	notify := make(chan interface{})
 	go func() {
 		for kv := range kvs {
-			if string(kv.Key) == f.opt.EtcdHostKey && string(kv.Value) == targetAddr {
+			if string(kv.Key) != f.opt.EtcdHostKey || len(kv.Value) == 0 {
+				continue
+			}
+
+			master, err := store.ParseMaster(string(kv.Value))
+			if err != nil {
+				logger.Log("event", "master.parse_error", "error", err)
+				continue
+			}
+
+			// The master may be republished many times, but we only notify once
+			if master.Host == targetAddr {
 				notify <- struct{}{}
 				close(notify)
+				return
 			}
 		}
 	}()
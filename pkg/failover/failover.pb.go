@@ -15,6 +15,17 @@ It has these top-level messages:
 	ResumeResponse
 	MigrateResponse
 	UnmigrateResponse
+	NodeRequest
+	StandbyResponse
+	UnstandbyResponse
+	RestartResponse
+	MigrateRequest
+	Constraint
+	ConstraintsResponse
+	FailCount
+	FailedAction
+	FailuresResponse
+	CleanupResponse
 */
 package failover
 
@@ -201,6 +212,342 @@ func (m *UnmigrateResponse) GetCreatedAt() *google_protobuf.Timestamp {
 	return nil
 }
 
+type NodeRequest struct {
+	Node string `protobuf:"bytes,1,opt,name=node" json:"node,omitempty"`
+}
+
+func (m *NodeRequest) Reset()                    { *m = NodeRequest{} }
+func (m *NodeRequest) String() string            { return proto.CompactTextString(m) }
+func (*NodeRequest) ProtoMessage()               {}
+func (*NodeRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *NodeRequest) GetNode() string {
+	if m != nil {
+		return m.Node
+	}
+	return ""
+}
+
+type StandbyResponse struct {
+	Role      string                     `protobuf:"bytes,1,opt,name=role" json:"role,omitempty"`
+	CreatedAt *google_protobuf.Timestamp `protobuf:"bytes,2,opt,name=created_at,json=createdAt" json:"created_at,omitempty"`
+}
+
+func (m *StandbyResponse) Reset()                    { *m = StandbyResponse{} }
+func (m *StandbyResponse) String() string            { return proto.CompactTextString(m) }
+func (*StandbyResponse) ProtoMessage()               {}
+func (*StandbyResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *StandbyResponse) GetRole() string {
+	if m != nil {
+		return m.Role
+	}
+	return ""
+}
+
+func (m *StandbyResponse) GetCreatedAt() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return nil
+}
+
+type UnstandbyResponse struct {
+	CreatedAt *google_protobuf.Timestamp `protobuf:"bytes,1,opt,name=created_at,json=createdAt" json:"created_at,omitempty"`
+}
+
+func (m *UnstandbyResponse) Reset()                    { *m = UnstandbyResponse{} }
+func (m *UnstandbyResponse) String() string            { return proto.CompactTextString(m) }
+func (*UnstandbyResponse) ProtoMessage()               {}
+func (*UnstandbyResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *UnstandbyResponse) GetCreatedAt() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return nil
+}
+
+type RestartResponse struct {
+	CreatedAt *google_protobuf.Timestamp `protobuf:"bytes,1,opt,name=created_at,json=createdAt" json:"created_at,omitempty"`
+}
+
+func (m *RestartResponse) Reset()                    { *m = RestartResponse{} }
+func (m *RestartResponse) String() string            { return proto.CompactTextString(m) }
+func (*RestartResponse) ProtoMessage()               {}
+func (*RestartResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{10} }
+
+func (m *RestartResponse) GetCreatedAt() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return nil
+}
+
+type MigrateRequest struct {
+	Force    bool  `protobuf:"varint,1,opt,name=force" json:"force,omitempty"`
+	Lifetime int32 `protobuf:"varint,2,opt,name=lifetime" json:"lifetime,omitempty"`
+}
+
+func (m *MigrateRequest) Reset()                    { *m = MigrateRequest{} }
+func (m *MigrateRequest) String() string            { return proto.CompactTextString(m) }
+func (*MigrateRequest) ProtoMessage()               {}
+func (*MigrateRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{11} }
+
+func (m *MigrateRequest) GetForce() bool {
+	if m != nil {
+		return m.Force
+	}
+	return false
+}
+
+func (m *MigrateRequest) GetLifetime() int32 {
+	if m != nil {
+		return m.Lifetime
+	}
+	return 0
+}
+
+type Constraint struct {
+	Id       string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Resource string `protobuf:"bytes,2,opt,name=resource" json:"resource,omitempty"`
+	Node     string `protobuf:"bytes,3,opt,name=node" json:"node,omitempty"`
+	Role     string `protobuf:"bytes,4,opt,name=role" json:"role,omitempty"`
+	Score    string `protobuf:"bytes,5,opt,name=score" json:"score,omitempty"`
+	Expires  string `protobuf:"bytes,6,opt,name=expires" json:"expires,omitempty"`
+}
+
+func (m *Constraint) Reset()                    { *m = Constraint{} }
+func (m *Constraint) String() string            { return proto.CompactTextString(m) }
+func (*Constraint) ProtoMessage()               {}
+func (*Constraint) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{12} }
+
+func (m *Constraint) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Constraint) GetResource() string {
+	if m != nil {
+		return m.Resource
+	}
+	return ""
+}
+
+func (m *Constraint) GetNode() string {
+	if m != nil {
+		return m.Node
+	}
+	return ""
+}
+
+func (m *Constraint) GetRole() string {
+	if m != nil {
+		return m.Role
+	}
+	return ""
+}
+
+func (m *Constraint) GetScore() string {
+	if m != nil {
+		return m.Score
+	}
+	return ""
+}
+
+func (m *Constraint) GetExpires() string {
+	if m != nil {
+		return m.Expires
+	}
+	return ""
+}
+
+type ConstraintsResponse struct {
+	Constraints []*Constraint              `protobuf:"bytes,1,rep,name=constraints" json:"constraints,omitempty"`
+	CreatedAt   *google_protobuf.Timestamp `protobuf:"bytes,2,opt,name=created_at,json=createdAt" json:"created_at,omitempty"`
+}
+
+func (m *ConstraintsResponse) Reset()                    { *m = ConstraintsResponse{} }
+func (m *ConstraintsResponse) String() string            { return proto.CompactTextString(m) }
+func (*ConstraintsResponse) ProtoMessage()               {}
+func (*ConstraintsResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{13} }
+
+func (m *ConstraintsResponse) GetConstraints() []*Constraint {
+	if m != nil {
+		return m.Constraints
+	}
+	return nil
+}
+
+func (m *ConstraintsResponse) GetCreatedAt() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return nil
+}
+
+type FailCount struct {
+	Node      string `protobuf:"bytes,1,opt,name=node" json:"node,omitempty"`
+	Resource  string `protobuf:"bytes,2,opt,name=resource" json:"resource,omitempty"`
+	Operation string `protobuf:"bytes,3,opt,name=operation" json:"operation,omitempty"`
+	Count     string `protobuf:"bytes,4,opt,name=count" json:"count,omitempty"`
+}
+
+func (m *FailCount) Reset()                    { *m = FailCount{} }
+func (m *FailCount) String() string            { return proto.CompactTextString(m) }
+func (*FailCount) ProtoMessage()               {}
+func (*FailCount) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{14} }
+
+func (m *FailCount) GetNode() string {
+	if m != nil {
+		return m.Node
+	}
+	return ""
+}
+
+func (m *FailCount) GetResource() string {
+	if m != nil {
+		return m.Resource
+	}
+	return ""
+}
+
+func (m *FailCount) GetOperation() string {
+	if m != nil {
+		return m.Operation
+	}
+	return ""
+}
+
+func (m *FailCount) GetCount() string {
+	if m != nil {
+		return m.Count
+	}
+	return ""
+}
+
+type FailedAction struct {
+	Node       string                     `protobuf:"bytes,1,opt,name=node" json:"node,omitempty"`
+	Resource   string                     `protobuf:"bytes,2,opt,name=resource" json:"resource,omitempty"`
+	Operation  string                     `protobuf:"bytes,3,opt,name=operation" json:"operation,omitempty"`
+	Rc         int32                      `protobuf:"varint,4,opt,name=rc" json:"rc,omitempty"`
+	Result     string                     `protobuf:"bytes,5,opt,name=result" json:"result,omitempty"`
+	Status     int32                      `protobuf:"varint,6,opt,name=status" json:"status,omitempty"`
+	ExitReason string                     `protobuf:"bytes,7,opt,name=exit_reason,json=exitReason" json:"exit_reason,omitempty"`
+	LastChange *google_protobuf.Timestamp `protobuf:"bytes,8,opt,name=last_change,json=lastChange" json:"last_change,omitempty"`
+}
+
+func (m *FailedAction) Reset()                    { *m = FailedAction{} }
+func (m *FailedAction) String() string            { return proto.CompactTextString(m) }
+func (*FailedAction) ProtoMessage()               {}
+func (*FailedAction) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{15} }
+
+func (m *FailedAction) GetNode() string {
+	if m != nil {
+		return m.Node
+	}
+	return ""
+}
+
+func (m *FailedAction) GetResource() string {
+	if m != nil {
+		return m.Resource
+	}
+	return ""
+}
+
+func (m *FailedAction) GetOperation() string {
+	if m != nil {
+		return m.Operation
+	}
+	return ""
+}
+
+func (m *FailedAction) GetRc() int32 {
+	if m != nil {
+		return m.Rc
+	}
+	return 0
+}
+
+func (m *FailedAction) GetResult() string {
+	if m != nil {
+		return m.Result
+	}
+	return ""
+}
+
+func (m *FailedAction) GetStatus() int32 {
+	if m != nil {
+		return m.Status
+	}
+	return 0
+}
+
+func (m *FailedAction) GetExitReason() string {
+	if m != nil {
+		return m.ExitReason
+	}
+	return ""
+}
+
+func (m *FailedAction) GetLastChange() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.LastChange
+	}
+	return nil
+}
+
+type FailuresResponse struct {
+	FailCounts    []*FailCount               `protobuf:"bytes,1,rep,name=fail_counts,json=failCounts" json:"fail_counts,omitempty"`
+	FailedActions []*FailedAction            `protobuf:"bytes,2,rep,name=failed_actions,json=failedActions" json:"failed_actions,omitempty"`
+	CreatedAt     *google_protobuf.Timestamp `protobuf:"bytes,3,opt,name=created_at,json=createdAt" json:"created_at,omitempty"`
+}
+
+func (m *FailuresResponse) Reset()                    { *m = FailuresResponse{} }
+func (m *FailuresResponse) String() string            { return proto.CompactTextString(m) }
+func (*FailuresResponse) ProtoMessage()               {}
+func (*FailuresResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{16} }
+
+func (m *FailuresResponse) GetFailCounts() []*FailCount {
+	if m != nil {
+		return m.FailCounts
+	}
+	return nil
+}
+
+func (m *FailuresResponse) GetFailedActions() []*FailedAction {
+	if m != nil {
+		return m.FailedActions
+	}
+	return nil
+}
+
+func (m *FailuresResponse) GetCreatedAt() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return nil
+}
+
+type CleanupResponse struct {
+	CreatedAt *google_protobuf.Timestamp `protobuf:"bytes,1,opt,name=created_at,json=createdAt" json:"created_at,omitempty"`
+}
+
+func (m *CleanupResponse) Reset()                    { *m = CleanupResponse{} }
+func (m *CleanupResponse) String() string            { return proto.CompactTextString(m) }
+func (*CleanupResponse) ProtoMessage()               {}
+func (*CleanupResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{17} }
+
+func (m *CleanupResponse) GetCreatedAt() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Empty)(nil), "failover.Empty")
 	proto.RegisterType((*HealthCheckResponse)(nil), "failover.HealthCheckResponse")
@@ -209,6 +556,17 @@ func init() {
 	proto.RegisterType((*ResumeResponse)(nil), "failover.ResumeResponse")
 	proto.RegisterType((*MigrateResponse)(nil), "failover.MigrateResponse")
 	proto.RegisterType((*UnmigrateResponse)(nil), "failover.UnmigrateResponse")
+	proto.RegisterType((*NodeRequest)(nil), "failover.NodeRequest")
+	proto.RegisterType((*StandbyResponse)(nil), "failover.StandbyResponse")
+	proto.RegisterType((*UnstandbyResponse)(nil), "failover.UnstandbyResponse")
+	proto.RegisterType((*RestartResponse)(nil), "failover.RestartResponse")
+	proto.RegisterType((*MigrateRequest)(nil), "failover.MigrateRequest")
+	proto.RegisterType((*Constraint)(nil), "failover.Constraint")
+	proto.RegisterType((*ConstraintsResponse)(nil), "failover.ConstraintsResponse")
+	proto.RegisterType((*FailCount)(nil), "failover.FailCount")
+	proto.RegisterType((*FailedAction)(nil), "failover.FailedAction")
+	proto.RegisterType((*FailuresResponse)(nil), "failover.FailuresResponse")
+	proto.RegisterType((*CleanupResponse)(nil), "failover.CleanupResponse")
 	proto.RegisterEnum("failover.HealthCheckResponse_Status", HealthCheckResponse_Status_name, HealthCheckResponse_Status_value)
 }
 
@@ -226,8 +584,15 @@ type FailoverClient interface {
 	HealthCheck(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*HealthCheckResponse, error)
 	Pause(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*PauseResponse, error)
 	Resume(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ResumeResponse, error)
-	Migrate(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*MigrateResponse, error)
+	Migrate(ctx context.Context, in *MigrateRequest, opts ...grpc.CallOption) (*MigrateResponse, error)
 	Unmigrate(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*UnmigrateResponse, error)
+	Standby(ctx context.Context, in *NodeRequest, opts ...grpc.CallOption) (*StandbyResponse, error)
+	Unstandby(ctx context.Context, in *NodeRequest, opts ...grpc.CallOption) (*UnstandbyResponse, error)
+	Restart(ctx context.Context, in *NodeRequest, opts ...grpc.CallOption) (*RestartResponse, error)
+	ListConstraints(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ConstraintsResponse, error)
+	ClearConstraints(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ConstraintsResponse, error)
+	Failures(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*FailuresResponse, error)
+	Cleanup(ctx context.Context, in *NodeRequest, opts ...grpc.CallOption) (*CleanupResponse, error)
 }
 
 type failoverClient struct {
@@ -265,7 +630,7 @@ func (c *failoverClient) Resume(ctx context.Context, in *Empty, opts ...grpc.Cal
 	return out, nil
 }
 
-func (c *failoverClient) Migrate(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*MigrateResponse, error) {
+func (c *failoverClient) Migrate(ctx context.Context, in *MigrateRequest, opts ...grpc.CallOption) (*MigrateResponse, error) {
 	out := new(MigrateResponse)
 	err := grpc.Invoke(ctx, "/failover.Failover/migrate", in, out, c.cc, opts...)
 	if err != nil {
@@ -283,14 +648,84 @@ func (c *failoverClient) Unmigrate(ctx context.Context, in *Empty, opts ...grpc.
 	return out, nil
 }
 
+func (c *failoverClient) Standby(ctx context.Context, in *NodeRequest, opts ...grpc.CallOption) (*StandbyResponse, error) {
+	out := new(StandbyResponse)
+	err := grpc.Invoke(ctx, "/failover.Failover/standby", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *failoverClient) Unstandby(ctx context.Context, in *NodeRequest, opts ...grpc.CallOption) (*UnstandbyResponse, error) {
+	out := new(UnstandbyResponse)
+	err := grpc.Invoke(ctx, "/failover.Failover/unstandby", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *failoverClient) Restart(ctx context.Context, in *NodeRequest, opts ...grpc.CallOption) (*RestartResponse, error) {
+	out := new(RestartResponse)
+	err := grpc.Invoke(ctx, "/failover.Failover/restart", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *failoverClient) ListConstraints(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ConstraintsResponse, error) {
+	out := new(ConstraintsResponse)
+	err := grpc.Invoke(ctx, "/failover.Failover/list_constraints", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *failoverClient) ClearConstraints(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ConstraintsResponse, error) {
+	out := new(ConstraintsResponse)
+	err := grpc.Invoke(ctx, "/failover.Failover/clear_constraints", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *failoverClient) Failures(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*FailuresResponse, error) {
+	out := new(FailuresResponse)
+	err := grpc.Invoke(ctx, "/failover.Failover/failures", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *failoverClient) Cleanup(ctx context.Context, in *NodeRequest, opts ...grpc.CallOption) (*CleanupResponse, error) {
+	out := new(CleanupResponse)
+	err := grpc.Invoke(ctx, "/failover.Failover/cleanup", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Failover service
 
 type FailoverServer interface {
 	HealthCheck(context.Context, *Empty) (*HealthCheckResponse, error)
 	Pause(context.Context, *PauseRequest) (*PauseResponse, error)
 	Resume(context.Context, *Empty) (*ResumeResponse, error)
-	Migrate(context.Context, *Empty) (*MigrateResponse, error)
+	Migrate(context.Context, *MigrateRequest) (*MigrateResponse, error)
 	Unmigrate(context.Context, *Empty) (*UnmigrateResponse, error)
+	Standby(context.Context, *NodeRequest) (*StandbyResponse, error)
+	Unstandby(context.Context, *NodeRequest) (*UnstandbyResponse, error)
+	Restart(context.Context, *NodeRequest) (*RestartResponse, error)
+	ListConstraints(context.Context, *Empty) (*ConstraintsResponse, error)
+	ClearConstraints(context.Context, *Empty) (*ConstraintsResponse, error)
+	Failures(context.Context, *Empty) (*FailuresResponse, error)
+	Cleanup(context.Context, *NodeRequest) (*CleanupResponse, error)
 }
 
 func RegisterFailoverServer(s *grpc.Server, srv FailoverServer) {
@@ -352,7 +787,7 @@ func _Failover_Resume_Handler(srv interface{}, ctx context.Context, dec func(int
 }
 
 func _Failover_Migrate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Empty)
+	in := new(MigrateRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
@@ -364,7 +799,7 @@ func _Failover_Migrate_Handler(srv interface{}, ctx context.Context, dec func(in
 		FullMethod: "/failover.Failover/Migrate",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(FailoverServer).Migrate(ctx, req.(*Empty))
+		return srv.(FailoverServer).Migrate(ctx, req.(*MigrateRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -387,6 +822,132 @@ func _Failover_Unmigrate_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Failover_Standby_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FailoverServer).Standby(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/failover.Failover/Standby",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FailoverServer).Standby(ctx, req.(*NodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Failover_Unstandby_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FailoverServer).Unstandby(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/failover.Failover/Unstandby",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FailoverServer).Unstandby(ctx, req.(*NodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Failover_Restart_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FailoverServer).Restart(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/failover.Failover/Restart",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FailoverServer).Restart(ctx, req.(*NodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Failover_ListConstraints_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FailoverServer).ListConstraints(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/failover.Failover/ListConstraints",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FailoverServer).ListConstraints(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Failover_ClearConstraints_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FailoverServer).ClearConstraints(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/failover.Failover/ClearConstraints",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FailoverServer).ClearConstraints(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Failover_Failures_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FailoverServer).Failures(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/failover.Failover/Failures",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FailoverServer).Failures(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Failover_Cleanup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FailoverServer).Cleanup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/failover.Failover/Cleanup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FailoverServer).Cleanup(ctx, req.(*NodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Failover_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "failover.Failover",
 	HandlerType: (*FailoverServer)(nil),
@@ -411,6 +972,34 @@ var _Failover_serviceDesc = grpc.ServiceDesc{
 			MethodName: "unmigrate",
 			Handler:    _Failover_Unmigrate_Handler,
 		},
+		{
+			MethodName: "standby",
+			Handler:    _Failover_Standby_Handler,
+		},
+		{
+			MethodName: "unstandby",
+			Handler:    _Failover_Unstandby_Handler,
+		},
+		{
+			MethodName: "restart",
+			Handler:    _Failover_Restart_Handler,
+		},
+		{
+			MethodName: "list_constraints",
+			Handler:    _Failover_ListConstraints_Handler,
+		},
+		{
+			MethodName: "clear_constraints",
+			Handler:    _Failover_ClearConstraints_Handler,
+		},
+		{
+			MethodName: "failures",
+			Handler:    _Failover_Failures_Handler,
+		},
+		{
+			MethodName: "cleanup",
+			Handler:    _Failover_Cleanup_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "failover.proto",
@@ -419,33 +1008,62 @@ var _Failover_serviceDesc = grpc.ServiceDesc{
 func init() { proto.RegisterFile("failover.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 445 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x52, 0x5d, 0x8b, 0xd3, 0x40,
-	0x14, 0x4d, 0x2a, 0x4d, 0x37, 0xb7, 0xdd, 0xee, 0x3a, 0xc2, 0x1a, 0x23, 0xa2, 0x0e, 0x3e, 0xf8,
-	0x94, 0xc5, 0x8a, 0x88, 0x1f, 0x0f, 0x5b, 0x64, 0xa5, 0xb0, 0x1a, 0x65, 0x6c, 0x11, 0x9f, 0xca,
-	0x6c, 0x7b, 0x37, 0x0d, 0x36, 0x99, 0x98, 0x99, 0x88, 0xfb, 0x03, 0x14, 0xfc, 0x41, 0xfe, 0x3f,
-	0xc9, 0x64, 0xd2, 0x68, 0xe3, 0x07, 0xca, 0x3e, 0xde, 0x93, 0x73, 0x6e, 0xce, 0x9c, 0x7b, 0x60,
-	0x78, 0xc6, 0xe3, 0xb5, 0xf8, 0x88, 0x79, 0x90, 0xe5, 0x42, 0x09, 0xb2, 0x53, 0xcf, 0xfe, 0xcd,
-	0x48, 0x88, 0x68, 0x8d, 0x87, 0x1a, 0x3f, 0x2d, 0xce, 0x0e, 0x55, 0x9c, 0xa0, 0x54, 0x3c, 0xc9,
-	0x2a, 0x2a, 0xed, 0x41, 0xf7, 0x38, 0xc9, 0xd4, 0x39, 0xfd, 0x62, 0xc3, 0x95, 0x09, 0xf2, 0xb5,
-	0x5a, 0x3d, 0x5b, 0xe1, 0xe2, 0x3d, 0x43, 0x99, 0x89, 0x54, 0x22, 0x79, 0x0a, 0x8e, 0x54, 0x5c,
-	0x15, 0xd2, 0xb3, 0x6f, 0xd9, 0x77, 0x87, 0xa3, 0x3b, 0xc1, 0xe6, 0x67, 0xbf, 0xa0, 0x07, 0x6f,
-	0x34, 0x97, 0x19, 0x0d, 0xbd, 0x07, 0x4e, 0x85, 0x90, 0x3e, 0xf4, 0x66, 0xe1, 0x49, 0xf8, 0xea,
-	0x6d, 0xb8, 0x6f, 0x95, 0xc3, 0xe4, 0x78, 0xfc, 0x62, 0x3a, 0x79, 0xb7, 0x6f, 0x93, 0x5d, 0x70,
-	0x67, 0x61, 0x3d, 0x76, 0xe8, 0x11, 0x0c, 0x5e, 0xf3, 0x42, 0x22, 0xc3, 0x0f, 0x05, 0x4a, 0x45,
-	0x3c, 0xe8, 0x95, 0xa6, 0x45, 0xa1, 0xb4, 0x83, 0x2e, 0xab, 0x47, 0x72, 0x00, 0x0e, 0x7e, 0xca,
-	0xe2, 0xfc, 0xdc, 0xeb, 0xe8, 0x0f, 0x66, 0xa2, 0x9f, 0x6d, 0xd8, 0x35, 0x2b, 0xcc, 0x23, 0x1e,
-	0x01, 0x2c, 0x72, 0xe4, 0x0a, 0x97, 0x73, 0x5e, 0xad, 0xe9, 0x8f, 0xfc, 0xa0, 0xca, 0x26, 0xa8,
-	0xb3, 0x09, 0xa6, 0x75, 0x36, 0xcc, 0x35, 0xec, 0xb1, 0x2a, 0xa5, 0x7a, 0x2d, 0xca, 0x52, 0xda,
-	0xf9, 0xbb, 0xd4, 0xb0, 0xc7, 0x8a, 0x9e, 0xc0, 0x90, 0xa1, 0x2c, 0x92, 0x8b, 0xf0, 0x41, 0xbf,
-	0xda, 0xb0, 0xf7, 0x32, 0x8e, 0x72, 0xae, 0x9a, 0x75, 0xb7, 0x61, 0x90, 0x68, 0x28, 0x4e, 0xa3,
-	0xb9, 0x12, 0x7a, 0xa1, 0xcb, 0xfa, 0x1b, 0x6c, 0x2a, 0xca, 0xf4, 0xf8, 0x72, 0x99, 0xa3, 0x94,
-	0xda, 0xbb, 0xcb, 0xea, 0x71, 0xcb, 0xcb, 0xa5, 0x7f, 0xf1, 0x12, 0xc2, 0xe5, 0x59, 0x9a, 0x6c,
-	0x99, 0xf9, 0xff, 0xb7, 0x8d, 0xbe, 0x75, 0x60, 0xe7, 0xb9, 0x69, 0x15, 0x39, 0x82, 0xc1, 0x4a,
-	0x17, 0x6b, 0xbe, 0x28, 0x9b, 0x45, 0xf6, 0x9a, 0xc2, 0xe9, 0xa6, 0xfa, 0x37, 0xfe, 0xd8, 0x40,
-	0x6a, 0x91, 0xc7, 0xd0, 0xcd, 0xca, 0xf3, 0x93, 0x83, 0x86, 0xf9, 0x63, 0xa5, 0xfc, 0xab, 0x2d,
-	0x7c, 0xa3, 0x7d, 0x00, 0x4e, 0xae, 0x6f, 0xd6, 0xfe, 0xaf, 0xd7, 0x00, 0x3f, 0x9f, 0x95, 0x5a,
-	0xe4, 0x21, 0xf4, 0x4c, 0x1e, 0x6d, 0xdd, 0xb5, 0x06, 0xd8, 0x3a, 0x20, 0xb5, 0xc8, 0x13, 0x70,
-	0x8b, 0xf4, 0xb7, 0xd2, 0xeb, 0x0d, 0xd0, 0x0a, 0x9c, 0x5a, 0xa7, 0x8e, 0x8e, 0xf5, 0xfe, 0xf7,
-	0x00, 0x00, 0x00, 0xff, 0xff, 0xcb, 0xbe, 0xa2, 0x03, 0x00, 0x04, 0x00, 0x00,
+	// 898 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x55, 0x5b, 0x6f, 0x1b, 0x45,
+	0x14, 0xf6, 0x3a, 0xf1, 0xed, 0x6c, 0x62, 0xa7, 0x93, 0x50, 0x16, 0x03, 0x6a, 0x3b, 0xe2, 0xa1,
+	0x4f, 0xae, 0x08, 0x17, 0xa9, 0x94, 0x48, 0x31, 0x26, 0x55, 0xa4, 0x06, 0x83, 0xa6, 0x89, 0x10,
+	0x4f, 0x66, 0xb2, 0x3b, 0x76, 0x56, 0xac, 0x77, 0xcc, 0xcc, 0x2c, 0x6a, 0x7e, 0x00, 0x15, 0xbc,
+	0xf1, 0x9b, 0xf8, 0x59, 0x3c, 0xa1, 0xb9, 0xec, 0xc5, 0x76, 0x94, 0xb4, 0x72, 0xde, 0xf6, 0x3b,
+	0x7b, 0xae, 0xdf, 0x99, 0x73, 0x0e, 0x74, 0xa7, 0x34, 0x4e, 0xf8, 0x1f, 0x4c, 0x0c, 0x16, 0x82,
+	0x2b, 0x8e, 0xda, 0x39, 0xee, 0x3f, 0x9a, 0x71, 0x3e, 0x4b, 0xd8, 0x33, 0x23, 0xbf, 0xcc, 0xa6,
+	0xcf, 0x54, 0x3c, 0x67, 0x52, 0xd1, 0xf9, 0xc2, 0xaa, 0xe2, 0x16, 0x34, 0x4e, 0xe6, 0x0b, 0x75,
+	0x8d, 0xdf, 0x7a, 0xb0, 0x7f, 0xca, 0x68, 0xa2, 0xae, 0x46, 0x57, 0x2c, 0xfc, 0x8d, 0x30, 0xb9,
+	0xe0, 0xa9, 0x64, 0xe8, 0x5b, 0x68, 0x4a, 0x45, 0x55, 0x26, 0x03, 0xef, 0xb1, 0xf7, 0xb4, 0x7b,
+	0xf8, 0xd9, 0xa0, 0x08, 0x76, 0x83, 0xfa, 0xe0, 0xb5, 0xd1, 0x25, 0xce, 0x06, 0x7f, 0x0e, 0x4d,
+	0x2b, 0x41, 0x3e, 0xb4, 0x2e, 0xc6, 0xaf, 0xc6, 0x3f, 0xfe, 0x3c, 0xde, 0xab, 0x69, 0x70, 0x7a,
+	0x32, 0x3c, 0x3b, 0x3f, 0xfd, 0x65, 0xcf, 0x43, 0xbb, 0xd0, 0xb9, 0x18, 0xe7, 0xb0, 0x8e, 0x8f,
+	0x61, 0xe7, 0x27, 0x9a, 0x49, 0x46, 0xd8, 0xef, 0x19, 0x93, 0x0a, 0x05, 0xd0, 0xd2, 0x49, 0xf3,
+	0x4c, 0x99, 0x0c, 0x1a, 0x24, 0x87, 0xe8, 0x21, 0x34, 0xd9, 0x9b, 0x45, 0x2c, 0xae, 0x83, 0xba,
+	0xf9, 0xe1, 0x10, 0xfe, 0xd3, 0x83, 0x5d, 0xe7, 0xc2, 0x15, 0xf1, 0x1c, 0x20, 0x14, 0x8c, 0x2a,
+	0x16, 0x4d, 0xa8, 0x75, 0xe3, 0x1f, 0xf6, 0x07, 0x96, 0x9b, 0x41, 0xce, 0xcd, 0xe0, 0x3c, 0xe7,
+	0x86, 0x74, 0x9c, 0xf6, 0x50, 0x69, 0x53, 0xe3, 0x96, 0x49, 0x6d, 0x5a, 0xbf, 0xdb, 0xd4, 0x69,
+	0x0f, 0x15, 0x7e, 0x05, 0x5d, 0xc2, 0x64, 0x36, 0xbf, 0x8f, 0x3c, 0xf0, 0xdf, 0x1e, 0xf4, 0x7e,
+	0x88, 0x67, 0x82, 0xaa, 0xd2, 0xdd, 0x13, 0xd8, 0x99, 0x1b, 0x51, 0x9c, 0xce, 0x26, 0x8a, 0x1b,
+	0x87, 0x1d, 0xe2, 0x17, 0xb2, 0x73, 0xae, 0xd9, 0xa3, 0x51, 0x24, 0x98, 0x94, 0x26, 0xf7, 0x0e,
+	0xc9, 0xe1, 0x4a, 0x2e, 0x5b, 0xef, 0x93, 0xcb, 0x18, 0x1e, 0x5c, 0xa4, 0xf3, 0x95, 0x64, 0x36,
+	0xa8, 0xed, 0x09, 0xf8, 0x63, 0x1e, 0x15, 0x1d, 0x47, 0xb0, 0x9d, 0xf2, 0x88, 0xb9, 0x72, 0xcc,
+	0x37, 0xfe, 0x15, 0x7a, 0xaf, 0x15, 0x4d, 0xa3, 0xcb, 0xeb, 0x22, 0x20, 0x82, 0x6d, 0xc1, 0x93,
+	0x42, 0x4d, 0x7f, 0xaf, 0x24, 0x51, 0x7f, 0xef, 0xa2, 0xe4, 0x4a, 0x8c, 0x0d, 0x8a, 0x3a, 0x83,
+	0x1e, 0xd1, 0x52, 0xa1, 0xee, 0xc3, 0xdb, 0x77, 0xd0, 0x2d, 0xba, 0x6f, 0x59, 0x3a, 0x80, 0xc6,
+	0x94, 0x8b, 0xd0, 0xd6, 0xdf, 0x26, 0x16, 0xa0, 0x3e, 0xb4, 0x93, 0x78, 0xca, 0xf4, 0x88, 0xb8,
+	0xa9, 0x28, 0x30, 0xfe, 0xc7, 0x03, 0x18, 0xf1, 0x54, 0x2a, 0x41, 0xe3, 0x54, 0xa1, 0x2e, 0xd4,
+	0xe3, 0xc8, 0xb1, 0x57, 0x8f, 0x23, 0x6d, 0x2a, 0x98, 0xe4, 0x99, 0x08, 0xad, 0x69, 0x87, 0x14,
+	0xb8, 0x68, 0xc9, 0x56, 0xd9, 0x92, 0x82, 0xff, 0xed, 0x0a, 0xff, 0x07, 0xd0, 0x90, 0x21, 0x17,
+	0x2c, 0x68, 0x18, 0xa1, 0x05, 0xfa, 0x11, 0xba, 0xa9, 0x08, 0x9a, 0xf6, 0x11, 0x3a, 0x88, 0xff,
+	0xf2, 0x60, 0xbf, 0x4c, 0x49, 0x16, 0x4c, 0x7d, 0x0d, 0x7e, 0x58, 0x8a, 0x03, 0xef, 0xf1, 0xd6,
+	0x53, 0xff, 0xf0, 0xa0, 0x5c, 0x3d, 0xa5, 0x0d, 0xa9, 0x2a, 0x6e, 0xd2, 0x7f, 0x0e, 0x9d, 0x97,
+	0x34, 0x4e, 0x46, 0x3c, 0x4b, 0x6f, 0x7c, 0x82, 0xb7, 0xf2, 0xf3, 0x09, 0x74, 0xf8, 0x82, 0xe9,
+	0xa9, 0xe3, 0xa9, 0x23, 0xa9, 0x14, 0x68, 0x56, 0x42, 0xed, 0xd6, 0x51, 0x65, 0x01, 0xfe, 0xcf,
+	0x83, 0x1d, 0x1d, 0x91, 0x45, 0xc3, 0xd0, 0xa8, 0xdd, 0x6f, 0xd0, 0x2e, 0xd4, 0x45, 0x68, 0x22,
+	0x36, 0x48, 0x5d, 0x84, 0x7a, 0x5b, 0x0a, 0x26, 0xb3, 0x44, 0xb9, 0xde, 0x38, 0xa4, 0xe5, 0x6e,
+	0xc1, 0x37, 0xed, 0x16, 0xb5, 0x08, 0x3d, 0x02, 0x9f, 0xbd, 0x89, 0xd5, 0x44, 0x30, 0x2a, 0x79,
+	0x1a, 0xb4, 0x8c, 0x11, 0x68, 0x11, 0x31, 0x12, 0xf4, 0x02, 0xfc, 0x84, 0x4a, 0x35, 0x09, 0xaf,
+	0x68, 0x3a, 0x63, 0x41, 0xfb, 0x4e, 0xb2, 0x41, 0xab, 0x8f, 0x8c, 0x36, 0xfe, 0xd7, 0x83, 0x3d,
+	0x5d, 0x7c, 0x26, 0x58, 0xd9, 0xf5, 0x2f, 0xc1, 0xd7, 0x1d, 0x9e, 0x18, 0x7e, 0xf2, 0xae, 0xef,
+	0x97, 0x5d, 0x2f, 0xfa, 0x43, 0x60, 0x9a, 0x7f, 0x4a, 0x74, 0x64, 0xef, 0x9f, 0x6e, 0xb9, 0xe1,
+	0x51, 0x6f, 0x3a, 0x6d, 0xf8, 0x70, 0xd9, 0x30, 0xa7, 0x99, 0xec, 0x4e, 0x2b, 0x68, 0xa3, 0x3d,
+	0x78, 0x06, 0xbd, 0x51, 0xc2, 0x68, 0x9a, 0x2d, 0xee, 0x61, 0xc4, 0x0f, 0xdf, 0x36, 0xa1, 0xfd,
+	0xd2, 0x65, 0x8c, 0x8e, 0x61, 0xe7, 0xca, 0x9c, 0xd7, 0x49, 0xa8, 0xef, 0x2b, 0xea, 0x95, 0xc5,
+	0x98, 0x7b, 0xdd, 0xff, 0xf4, 0xd6, 0x3b, 0x8c, 0x6b, 0xe8, 0x1b, 0x68, 0x2c, 0xf4, 0x11, 0x44,
+	0x15, 0x1e, 0xaa, 0x87, 0xb5, 0xff, 0xe1, 0x9a, 0xbc, 0xb0, 0xfd, 0xca, 0xbe, 0x95, 0x39, 0x5b,
+	0x8f, 0x1b, 0x94, 0x82, 0xe5, 0xe3, 0x86, 0x6b, 0xe8, 0x18, 0x5a, 0xee, 0x2a, 0xa0, 0x8a, 0xda,
+	0xf2, 0xde, 0xea, 0x7f, 0x74, 0xc3, 0x9f, 0xc2, 0xc3, 0x0b, 0xe8, 0x64, 0xf9, 0x65, 0x59, 0x8f,
+	0xfd, 0x71, 0x29, 0x58, 0xbb, 0x3f, 0xb8, 0x86, 0x8e, 0xa0, 0xe5, 0xf6, 0x37, 0xfa, 0xa0, 0xd4,
+	0xac, 0x5c, 0x96, 0x6a, 0xec, 0x95, 0x6b, 0x82, 0x6b, 0x68, 0xa8, 0x63, 0xdf, 0xe1, 0x60, 0x29,
+	0x03, 0xb9, 0xe6, 0xe2, 0x08, 0x5a, 0xc2, 0xee, 0xfc, 0x77, 0xc8, 0x60, 0xe5, 0x3a, 0xe0, 0x1a,
+	0xfa, 0x1e, 0xf6, 0x92, 0x58, 0x4f, 0x54, 0x65, 0xa3, 0xdd, 0xd6, 0xf8, 0x1b, 0x36, 0x27, 0xae,
+	0xa1, 0x13, 0x78, 0x10, 0x26, 0x8c, 0x8a, 0x0d, 0xdd, 0x3c, 0x87, 0xf6, 0xd4, 0x0d, 0xe8, 0xba,
+	0x75, 0x7f, 0x79, 0xb6, 0xaa, 0x53, 0x6c, 0x69, 0x08, 0xed, 0x5c, 0xbc, 0x03, 0x0d, 0x2b, 0x13,
+	0x84, 0x6b, 0x97, 0x4d, 0x33, 0x27, 0x5f, 0xfc, 0x3f, 0x00, 0x8d, 0xcd, 0x6d, 0x29, 0xd7, 0x0a,
+	0x00, 0x00,
 }
@@ -0,0 +1,88 @@
+package failover
+
+import (
+	"context"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store/memory"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NotifyWhenMaster", func() {
+	var (
+		ctx    context.Context
+		cancel func()
+		st     *memory.Store
+		fo     *Failover
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		st = memory.NewStore()
+		fo = NewFailover(kitlog.NewNopLogger(), st, nil, nil, FailoverOptions{
+			EtcdHostKey:       "/master",
+			EtcdGenerationKey: "/master-generation",
+		})
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	publish := func(host string, timeline int64) error {
+		value, _ := store.Master{Host: host, Node: "pg", Timeline: timeline}.Encode(store.MasterFormatJSON)
+		return st.SetWithGeneration(ctx, "/master", "/master-generation", value, timeline, store.NoLease)
+	}
+
+	It("Notifies once the target is published as master", func() {
+		Expect(publish("172.17.0.2", 1)).To(Succeed())
+		notify := fo.NotifyWhenMaster(ctx, kitlog.NewNopLogger(), "172.17.0.3")
+		Consistently(notify, 100*time.Millisecond).ShouldNot(Receive())
+
+		Expect(publish("172.17.0.3", 2)).To(Succeed())
+		Eventually(notify).Should(Receive())
+	})
+
+	It("Notifies only once should the target be republished", func() {
+		notify := fo.NotifyWhenMaster(ctx, kitlog.NewNopLogger(), "172.17.0.3")
+
+		Expect(publish("172.17.0.3", 2)).To(Succeed())
+		Eventually(notify).Should(Receive())
+
+		// Such as when a new leader takes over, or the record is refreshed
+		Expect(st.Put(ctx, "/master", `{"host":"172.17.0.3","timeline":2}`, store.NoLease)).To(Succeed())
+		Expect(publish("172.17.0.3", 2)).To(Succeed())
+		Eventually(notify).Should(BeClosed())
+		Consistently(notify, 100*time.Millisecond).Should(BeClosed())
+	})
+
+	It("Ignores the target if published by a stale writer", func() {
+		Expect(publish("172.17.0.3", 1)).To(Succeed())
+		Expect(publish("172.17.0.2", 2)).To(Succeed())
+
+		notify := fo.NotifyWhenMaster(ctx, kitlog.NewNopLogger(), "172.17.0.3")
+		Consistently(notify, 100*time.Millisecond).ShouldNot(Receive())
+
+		// A writer that last saw the old master, on the timeline it was promoted to, is
+		// refused by the store
+		Expect(publish("172.17.0.3", 1)).To(Equal(store.ErrStaleGeneration))
+		Consistently(notify, 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("Ignores the target if restored with an older generation", func() {
+		Expect(publish("172.17.0.3", 1)).To(Succeed())
+		Expect(publish("172.17.0.2", 2)).To(Succeed())
+
+		notify := fo.NotifyWhenMaster(ctx, kitlog.NewNopLogger(), "172.17.0.3")
+		Consistently(notify, 100*time.Millisecond).ShouldNot(Receive())
+
+		// Writes that bypass the store's generation check, such as restoring from backup
+		Expect(st.Put(ctx, "/master-generation", "1", store.NoLease)).To(Succeed())
+		Expect(st.Put(ctx, "/master", "172.17.0.3", store.NoLease)).To(Succeed())
+		Consistently(notify, 100*time.Millisecond).ShouldNot(Receive())
+	})
+})
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/beevik/etree"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pacemaker"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -44,8 +45,8 @@ func (c fakeCrm) ResolveAddress(ctx context.Context, nodeID string) (string, err
 	return args.String(0), args.Error(1)
 }
 
-func (c fakeCrm) Migrate(ctx context.Context, to string) error {
-	args := c.Called(ctx, to)
+func (c fakeCrm) Migrate(ctx context.Context, to string, lifetime time.Duration) error {
+	args := c.Called(ctx, to, lifetime)
 	return args.Error(0)
 }
 
@@ -53,3 +54,52 @@ func (c fakeCrm) Unmigrate(ctx context.Context) error {
 	args := c.Called(ctx)
 	return args.Error(0)
 }
+
+func (c fakeCrm) Constraints(ctx context.Context) ([]pacemaker.Constraint, error) {
+	args := c.Called(ctx)
+	return args.Get(0).([]pacemaker.Constraint), args.Error(1)
+}
+
+func (c fakeCrm) ClearConstraints(ctx context.Context) ([]pacemaker.Constraint, error) {
+	args := c.Called(ctx)
+	return args.Get(0).([]pacemaker.Constraint), args.Error(1)
+}
+
+func (c fakeCrm) Standby(ctx context.Context, node string) error {
+	args := c.Called(ctx, node)
+	return args.Error(0)
+}
+
+func (c fakeCrm) Unstandby(ctx context.Context, node string) error {
+	args := c.Called(ctx, node)
+	return args.Error(0)
+}
+
+func (c fakeCrm) Restart(ctx context.Context, node string) error {
+	args := c.Called(ctx, node)
+	return args.Error(0)
+}
+
+func (c fakeCrm) Failures(ctx context.Context) (*pacemaker.Failures, error) {
+	args := c.Called(ctx)
+	return args.Get(0).(*pacemaker.Failures), args.Error(1)
+}
+
+func (c fakeCrm) Cleanup(ctx context.Context, node string) error {
+	args := c.Called(ctx, node)
+	return args.Error(0)
+}
+
+func (c fakeCrm) Precheck(ctx context.Context, target string) ([]string, error) {
+	args := c.Called(ctx, target)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (c fakeCrm) Topology(ctx context.Context) (*pacemaker.Topology, error) {
+	args := c.Called(ctx)
+	return args.Get(0).(*pacemaker.Topology), args.Error(1)
+}
+
+func (c fakeCrm) Profile() pacemaker.Profile {
+	return pacemaker.PgsqlProfile
+}
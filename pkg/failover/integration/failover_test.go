@@ -6,6 +6,7 @@ import (
 
 	"github.com/coreos/etcd/clientv3/concurrency"
 	kitlog "github.com/go-kit/kit/log"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/etcd"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/etcd/integration"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/failover"
 	. "github.com/onsi/ginkgo"
@@ -32,7 +33,7 @@ var _ = Describe("Failover", func() {
 
 		fo = failover.NewFailover(
 			logger,
-			client,
+			etcd.NewStore(client),
 			map[string]failover.FailoverClient{},
 			locker,
 			failover.FailoverOptions{
@@ -0,0 +1,247 @@
+package failover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pacemaker"
+	"github.com/pkg/errors"
+)
+
+// Evacuate prepares a node for maintenance by moving all Postgres roles away from it and
+// placing it into pacemaker standby. If the node is currently master, we first perform a
+// zero-downtime failover to the sync.
+//
+// Pacemaker only elects a new sync once the current sync stops replicating, so when
+// evacuating the sync we wait for another replica to take over after the standby, before
+// considering the evacuation complete.
+func (f *Failover) Evacuate(ctx context.Context, deferCtx context.Context, node string) error {
+	return Pipeline(
+		Step(f.HealthCheckClients),
+		Step(f.AcquireLock).Defer(f.ReleaseLock),
+		Step(func(ctx context.Context) error { return f.FailoverIfMaster(ctx, deferCtx, node) }),
+		Step(func(ctx context.Context) error { return f.Standby(ctx, node) }),
+		Step(func(ctx context.Context) error { return f.WaitForTopology(ctx, evacuated(node)) }),
+	)(
+		ctx, deferCtx,
+	)
+}
+
+// Restore reverses an evacuation, bringing the node out of standby and waiting until it
+// has rejoined the cluster as a replica.
+func (f *Failover) Restore(ctx context.Context, deferCtx context.Context, node string) error {
+	return Pipeline(
+		Step(f.HealthCheckClients),
+		Step(f.AcquireLock).Defer(f.ReleaseLock),
+		Step(func(ctx context.Context) error { return f.Unstandby(ctx, node) }),
+		Step(func(ctx context.Context) error { return f.WaitForTopology(ctx, restored(node)) }),
+	)(
+		ctx, deferCtx,
+	)
+}
+
+// FailoverIfMaster runs the zero-downtime failover steps if the given node is currently
+// the master. We expect to already hold the failover lock.
+func (f *Failover) FailoverIfMaster(ctx context.Context, deferCtx context.Context, node string) error {
+	topology, err := f.GetTopology(ctx)
+	if err != nil {
+		return err
+	}
+
+	if topology.Node(node) == nil {
+		return fmt.Errorf("failed to find node %s in cluster topology", node)
+	}
+
+	if master := topology.Role(pacemaker.RoleMaster); master == nil || master.Name != node {
+		return nil
+	}
+
+	f.logger.Log("event", "evacuate.failover", "node", node, "msg", "node is master, failing over")
+	return Pipeline(
+		Step(f.Pause).Defer(f.Resume),
+		Step(f.Migrate).Defer(f.Unmigrate),
+	)(
+		ctx, deferCtx,
+	)
+}
+
+func (f *Failover) Standby(ctx context.Context, node string) error {
+	endpoint, client := f.getClient()
+
+	logger := kitlog.With(f.logger, "event", "clients.pacemaker.standby", "endpoint", endpoint, "node", node)
+	logger.Log("msg", "requesting pacemaker standby")
+
+	ctx, cancel := context.WithTimeout(ctx, f.opt.PacemakerTimeout)
+	defer cancel()
+
+	resp, err := client.Standby(ctx, &NodeRequest{Node: node})
+	if err != nil {
+		return errors.Wrapf(err, "failed to standby %s", node)
+	}
+
+	logger.Log("msg", "node in standby", "previous_role", resp.Role)
+	return nil
+}
+
+func (f *Failover) Unstandby(ctx context.Context, node string) error {
+	endpoint, client := f.getClient()
+
+	logger := kitlog.With(f.logger, "event", "clients.pacemaker.unstandby", "endpoint", endpoint, "node", node)
+	logger.Log("msg", "requesting pacemaker unstandby")
+
+	ctx, cancel := context.WithTimeout(ctx, f.opt.PacemakerTimeout)
+	defer cancel()
+
+	if _, err := client.Unstandby(ctx, &NodeRequest{Node: node}); err != nil {
+		return errors.Wrapf(err, "failed to unstandby %s", node)
+	}
+
+	return nil
+}
+
+// GetTopology loads the cluster topology that supervise publishes to the store
+func (f *Failover) GetTopology(ctx context.Context) (*pacemaker.Topology, error) {
+	topology, _, err := f.getTopology(ctx)
+	return topology, err
+}
+
+// getTopology also returns the revision at which the topology was last published
+func (f *Failover) getTopology(ctx context.Context) (*pacemaker.Topology, int64, error) {
+	kv, _, err := f.store.Get(ctx, f.opt.EtcdTopologyKey, 0)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to get cluster topology")
+	}
+
+	if kv == nil {
+		return nil, 0, fmt.Errorf("no topology at %s (is supervise running?)", f.opt.EtcdTopologyKey)
+	}
+
+	var topology pacemaker.Topology
+	if err := json.Unmarshal([]byte(kv.Value), &topology); err != nil {
+		return nil, 0, errors.Wrap(err, "failed to parse cluster topology")
+	}
+
+	return &topology, kv.Revision, nil
+}
+
+// WaitForTopology polls the cluster topology until the condition returns no error, or
+// the settle timeout elapses.
+func (f *Failover) WaitForTopology(ctx context.Context, condition func(*pacemaker.Topology) error) error {
+	logger := kitlog.With(f.logger, "event", "topology.wait", "key", f.opt.EtcdTopologyKey)
+	logger.Log("msg", "waiting for cluster to settle")
+
+	ctx, cancel := context.WithTimeout(ctx, f.opt.SettleTimeout)
+	defer cancel()
+
+	for {
+		topology, err := f.GetTopology(ctx)
+		if err == nil {
+			err = condition(topology)
+		}
+
+		if err == nil {
+			logger.Log("msg", "cluster has settled")
+			return nil
+		}
+
+		logger.Log("msg", "cluster not yet settled", "reason", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(err, "timed out waiting for cluster to settle")
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// healthy requires the cluster be quorate with an online master
+func healthy(topology *pacemaker.Topology) error {
+	if !topology.Quorate {
+		return fmt.Errorf("cluster is not quorate")
+	}
+
+	master := topology.Role(pacemaker.RoleMaster)
+	if master == nil {
+		return fmt.Errorf("cluster has no master")
+	}
+
+	if !master.Online {
+		return fmt.Errorf("master %s is offline", master.Name)
+	}
+
+	return nil
+}
+
+// evacuated is satisfied once the node is in standby with Postgres stopped. If another
+// replica is available, we also require that it has become sync.
+func evacuated(name string) func(*pacemaker.Topology) error {
+	return func(topology *pacemaker.Topology) error {
+		if err := healthy(topology); err != nil {
+			return err
+		}
+
+		node := topology.Node(name)
+		if node == nil {
+			return fmt.Errorf("failed to find node %s", name)
+		}
+
+		if !node.Standby {
+			return fmt.Errorf("node %s is not in standby", name)
+		}
+
+		if node.Role != pacemaker.RoleStopped {
+			return fmt.Errorf("node %s is still running as %s", name, node.Role)
+		}
+
+		if topology.Role(pacemaker.RoleSync) == nil && hasOnline(topology, pacemaker.RoleAsync) {
+			return fmt.Errorf("waiting for an async to become sync")
+		}
+
+		return nil
+	}
+}
+
+// restored is satisfied once the node is online and replicating from the master
+func restored(name string) func(*pacemaker.Topology) error {
+	return func(topology *pacemaker.Topology) error {
+		if err := healthy(topology); err != nil {
+			return err
+		}
+
+		node := topology.Node(name)
+		if node == nil {
+			return fmt.Errorf("failed to find node %s", name)
+		}
+
+		if node.Standby {
+			return fmt.Errorf("node %s is still in standby", name)
+		}
+
+		if !node.Online {
+			return fmt.Errorf("node %s is offline", name)
+		}
+
+		if node.Role != pacemaker.RoleSync && node.Role != pacemaker.RoleAsync {
+			return fmt.Errorf("node %s is not yet replicating", name)
+		}
+
+		return nil
+	}
+}
+
+// restarting is satisfied once the topology shows the node stopped or gone from the
+// cluster. Newer topologies are published whenever any node attribute changes, so we
+// can't take them as evidence of the restart.
+func restarting(name string) func(*pacemaker.Topology) error {
+	return func(topology *pacemaker.Topology) error {
+		node := topology.Node(name)
+		if node == nil || !node.Online || node.Role == pacemaker.RoleStopped {
+			return nil
+		}
+
+		return fmt.Errorf("node %s has not yet restarted", name)
+	}
+}
@@ -0,0 +1,95 @@
+package failover
+
+import (
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pacemaker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Maintenance", func() {
+	var topology *pacemaker.Topology
+
+	BeforeEach(func() {
+		topology = &pacemaker.Topology{
+			Quorate: true,
+			Nodes: []pacemaker.Node{
+				{Name: "pg01", Role: pacemaker.RoleMaster, Online: true},
+				{Name: "pg02", Role: pacemaker.RoleStopped, Online: true, Standby: true},
+				{Name: "pg03", Role: pacemaker.RoleSync, Online: true},
+			},
+		}
+	})
+
+	Describe("evacuated", func() {
+		It("Succeeds once node is stopped in standby", func() {
+			Expect(evacuated("pg02")(topology)).To(Succeed())
+		})
+
+		It("Waits for standby", func() {
+			topology.Nodes[1].Standby = false
+			Expect(evacuated("pg02")(topology)).To(MatchError("node pg02 is not in standby"))
+		})
+
+		It("Waits for Postgres to stop", func() {
+			topology.Nodes[1].Role = pacemaker.RoleSync
+			topology.Nodes[2].Role = pacemaker.RoleAsync
+			Expect(evacuated("pg02")(topology)).To(MatchError("node pg02 is still running as sync"))
+		})
+
+		It("Waits for async to become sync", func() {
+			topology.Nodes[2].Role = pacemaker.RoleAsync
+			Expect(evacuated("pg02")(topology)).To(MatchError("waiting for an async to become sync"))
+		})
+
+		It("Requires quorum", func() {
+			topology.Quorate = false
+			Expect(evacuated("pg02")(topology)).To(MatchError("cluster is not quorate"))
+		})
+
+		It("Requires an online master", func() {
+			topology.Nodes[0].Online = false
+			Expect(evacuated("pg02")(topology)).To(MatchError("master pg01 is offline"))
+		})
+	})
+
+	Describe("restored", func() {
+		BeforeEach(func() {
+			topology.Nodes[1].Standby = false
+			topology.Nodes[1].Role = pacemaker.RoleAsync
+		})
+
+		It("Succeeds once node is replicating", func() {
+			Expect(restored("pg02")(topology)).To(Succeed())
+		})
+
+		It("Waits for Postgres to start", func() {
+			topology.Nodes[1].Role = pacemaker.RoleStopped
+			Expect(restored("pg02")(topology)).To(MatchError("node pg02 is not yet replicating"))
+		})
+
+		It("Fails for unknown nodes", func() {
+			Expect(restored("pg04")(topology)).To(MatchError("failed to find node pg04"))
+		})
+	})
+
+	Describe("restarting", func() {
+		It("Waits while the node is running", func() {
+			Expect(restarting("pg03")(topology)).To(MatchError("node pg03 has not yet restarted"))
+		})
+
+		It("Succeeds once the node has stopped", func() {
+			topology.Nodes[2].Role = pacemaker.RoleStopped
+			Expect(restarting("pg03")(topology)).To(Succeed())
+		})
+
+		It("Succeeds once the node has gone offline", func() {
+			topology.Nodes[2].Online = false
+			Expect(restarting("pg03")(topology)).To(Succeed())
+		})
+
+		It("Succeeds once the node has left the cluster", func() {
+			Expect(restarting("pg04")(topology)).To(Succeed())
+		})
+	})
+})
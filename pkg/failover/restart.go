@@ -0,0 +1,235 @@
+package failover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pacemaker"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+	"github.com/pkg/errors"
+)
+
+// RestartProgress records the state of a rolling restart in the store, allowing an interrupted
+// restart to be resumed.
+type RestartProgress struct {
+	Order     []string `json:"order"`     // nodes in the order they should be restarted
+	Restarted []string `json:"restarted"` // nodes that have completed their restart
+}
+
+// Remaining returns the nodes that have yet to be restarted
+func (p *RestartProgress) Remaining() []string {
+	remaining := []string{}
+	for _, node := range p.Order {
+		if !includes(p.Restarted, node) {
+			remaining = append(remaining, node)
+		}
+	}
+
+	return remaining
+}
+
+// RollingRestart restarts Postgres on every node, one at a time. Replicas are restarted
+// first, waiting for each to resume streaming before moving on. Finally we perform a
+// zero-downtime failover away from the master, then restart the old master.
+//
+// Progress is stored in etcd after each node is restarted, and the restart will resume
+// from where it left off if interrupted.
+func (f *Failover) RollingRestart(ctx context.Context, deferCtx context.Context) error {
+	return Pipeline(
+		Step(f.HealthCheckClients),
+		Step(f.AcquireLock).Defer(f.ReleaseLock),
+		Step(func(ctx context.Context) error { return f.RestartNodes(ctx, deferCtx) }),
+	)(
+		ctx, deferCtx,
+	)
+}
+
+// RestartNodes restarts each remaining node in our restart plan, clearing progress once
+// every node has been restarted. We expect to already hold the failover lock.
+func (f *Failover) RestartNodes(ctx context.Context, deferCtx context.Context) error {
+	logger := kitlog.With(f.logger, "event", "rolling_restart", "key", f.opt.EtcdRestartKey)
+
+	progress, err := f.LoadRestartProgress(ctx)
+	if err != nil {
+		return err
+	}
+
+	if progress == nil {
+		topology, err := f.GetTopology(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := healthy(topology); err != nil {
+			return errors.Wrap(err, "refusing to start rolling restart")
+		}
+
+		progress = &RestartProgress{Order: restartOrder(topology), Restarted: []string{}}
+		logger.Log("msg", "starting rolling restart", "order", fmt.Sprintf("%v", progress.Order))
+
+		if err := f.SaveRestartProgress(ctx, progress); err != nil {
+			return err
+		}
+	} else {
+		logger.Log("msg", "resuming rolling restart", "remaining", fmt.Sprintf("%v", progress.Remaining()))
+	}
+
+	for _, node := range progress.Remaining() {
+		if err := f.FailoverIfMaster(ctx, deferCtx, node); err != nil {
+			return err
+		}
+
+		_, revision, err := f.getTopology(ctx)
+		if err != nil {
+			return err
+		}
+
+		// The topology from before the restart would satisfy restored, so we first wait to
+		// see the restart take effect.
+		if err := f.restartNode(ctx, node, revision); err != nil {
+			return err
+		}
+
+		if err := f.WaitForTopology(ctx, restored(node)); err != nil {
+			return err
+		}
+
+		progress.Restarted = append(progress.Restarted, node)
+		if err := f.SaveRestartProgress(ctx, progress); err != nil {
+			return err
+		}
+	}
+
+	logger.Log("msg", "all nodes restarted, clearing progress")
+	if err := f.store.Delete(ctx, f.opt.EtcdRestartKey); err != nil {
+		return errors.Wrap(err, "failed to clear rolling restart progress")
+	}
+
+	return nil
+}
+
+// restartNode restarts the node, returning once a topology published after revision since
+// shows it stopped. Restarts can complete faster than we'd poll, so we watch every
+// topology published from since rather than reading the latest.
+func (f *Failover) restartNode(ctx context.Context, node string, since int64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- f.watchRestart(ctx, node, since) }()
+
+	if err := f.Restart(ctx, node); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-stopped:
+		return err
+	case <-time.After(f.opt.SettleTimeout):
+		return fmt.Errorf("timed out waiting to see %s restart", node)
+	}
+}
+
+// watchRestart waits for a topology published after since to show the node stopped
+func (f *Failover) watchRestart(ctx context.Context, node string, since int64) error {
+	for resp := range f.store.Watch(ctx, f.opt.EtcdTopologyKey, since) {
+		if resp.Err != nil {
+			return errors.Wrap(resp.Err, "failed to watch cluster topology")
+		}
+
+		for _, kv := range resp.KeyValues {
+			var topology pacemaker.Topology
+			if kv.Value == "" || json.Unmarshal([]byte(kv.Value), &topology) != nil {
+				continue
+			}
+
+			if restarting(node)(&topology) == nil {
+				return nil
+			}
+		}
+	}
+
+	return ctx.Err()
+}
+
+// Restart asks pacemaker to restart Postgres on the node, which returns once it has
+// stopped and started again. This can take far longer than other pacemaker commands, so
+// is bounded by the restart timeout.
+func (f *Failover) Restart(ctx context.Context, node string) error {
+	endpoint, client := f.getClient()
+
+	logger := kitlog.With(f.logger, "event", "clients.pacemaker.restart", "endpoint", endpoint, "node", node)
+	logger.Log("msg", "requesting pacemaker restart")
+
+	ctx, cancel := context.WithTimeout(ctx, f.opt.RestartTimeout)
+	defer cancel()
+
+	if _, err := client.Restart(ctx, &NodeRequest{Node: node}); err != nil {
+		return errors.Wrapf(err, "failed to restart %s", node)
+	}
+
+	return nil
+}
+
+// LoadRestartProgress returns the progress of an in-flight rolling restart, or nil if no
+// restart is in progress.
+func (f *Failover) LoadRestartProgress(ctx context.Context) (*RestartProgress, error) {
+	kv, _, err := f.store.Get(ctx, f.opt.EtcdRestartKey, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get rolling restart progress")
+	}
+
+	if kv == nil {
+		return nil, nil
+	}
+
+	var progress RestartProgress
+	if err := json.Unmarshal([]byte(kv.Value), &progress); err != nil {
+		return nil, errors.Wrap(err, "failed to parse rolling restart progress")
+	}
+
+	return &progress, nil
+}
+
+func (f *Failover) SaveRestartProgress(ctx context.Context, progress *RestartProgress) error {
+	value, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+
+	if err := f.store.Put(ctx, f.opt.EtcdRestartKey, string(value), store.NoLease); err != nil {
+		return errors.Wrap(err, "failed to save rolling restart progress")
+	}
+
+	return nil
+}
+
+// restartOrder restarts asyncs first, then the sync, leaving the master until last. We
+// restart the sync after asyncs so there is always a streaming replica ready to take
+// over should the master fail. Nodes that aren't running Postgres are skipped, as we'd
+// never see them return to streaming.
+func restartOrder(topology *pacemaker.Topology) []string {
+	order := []string{}
+	for _, role := range []pacemaker.Role{pacemaker.RoleAsync, pacemaker.RoleSync, pacemaker.RoleMaster} {
+		for _, node := range topology.Nodes {
+			if node.Role == role {
+				order = append(order, node.Name)
+			}
+		}
+	}
+
+	return order
+}
+
+func includes(set []string, elem string) bool {
+	for _, candidate := range set {
+		if candidate == elem {
+			return true
+		}
+	}
+
+	return false
+}
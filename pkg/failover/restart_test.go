@@ -0,0 +1,120 @@
+package failover
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pacemaker"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store/memory"
+	"google.golang.org/grpc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RestartProgress", func() {
+	It("Returns nodes yet to be restarted, in order", func() {
+		progress := &RestartProgress{
+			Order:     []string{"pg03", "pg02", "pg01"},
+			Restarted: []string{"pg03"},
+		}
+
+		Expect(progress.Remaining()).To(Equal([]string{"pg02", "pg01"}))
+	})
+})
+
+var _ = Describe("restartOrder", func() {
+	It("Restarts asyncs, then sync, then master", func() {
+		topology := &pacemaker.Topology{
+			Quorate: true,
+			Nodes: []pacemaker.Node{
+				{Name: "pg01", Role: pacemaker.RoleMaster},
+				{Name: "pg02", Role: pacemaker.RoleSync},
+				{Name: "pg03", Role: pacemaker.RoleAsync},
+				{Name: "pg04", Role: pacemaker.RoleAsync},
+				{Name: "pg05", Role: pacemaker.RoleStopped},
+			},
+		}
+
+		Expect(restartOrder(topology)).To(Equal([]string{"pg03", "pg04", "pg02", "pg01"}))
+	})
+})
+
+// fakeRestarter stands in for a failover API, running restart when asked to restart
+type fakeRestarter struct {
+	FailoverClient
+	restart func(ctx context.Context)
+}
+
+func (c fakeRestarter) Restart(ctx context.Context, _ *NodeRequest, _ ...grpc.CallOption) (*RestartResponse, error) {
+	c.restart(ctx)
+	return &RestartResponse{}, nil
+}
+
+var _ = Describe("restartNode", func() {
+	var (
+		ctx    context.Context
+		cancel func()
+		st     *memory.Store
+		fo     *Failover
+		client *fakeRestarter
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		st = memory.NewStore()
+		client = &fakeRestarter{}
+		fo = NewFailover(kitlog.NewNopLogger(), st, map[string]FailoverClient{"pg01:8080": client}, nil, FailoverOptions{
+			EtcdTopologyKey: "/topology",
+			RestartTimeout:  time.Second,
+			SettleTimeout:   200 * time.Millisecond,
+		})
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	publish := func(role pacemaker.Role, attributes map[string]string) {
+		value, _ := json.Marshal(&pacemaker.Topology{
+			Quorate: true,
+			Nodes: []pacemaker.Node{
+				{Name: "pg02", Role: role, Online: true, Attributes: attributes},
+			},
+		})
+
+		Expect(st.Put(ctx, "/topology", string(value), store.NoLease)).To(Succeed())
+	}
+
+	since := func() int64 {
+		_, revision, err := fo.getTopology(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		return revision
+	}
+
+	It("Sees restarts that complete before pacemaker returns", func() {
+		publish(pacemaker.RoleAsync, nil)
+		revision := since()
+
+		client.restart = func(ctx context.Context) {
+			publish(pacemaker.RoleStopped, nil)
+			publish(pacemaker.RoleAsync, nil)
+		}
+
+		Expect(fo.restartNode(ctx, "pg02", revision)).To(Succeed())
+	})
+
+	It("Ignores topologies that merely change node attributes", func() {
+		publish(pacemaker.RoleAsync, nil)
+		revision := since()
+
+		client.restart = func(ctx context.Context) {
+			publish(pacemaker.RoleAsync, map[string]string{"fail-count": "1"})
+		}
+
+		Expect(fo.restartNode(ctx, "pg02", revision)).To(MatchError("timed out waiting to see pg02 restart"))
+	})
+})
@@ -2,6 +2,7 @@ package failover
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/beevik/etree"
@@ -47,8 +48,18 @@ type pauser interface {
 type crm interface {
 	Get(context.Context, ...string) ([]*etree.Element, error)
 	ResolveAddress(context.Context, string) (string, error)
-	Migrate(context.Context, string) error
+	Migrate(context.Context, string, time.Duration) error
 	Unmigrate(context.Context) error
+	Constraints(context.Context) ([]pacemaker.Constraint, error)
+	ClearConstraints(context.Context) ([]pacemaker.Constraint, error)
+	Standby(context.Context, string) error
+	Unstandby(context.Context, string) error
+	Restart(context.Context, string) error
+	Failures(context.Context) (*pacemaker.Failures, error)
+	Cleanup(context.Context, string) error
+	Precheck(context.Context, string) ([]string, error)
+	Topology(context.Context) (*pacemaker.Topology, error)
+	Profile() pacemaker.Profile
 }
 
 func iso3339(t time.Time) string {
@@ -131,8 +142,11 @@ func (s *Server) Resume(ctx context.Context, _ *Empty) (*ResumeResponse, error)
 	return &ResumeResponse{CreatedAt: s.TimestampProto(s.clock.Now())}, nil
 }
 
-func (s *Server) Migrate(ctx context.Context, _ *Empty) (*MigrateResponse, error) {
-	nodes, err := s.crm.Get(ctx, pacemaker.SyncXPath)
+// Migrate moves the master to the current sync node. Unless forced, we first check the
+// cluster for conditions that would make the migration unsafe, as pacemaker can
+// otherwise accept the migration but never act on it.
+func (s *Server) Migrate(ctx context.Context, req *MigrateRequest) (*MigrateResponse, error) {
+	nodes, err := s.crm.Get(ctx, s.crm.Profile().SyncXPath())
 	if err != nil {
 		return nil, status.Errorf(codes.Unknown, "failed to query cib: %s", err.Error())
 	}
@@ -152,9 +166,24 @@ func (s *Server) Migrate(ctx context.Context, _ *Empty) (*MigrateResponse, error
 		)
 	}
 
-	if err := s.crm.Migrate(ctx, syncHost); err != nil {
+	if !req.Force {
+		problems, err := s.crm.Precheck(ctx, syncHost)
+		if err != nil {
+			return nil, status.Errorf(codes.Unknown, "failed to run prechecks: %s", err.Error())
+		}
+
+		if len(problems) > 0 {
+			return nil, status.Errorf(
+				codes.FailedPrecondition, "refusing to migrate to %s, use force to override: %s",
+				syncHost, strings.Join(problems, "; "),
+			)
+		}
+	}
+
+	lifetime := time.Duration(req.Lifetime) * time.Second
+	if err := s.crm.Migrate(ctx, syncHost, lifetime); err != nil {
 		return nil, status.Errorf(
-			codes.Unknown, "'crm resource migrate %s' failed: %s", syncHost, err.Error(),
+			codes.Unknown, "failed to migrate to %s: %s", syncHost, err.Error(),
 		)
 	}
 
@@ -167,12 +196,216 @@ func (s *Server) Migrate(ctx context.Context, _ *Empty) (*MigrateResponse, error
 
 func (s *Server) Unmigrate(ctx context.Context, _ *Empty) (*UnmigrateResponse, error) {
 	if err := s.crm.Unmigrate(ctx); err != nil {
-		return nil, status.Errorf(codes.Unknown, "crm resource unmigrate failed: %s", err.Error())
+		return nil, status.Errorf(codes.Unknown, "failed to unmigrate: %s", err.Error())
 	}
 
 	return &UnmigrateResponse{CreatedAt: s.TimestampProto(s.clock.Now())}, nil
 }
 
+// ListConstraints returns all location constraints created by the pacemaker command line
+// tools, which are typically left behind by failed migrations.
+func (s *Server) ListConstraints(ctx context.Context, _ *Empty) (*ConstraintsResponse, error) {
+	constraints, err := s.crm.Constraints(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to query cib: %s", err.Error())
+	}
+
+	return &ConstraintsResponse{
+		Constraints: constraintsProto(constraints),
+		CreatedAt:   s.TimestampProto(s.clock.Now()),
+	}, nil
+}
+
+// ClearConstraints removes all constraints that would be returned by ListConstraints
+func (s *Server) ClearConstraints(ctx context.Context, _ *Empty) (*ConstraintsResponse, error) {
+	constraints, err := s.crm.ClearConstraints(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to clear constraints: %s", err.Error())
+	}
+
+	return &ConstraintsResponse{
+		Constraints: constraintsProto(constraints),
+		CreatedAt:   s.TimestampProto(s.clock.Now()),
+	}, nil
+}
+
+func constraintsProto(constraints []pacemaker.Constraint) []*Constraint {
+	result := []*Constraint{}
+	for _, constraint := range constraints {
+		result = append(result, &Constraint{
+			Id:       constraint.ID,
+			Resource: constraint.Resource,
+			Node:     constraint.Node,
+			Role:     constraint.Role,
+			Score:    constraint.Score,
+			Expires:  constraint.Expires,
+		})
+	}
+
+	return result
+}
+
+// Standby places a node into pacemaker standby, stopping Postgres on that node. We refuse
+// to standby the master, as that would cause an unmanaged failover, and we won't standby
+// the sync unless there is another replica ready to take its place.
+func (s *Server) Standby(ctx context.Context, req *NodeRequest) (*StandbyResponse, error) {
+	topology, err := s.crm.Topology(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to query cib: %s", err.Error())
+	}
+
+	if !topology.Quorate {
+		return nil, status.Errorf(codes.FailedPrecondition, "cluster is not quorate")
+	}
+
+	node := topology.Node(req.Node)
+	if node == nil {
+		return nil, status.Errorf(codes.NotFound, "failed to find node %s", req.Node)
+	}
+
+	switch node.Role {
+	case pacemaker.RoleMaster:
+		return nil, status.Errorf(
+			codes.FailedPrecondition, "refusing to standby master %s, failover first", node.Name,
+		)
+	case pacemaker.RoleSync:
+		if !hasOnline(topology, pacemaker.RoleAsync) {
+			return nil, status.Errorf(
+				codes.FailedPrecondition, "refusing to standby sync %s, no async to replace it", node.Name,
+			)
+		}
+	}
+
+	if err := s.crm.Standby(ctx, node.Name); err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to standby %s: %s", node.Name, err.Error())
+	}
+
+	return &StandbyResponse{
+		Role:      string(node.Role),
+		CreatedAt: s.TimestampProto(s.clock.Now()),
+	}, nil
+}
+
+// Unstandby brings a node out of standby, allowing Postgres to start again
+func (s *Server) Unstandby(ctx context.Context, req *NodeRequest) (*UnstandbyResponse, error) {
+	topology, err := s.crm.Topology(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to query cib: %s", err.Error())
+	}
+
+	if topology.Node(req.Node) == nil {
+		return nil, status.Errorf(codes.NotFound, "failed to find node %s", req.Node)
+	}
+
+	if err := s.crm.Unstandby(ctx, req.Node); err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to unstandby %s: %s", req.Node, err.Error())
+	}
+
+	return &UnstandbyResponse{CreatedAt: s.TimestampProto(s.clock.Now())}, nil
+}
+
+// Restart restarts Postgres on a replica. Restarting the master would cause downtime, so
+// clients should failover before restarting the old master.
+func (s *Server) Restart(ctx context.Context, req *NodeRequest) (*RestartResponse, error) {
+	topology, err := s.crm.Topology(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to query cib: %s", err.Error())
+	}
+
+	if !topology.Quorate {
+		return nil, status.Errorf(codes.FailedPrecondition, "cluster is not quorate")
+	}
+
+	node := topology.Node(req.Node)
+	if node == nil {
+		return nil, status.Errorf(codes.NotFound, "failed to find node %s", req.Node)
+	}
+
+	if node.Role == pacemaker.RoleMaster {
+		return nil, status.Errorf(
+			codes.FailedPrecondition, "refusing to restart master %s, failover first", node.Name,
+		)
+	}
+
+	if err := s.crm.Restart(ctx, node.Name); err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to restart %s: %s", node.Name, err.Error())
+	}
+
+	return &RestartResponse{CreatedAt: s.TimestampProto(s.clock.Now())}, nil
+}
+
+// Failures returns resource fail counts and failed actions for every node. Fail counts
+// can prevent a node from being promoted or rejoining the cluster until cleaned up.
+func (s *Server) Failures(ctx context.Context, _ *Empty) (*FailuresResponse, error) {
+	failures, err := s.crm.Failures(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to query cib: %s", err.Error())
+	}
+
+	resp := &FailuresResponse{
+		FailCounts:    []*FailCount{},
+		FailedActions: []*FailedAction{},
+		CreatedAt:     s.TimestampProto(s.clock.Now()),
+	}
+
+	for _, count := range failures.FailCounts {
+		resp.FailCounts = append(resp.FailCounts, &FailCount{
+			Node:      count.Node,
+			Resource:  count.Resource,
+			Operation: count.Operation,
+			Count:     count.Count,
+		})
+	}
+
+	for _, action := range failures.FailedActions {
+		failedAction := &FailedAction{
+			Node:       action.Node,
+			Resource:   action.Resource,
+			Operation:  action.Operation,
+			Rc:         int32(action.RC),
+			Result:     action.Result(),
+			Status:     int32(action.Status),
+			ExitReason: action.ExitReason,
+		}
+
+		if !action.LastChange.IsZero() {
+			failedAction.LastChange = s.TimestampProto(action.LastChange)
+		}
+
+		resp.FailedActions = append(resp.FailedActions, failedAction)
+	}
+
+	return resp, nil
+}
+
+// Cleanup clears the failure history of the Postgres resource on a node
+func (s *Server) Cleanup(ctx context.Context, req *NodeRequest) (*CleanupResponse, error) {
+	topology, err := s.crm.Topology(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to query cib: %s", err.Error())
+	}
+
+	if topology.Node(req.Node) == nil {
+		return nil, status.Errorf(codes.NotFound, "failed to find node %s", req.Node)
+	}
+
+	if err := s.crm.Cleanup(ctx, req.Node); err != nil {
+		return nil, status.Errorf(codes.Unknown, "failed to cleanup %s: %s", req.Node, err.Error())
+	}
+
+	return &CleanupResponse{CreatedAt: s.TimestampProto(s.clock.Now())}, nil
+}
+
+func hasOnline(topology *pacemaker.Topology, role pacemaker.Role) bool {
+	for _, node := range topology.Nodes {
+		if node.Role == role && node.Online {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (s *Server) TimestampProto(t time.Time) *tspb.Timestamp {
 	ts, err := ptypes.TimestampProto(t)
 
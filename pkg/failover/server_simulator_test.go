@@ -0,0 +1,118 @@
+package failover
+
+import (
+	"context"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pacemaker"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pacemaker/simulator"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server with simulated pacemaker", func() {
+	var (
+		ctx    = context.Background()
+		sim    *simulator.Simulator
+		server *Server
+	)
+
+	BeforeEach(func() {
+		sim = simulator.New(pacemaker.PgsqlProfile, simulator.Options{PromotionDelay: 10 * time.Millisecond}).
+			AddNode("pg01", "10.0.0.1", pacemaker.RoleMaster).
+			AddNode("pg02", "10.0.0.2", pacemaker.RoleSync).
+			AddNode("pg03", "10.0.0.3", pacemaker.RoleAsync)
+
+		crm := pacemaker.NewPacemaker(sim, nil, pacemaker.PgsqlProfile)
+		server = NewServer(kitlog.NewLogfmtLogger(GinkgoWriter), new(fakePauser), crm)
+	})
+
+	It("Migrates to the sync and promotes it", func() {
+		resp, err := server.Migrate(ctx, &MigrateRequest{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.MigratingTo).To(Equal("pg02"))
+		Expect(resp.Address).To(Equal("10.0.0.2"))
+		Eventually(func() string { return sim.Role(pacemaker.RoleMaster) }).Should(Equal("pg02"))
+		Eventually(func() string { return sim.Role(pacemaker.RoleSync) }).Should(Equal("pg03"))
+	})
+
+	It("Clears migration constraints on unmigrate", func() {
+		_, err := server.Migrate(ctx, &MigrateRequest{})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = server.Unmigrate(ctx, &Empty{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sim.Constraints()).To(BeEmpty())
+	})
+
+	It("Refuses to migrate with leftover constraints, unless forced", func() {
+		_, err := server.Migrate(ctx, &MigrateRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() string { return sim.Role(pacemaker.RoleMaster) }).Should(Equal("pg02"))
+
+		_, err = server.Migrate(ctx, &MigrateRequest{})
+		Expect(err).To(MatchError(MatchRegexp("resource has existing constraint cli-prefer-msPostgresql")))
+
+		_, err = server.Migrate(ctx, &MigrateRequest{Force: true})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Refuses to migrate during a pending transition", func() {
+		sim.SetControllerState("S_TRANSITION_ENGINE")
+
+		_, err := server.Migrate(ctx, &MigrateRequest{})
+		Expect(err).To(MatchError(MatchRegexp("controller pg01 is in state S_TRANSITION_ENGINE")))
+	})
+
+	Context("Without a sync node", func() {
+		BeforeEach(func() {
+			sim.SetRole("pg02", pacemaker.RoleAsync)
+		})
+
+		It("Refuses to migrate", func() {
+			_, err := server.Migrate(ctx, &MigrateRequest{})
+			Expect(err).To(MatchError(MatchRegexp("failed to find sync node")))
+		})
+	})
+
+	It("Replaces the sync when placed into standby", func() {
+		resp, err := server.Standby(ctx, &NodeRequest{Node: "pg02"})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Role).To(Equal("sync"))
+		Eventually(func() string { return sim.Role(pacemaker.RoleSync) }).Should(Equal("pg03"))
+
+		_, err = server.Unstandby(ctx, &NodeRequest{Node: "pg02"})
+
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() string { return sim.Role(pacemaker.RoleAsync) }).Should(Equal("pg02"))
+	})
+
+	It("Lists and clears leftover constraints", func() {
+		sim.AddConstraint("cli-ban-msPostgresql-on-pg01", "pg01")
+
+		resp, err := server.ListConstraints(ctx, &Empty{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Constraints).To(HaveLen(1))
+		Expect(resp.Constraints[0].Id).To(Equal("cli-ban-msPostgresql-on-pg01"))
+
+		resp, err = server.ClearConstraints(ctx, &Empty{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Constraints).To(HaveLen(1))
+		Expect(sim.Constraints()).To(BeEmpty())
+	})
+
+	It("Migrates with a constraint lifetime", func() {
+		_, err := server.Migrate(ctx, &MigrateRequest{Lifetime: 60})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := server.ListConstraints(ctx, &Empty{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Constraints).To(HaveLen(1))
+		Expect(resp.Constraints[0].Node).To(Equal("pg02"))
+		Expect(resp.Constraints[0].Expires).NotTo(BeEmpty())
+	})
+})
@@ -104,6 +104,9 @@ var _ = Describe("Server", func() {
 			resolveAddressErr   error
 			migrateTo           string
 			migrateErr          error
+			force               bool
+			problems            []string
+			precheckErr         error
 		}
 
 		var (
@@ -111,7 +114,7 @@ var _ = Describe("Server", func() {
 		)
 
 		BeforeEach(func() {
-			let = lets{}
+			let = lets{problems: []string{}}
 		})
 
 		subject := func() (*MigrateResponse, error) {
@@ -126,10 +129,14 @@ var _ = Describe("Server", func() {
 				Return(let.resolveAddressValue, let.resolveAddressErr)
 
 			crm.
-				On("Migrate", ctx, let.migrateTo).
+				On("Precheck", ctx, let.migrateTo).
+				Return(let.problems, let.precheckErr)
+
+			crm.
+				On("Migrate", ctx, let.migrateTo, 2*time.Minute).
 				Return(let.migrateErr)
 
-			return server.Migrate(ctx, &Empty{})
+			return server.Migrate(ctx, &MigrateRequest{Force: let.force, Lifetime: 120})
 		}
 
 		subjectErr := func() error {
@@ -196,6 +203,46 @@ var _ = Describe("Server", func() {
 			})
 		})
 
+		Context("When prechecks find problems", func() {
+			BeforeEach(func() {
+				let.crmSyncElement = createElement("pg03")
+				let.resolveAddressValue = "172.0.1.1"
+				let.migrateTo = "pg03"
+				let.problems = []string{"stonith is disabled", "node pg03 has fail-count-Postgresql=1"}
+			})
+
+			It("Fails with all problems", func() {
+				Expect(subjectErr()).To(
+					MatchError("rpc error: code = FailedPrecondition desc = refusing to migrate to pg03, use force to override: stonith is disabled; node pg03 has fail-count-Postgresql=1"),
+				)
+			})
+
+			Context("And migration is forced", func() {
+				BeforeEach(func() {
+					let.force = true
+				})
+
+				It("Succeeds", func() {
+					Expect(subjectErr()).NotTo(HaveOccurred())
+				})
+			})
+		})
+
+		Context("When prechecks fail to run", func() {
+			BeforeEach(func() {
+				let.crmSyncElement = createElement("pg03")
+				let.resolveAddressValue = "172.0.1.1"
+				let.migrateTo = "pg03"
+				let.precheckErr = errors.New("cibadmin: not in $PATH")
+			})
+
+			It("Fails", func() {
+				Expect(subjectErr()).To(
+					MatchError("rpc error: code = Unknown desc = failed to run prechecks: cibadmin: not in $PATH"),
+				)
+			})
+		})
+
 		Context("When crm migration fails", func() {
 			BeforeEach(func() {
 				let.crmSyncElement = createElement("pg03")
@@ -206,9 +253,199 @@ var _ = Describe("Server", func() {
 
 			It("Fails", func() {
 				Expect(subjectErr()).To(
-					MatchError("rpc error: code = Unknown desc = 'crm resource migrate pg03' failed: crm: not in $PATH"),
+					MatchError("rpc error: code = Unknown desc = failed to migrate to pg03: crm: not in $PATH"),
 				)
 			})
 		})
 	})
+
+	Describe("Standby", func() {
+		var topology *pacemaker.Topology
+
+		BeforeEach(func() {
+			topology = &pacemaker.Topology{
+				Quorate: true,
+				Nodes: []pacemaker.Node{
+					{Name: "pg01", Role: pacemaker.RoleMaster, Online: true},
+					{Name: "pg02", Role: pacemaker.RoleSync, Online: true},
+					{Name: "pg03", Role: pacemaker.RoleAsync, Online: true},
+				},
+			}
+		})
+
+		subject := func(node string) (*StandbyResponse, error) {
+			clock.On("Now").Return(time.Now())
+			crm.On("Topology", ctx).Return(topology, nil)
+			crm.On("Standby", ctx, node).Return(nil)
+
+			return server.Standby(ctx, &NodeRequest{Node: node})
+		}
+
+		It("Places async into standby", func() {
+			resp, err := subject("pg03")
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Role).To(Equal("async"))
+		})
+
+		It("Places sync into standby", func() {
+			resp, err := subject("pg02")
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Role).To(Equal("sync"))
+		})
+
+		It("Refuses to standby master", func() {
+			_, err := subject("pg01")
+			Expect(err).To(
+				MatchError("rpc error: code = FailedPrecondition desc = refusing to standby master pg01, failover first"),
+			)
+		})
+
+		It("Fails for unknown nodes", func() {
+			_, err := subject("pg04")
+			Expect(err).To(MatchError("rpc error: code = NotFound desc = failed to find node pg04"))
+		})
+
+		Context("When async is offline", func() {
+			BeforeEach(func() {
+				topology.Nodes[2].Online = false
+			})
+
+			It("Refuses to standby sync", func() {
+				_, err := subject("pg02")
+				Expect(err).To(
+					MatchError("rpc error: code = FailedPrecondition desc = refusing to standby sync pg02, no async to replace it"),
+				)
+			})
+		})
+
+		Context("When cluster is not quorate", func() {
+			BeforeEach(func() {
+				topology.Quorate = false
+			})
+
+			It("Fails", func() {
+				_, err := subject("pg03")
+				Expect(err).To(MatchError("rpc error: code = FailedPrecondition desc = cluster is not quorate"))
+			})
+		})
+	})
+
+	Describe("Restart", func() {
+		var topology *pacemaker.Topology
+
+		BeforeEach(func() {
+			topology = &pacemaker.Topology{
+				Quorate: true,
+				Nodes: []pacemaker.Node{
+					{Name: "pg01", Role: pacemaker.RoleMaster, Online: true},
+					{Name: "pg02", Role: pacemaker.RoleSync, Online: true},
+				},
+			}
+		})
+
+		subject := func(node string) error {
+			clock.On("Now").Return(time.Now())
+			crm.On("Topology", ctx).Return(topology, nil)
+			crm.On("Restart", ctx, node).Return(nil)
+
+			_, err := server.Restart(ctx, &NodeRequest{Node: node})
+			return err
+		}
+
+		It("Restarts replicas", func() {
+			Expect(subject("pg02")).To(Succeed())
+		})
+
+		It("Refuses to restart master", func() {
+			Expect(subject("pg01")).To(
+				MatchError("rpc error: code = FailedPrecondition desc = refusing to restart master pg01, failover first"),
+			)
+		})
+	})
+
+	Describe("Failures", func() {
+		It("Describes failed actions", func() {
+			clock.On("Now").Return(time.Now())
+			crm.On("Failures", ctx).Return(&pacemaker.Failures{
+				FailCounts: []pacemaker.FailCount{
+					{Node: "pg02", Resource: "Postgresql", Count: "INFINITY"},
+				},
+				FailedActions: []pacemaker.FailedAction{
+					{Node: "pg02", Resource: "Postgresql", Operation: "Postgresql_monitor_2000", RC: 7},
+				},
+			}, nil)
+
+			resp, err := server.Failures(ctx, &Empty{})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.FailCounts).To(
+				ConsistOf(PointTo(MatchFields(IgnoreExtras, Fields{
+					"Node":  Equal("pg02"),
+					"Count": Equal("INFINITY"),
+				}))),
+			)
+			Expect(resp.FailedActions).To(
+				ConsistOf(PointTo(MatchFields(IgnoreExtras, Fields{
+					"Operation":  Equal("Postgresql_monitor_2000"),
+					"Rc":         BeEquivalentTo(7),
+					"Result":     Equal("not running"),
+					"LastChange": BeNil(),
+				}))),
+			)
+		})
+	})
+
+	Describe("Cleanup", func() {
+		BeforeEach(func() {
+			crm.On("Topology", ctx).Return(&pacemaker.Topology{
+				Quorate: true,
+				Nodes:   []pacemaker.Node{{Name: "pg02", Role: pacemaker.RoleStopped}},
+			}, nil)
+		})
+
+		It("Cleans up the node", func() {
+			clock.On("Now").Return(time.Now())
+			crm.On("Cleanup", ctx, "pg02").Return(nil)
+
+			_, err := server.Cleanup(ctx, &NodeRequest{Node: "pg02"})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Fails for unknown nodes", func() {
+			_, err := server.Cleanup(ctx, &NodeRequest{Node: "pg04"})
+			Expect(err).To(MatchError("rpc error: code = NotFound desc = failed to find node pg04"))
+		})
+	})
+
+	Describe("ClearConstraints", func() {
+		It("Returns cleared constraints", func() {
+			clock.On("Now").Return(time.Now())
+			crm.On("ClearConstraints", ctx).Return([]pacemaker.Constraint{
+				{ID: "cli-prefer-msPostgresql", Resource: "msPostgresql", Node: "pg02", Score: "INFINITY"},
+			}, nil)
+
+			resp, err := server.ClearConstraints(ctx, &Empty{})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Constraints).To(
+				ConsistOf(PointTo(MatchFields(IgnoreExtras, Fields{
+					"Id":   Equal("cli-prefer-msPostgresql"),
+					"Node": Equal("pg02"),
+				}))),
+			)
+		})
+
+		It("Fails when constraints remain", func() {
+			crm.On("ClearConstraints", ctx).Return(
+				[]pacemaker.Constraint{}, errors.New("constraints remain after unmigrate: cli-ban-msPostgresql-on-pg01"),
+			)
+
+			_, err := server.ClearConstraints(ctx, &Empty{})
+			Expect(err).To(MatchError(
+				"rpc error: code = Unknown desc = failed to clear constraints: constraints remain after unmigrate: cli-ban-msPostgresql-on-pg01",
+			))
+		})
+	})
 })
@@ -0,0 +1,171 @@
+package pacemaker
+
+import (
+	"fmt"
+	"math"
+	"os/exec"
+	"time"
+)
+
+// Backend generates the command lines required to manipulate pacemaker resources. Each
+// distribution ships different tooling to talk to pacemaker, so we abstract over the
+// commands we need to run rather than assuming crmsh is available.
+//
+// Migrations with a non-zero lifetime create constraints that pacemaker will expire on
+// its own, should we fail to unmigrate.
+type Backend interface {
+	Name() string
+	MigrateCommand(resource, to string, lifetime time.Duration) []string
+	UnmigrateCommand(resource string) []string
+	StandbyCommand(node string) []string
+	UnstandbyCommand(node string) []string
+	RestartCommand(resource, node string) []string
+	CleanupCommand(resource, node string) []string
+}
+
+// Backends lists the available backends, in the order of preference used when
+// autodetecting which to use.
+var Backends = []Backend{CrmshBackend{}, PcsBackend{}, NativeBackend{}}
+
+// CrmshBackend uses the crm shell, commonly shipped with Debian based distributions
+type CrmshBackend struct{}
+
+func (b CrmshBackend) Name() string { return "crmsh" }
+
+func (b CrmshBackend) MigrateCommand(resource, to string, lifetime time.Duration) []string {
+	if lifetime > 0 {
+		return []string{"crm", "resource", "migrate", resource, to, iso8601(lifetime)}
+	}
+
+	return []string{"crm", "resource", "migrate", resource, to}
+}
+
+func (b CrmshBackend) UnmigrateCommand(resource string) []string {
+	return []string{"crm", "resource", "unmigrate", resource}
+}
+
+func (b CrmshBackend) StandbyCommand(node string) []string {
+	return []string{"crm", "node", "standby", node}
+}
+
+func (b CrmshBackend) UnstandbyCommand(node string) []string {
+	return []string{"crm", "node", "online", node}
+}
+
+// RestartCommand uses crm_resource, as crmsh can only restart a resource on all nodes
+func (b CrmshBackend) RestartCommand(resource, node string) []string {
+	return NativeBackend{}.RestartCommand(resource, node)
+}
+
+func (b CrmshBackend) CleanupCommand(resource, node string) []string {
+	return []string{"crm", "resource", "cleanup", resource, node}
+}
+
+// PcsBackend uses pcs, the pacemaker configuration tool shipped with RHEL-family
+// distributions.
+type PcsBackend struct{}
+
+func (b PcsBackend) Name() string { return "pcs" }
+
+func (b PcsBackend) MigrateCommand(resource, to string, lifetime time.Duration) []string {
+	if lifetime > 0 {
+		return []string{"pcs", "resource", "move", resource, to, "lifetime=" + iso8601(lifetime), "--master"}
+	}
+
+	return []string{"pcs", "resource", "move", resource, to, "--master"}
+}
+
+func (b PcsBackend) UnmigrateCommand(resource string) []string {
+	return []string{"pcs", "resource", "clear", resource}
+}
+
+func (b PcsBackend) StandbyCommand(node string) []string {
+	return []string{"pcs", "node", "standby", node}
+}
+
+func (b PcsBackend) UnstandbyCommand(node string) []string {
+	return []string{"pcs", "node", "unstandby", node}
+}
+
+func (b PcsBackend) RestartCommand(resource, node string) []string {
+	return []string{"pcs", "resource", "restart", resource, node}
+}
+
+func (b PcsBackend) CleanupCommand(resource, node string) []string {
+	return []string{"pcs", "resource", "cleanup", resource, "--node", node}
+}
+
+// NativeBackend uses the crm_resource tool that ships with pacemaker itself, and should be
+// available wherever pacemaker is installed.
+type NativeBackend struct{}
+
+func (b NativeBackend) Name() string { return "native" }
+
+func (b NativeBackend) MigrateCommand(resource, to string, lifetime time.Duration) []string {
+	command := []string{"crm_resource", "--move", "--master", "--resource", resource, "--node", to}
+	if lifetime > 0 {
+		command = append(command, "--lifetime", iso8601(lifetime))
+	}
+
+	return command
+}
+
+func (b NativeBackend) UnmigrateCommand(resource string) []string {
+	return []string{"crm_resource", "--clear", "--resource", resource}
+}
+
+func (b NativeBackend) StandbyCommand(node string) []string {
+	return []string{"crm_standby", "--node", node, "--update", "on"}
+}
+
+func (b NativeBackend) UnstandbyCommand(node string) []string {
+	return []string{"crm_standby", "--node", node, "--delete"}
+}
+
+func (b NativeBackend) RestartCommand(resource, node string) []string {
+	return []string{"crm_resource", "--restart", "--resource", resource, "--node", node}
+}
+
+func (b NativeBackend) CleanupCommand(resource, node string) []string {
+	return []string{"crm_resource", "--cleanup", "--resource", resource, "--node", node}
+}
+
+// iso8601 formats a duration as pacemaker expects, rounding up to the nearest second
+func iso8601(d time.Duration) string {
+	return fmt.Sprintf("PT%dS", int64(math.Ceil(d.Seconds())))
+}
+
+type UnknownBackendError string
+
+func (e UnknownBackendError) Error() string {
+	return fmt.Sprintf("unknown pacemaker backend: '%s'", string(e))
+}
+
+// NewBackend returns the backend with the given name. If the name is "auto", we select
+// the first backend with an executable present on the $PATH.
+func NewBackend(name string) (Backend, error) {
+	if name == "auto" {
+		return DetectBackend(exec.LookPath), nil
+	}
+
+	for _, backend := range Backends {
+		if backend.Name() == name {
+			return backend, nil
+		}
+	}
+
+	return nil, UnknownBackendError(name)
+}
+
+// DetectBackend finds the first backend for which lookPath can find an executable. As
+// crm_resource is shipped with pacemaker, we fallback to the native backend if no other
+// tools are found.
+func DetectBackend(lookPath func(string) (string, error)) Backend {
+	for _, backend := range Backends {
+		if _, err := lookPath(backend.UnmigrateCommand("")[0]); err == nil {
+			return backend
+		}
+	}
+
+	return NativeBackend{}
+}
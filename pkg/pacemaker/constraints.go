@@ -0,0 +1,129 @@
+package pacemaker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// Constraint is a location constraint created by the pacemaker command line tools, such
+// as those left behind by a migration. Their IDs are prefixed with cli-.
+type Constraint struct {
+	ID       string `json:"id"`
+	Resource string `json:"resource"`
+	Node     string `json:"node"`
+	Role     string `json:"role,omitempty"`
+	Score    string `json:"score"`
+	Expires  string `json:"expires,omitempty"` // empty if the constraint never expires
+}
+
+// ParseConstraints finds all cli- location constraints in the cib. Constraints created
+// with a lifetime express their node and score through a rule, rather than attributes.
+func ParseConstraints(doc *etree.Document) []Constraint {
+	constraints := []Constraint{}
+	for _, element := range doc.FindElements("//constraints/rsc_location") {
+		id := element.SelectAttrValue("id", "")
+		if !strings.HasPrefix(id, "cli-") {
+			continue
+		}
+
+		constraint := Constraint{
+			ID:       id,
+			Resource: element.SelectAttrValue("rsc", ""),
+			Node:     element.SelectAttrValue("node", ""),
+			Role:     element.SelectAttrValue("role", ""),
+			Score:    element.SelectAttrValue("score", ""),
+		}
+
+		if rule := element.SelectElement("rule"); rule != nil {
+			if constraint.Score == "" {
+				constraint.Score = rule.SelectAttrValue("score", "")
+			}
+
+			if expression := rule.FindElement("expression[@attribute='#uname']"); expression != nil && constraint.Node == "" {
+				constraint.Node = expression.SelectAttrValue("value", "")
+			}
+
+			if expiry := rule.FindElement("date_expression[@operation='lt']"); expiry != nil {
+				constraint.Expires = expiry.SelectAttrValue("end", "")
+			}
+		}
+
+		constraints = append(constraints, constraint)
+	}
+
+	return constraints
+}
+
+// Constraints returns all cli- location constraints in the cib
+func (p Pacemaker) Constraints(ctx context.Context) ([]Constraint, error) {
+	doc, err := p.Query(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseConstraints(doc), nil
+}
+
+// ClearConstraints removes all cli- location constraints from the cib, for any resource,
+// returning the constraints that were removed.
+func (p Pacemaker) ClearConstraints(ctx context.Context) ([]Constraint, error) {
+	constraints, err := p.Constraints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cleared := map[string]bool{}
+	for _, constraint := range constraints {
+		if cleared[constraint.Resource] {
+			continue
+		}
+
+		if err := p.run(ctx, p.Backend().UnmigrateCommand(constraint.Resource)); err != nil {
+			return nil, errors.Wrapf(err, "failed to clear constraints for %s", constraint.Resource)
+		}
+
+		if err := p.verifyCleared(ctx, constraint.Resource); err != nil {
+			return nil, err
+		}
+
+		cleared[constraint.Resource] = true
+	}
+
+	return constraints, nil
+}
+
+type ConstraintsRemainError []Constraint
+
+func (e ConstraintsRemainError) Error() string {
+	ids := []string{}
+	for _, constraint := range e {
+		ids = append(ids, constraint.ID)
+	}
+
+	return fmt.Sprintf("constraints remain after unmigrate: %s", strings.Join(ids, ", "))
+}
+
+// verifyCleared errors if any cli- constraints remain for the given resource
+func (p Pacemaker) verifyCleared(ctx context.Context, resource string) error {
+	constraints, err := p.Constraints(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to verify constraints were removed")
+	}
+
+	remaining := ConstraintsRemainError{}
+	for _, constraint := range constraints {
+		if constraint.Resource == resource {
+			remaining = append(remaining, constraint)
+		}
+	}
+
+	if len(remaining) > 0 {
+		return remaining
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package pacemaker
+
+import (
+	"io/ioutil"
+
+	"github.com/beevik/etree"
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseConstraints", func() {
+	It("Parses cli constraints, ignoring others", func() {
+		content, err := ioutil.ReadFile("./testdata/cib_leftover_constraints.xml")
+		Expect(err).NotTo(HaveOccurred())
+
+		doc := etree.NewDocument()
+		Expect(doc.ReadFromBytes(content)).To(Succeed())
+
+		Expect(ParseConstraints(doc)).To(
+			Equal([]Constraint{
+				{
+					ID:       "cli-prefer-msPostgresql",
+					Resource: "msPostgresql",
+					Node:     "pg03",
+					Role:     "Master",
+					Score:    "INFINITY",
+					Expires:  "2018-09-19 11:45:06Z",
+				},
+				{
+					ID:       "cli-ban-msPostgresql-on-pg01",
+					Resource: "msPostgresql",
+					Node:     "pg01",
+					Role:     "Started",
+					Score:    "-INFINITY",
+				},
+			}),
+		)
+	})
+})
+
+var _ = Describe("Constraint removal", func() {
+	var (
+		ctx      = context.Background()
+		crm      *Pacemaker
+		executor *fakeExecutor
+	)
+
+	cib := func(fixture string) {
+		content, err := ioutil.ReadFile(fixture)
+		Expect(err).NotTo(HaveOccurred())
+
+		executor.On("CombinedOutput", ctx, "cibadmin", queryArgs).Return(content, nil).Once()
+	}
+
+	BeforeEach(func() {
+		executor = new(fakeExecutor)
+		crm = &Pacemaker{executor: executor}
+
+		executor.
+			On("CombinedOutput", ctx, "crm", []string{"resource", "unmigrate", "msPostgresql"}).
+			Return([]byte(""), nil)
+	})
+
+	Describe("Unmigrate", func() {
+		It("Succeeds when constraints are removed", func() {
+			cib("./testdata/cib_async_master_sync.xml")
+			Expect(crm.Unmigrate(ctx)).To(Succeed())
+		})
+
+		It("Fails when constraints remain", func() {
+			cib("./testdata/cib_leftover_constraints.xml")
+			Expect(crm.Unmigrate(ctx)).To(
+				MatchError("constraints remain after unmigrate: cli-prefer-msPostgresql, cli-ban-msPostgresql-on-pg01"),
+			)
+		})
+	})
+
+	Describe("ClearConstraints", func() {
+		It("Returns cleared constraints", func() {
+			cib("./testdata/cib_leftover_constraints.xml")
+			cib("./testdata/cib_async_master_sync.xml")
+
+			constraints, err := crm.ClearConstraints(ctx)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(constraints).To(HaveLen(2))
+		})
+	})
+})
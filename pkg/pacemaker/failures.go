@@ -0,0 +1,150 @@
+package pacemaker
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// Failures summarises resource failures recorded in the cib, equivalent to the fail
+// counts and failed actions reported by crm_mon -Afr. Fail counts will prevent a node
+// from running a resource once they reach the migration-threshold, and remain until the
+// resource is cleaned up.
+type Failures struct {
+	FailCounts    []FailCount    `json:"fail_counts"`
+	FailedActions []FailedAction `json:"failed_actions"`
+}
+
+type FailCount struct {
+	Node      string `json:"node"`
+	Resource  string `json:"resource"`
+	Operation string `json:"operation,omitempty"` // set by pacemaker >= 1.1.17
+	Count     string `json:"count"`               // may be INFINITY
+}
+
+type FailedAction struct {
+	Node       string    `json:"node"`
+	Resource   string    `json:"resource"`
+	Operation  string    `json:"operation"`
+	RC         int       `json:"rc"`
+	Status     int       `json:"status"`
+	ExitReason string    `json:"exit_reason,omitempty"`
+	LastChange time.Time `json:"last_change"`
+}
+
+// Result describes the OCF return code of the action, as displayed by crm_mon
+func (a FailedAction) Result() string {
+	if result, ok := ocfResults[a.RC]; ok {
+		return result
+	}
+
+	return "unknown"
+}
+
+var ocfResults = map[int]string{
+	0: "ok",
+	1: "unknown error",
+	2: "invalid parameter",
+	3: "unimplemented feature",
+	4: "insufficient privileges",
+	5: "not installed",
+	6: "not configured",
+	7: "not running",
+	8: "master",
+	9: "master (failed)",
+}
+
+// Failures returns the fail counts and failed actions for every node in the cib
+func (p Pacemaker) Failures(ctx context.Context) (*Failures, error) {
+	doc, err := p.Query(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseFailures(doc), nil
+}
+
+// Cleanup clears the failure history of the Postgres resource on the given node,
+// allowing pacemaker to run it there again.
+func (p Pacemaker) Cleanup(ctx context.Context, node string) error {
+	if err := p.run(ctx, p.Backend().CleanupCommand(p.Profile().Resource, node)); err != nil {
+		return errors.Wrap(err, "failed to execute resource cleanup")
+	}
+
+	return nil
+}
+
+// ParseFailures extracts failures from the node status section of the cib. Pacemaker
+// records the most recent failure of each resource as a _last_failure_0 operation, which
+// is what crm_mon reports as a failed action.
+func ParseFailures(doc *etree.Document) *Failures {
+	failures := &Failures{FailCounts: []FailCount{}, FailedActions: []FailedAction{}}
+
+	for _, state := range doc.FindElements("//status/node_state") {
+		node := state.SelectAttrValue("uname", "")
+
+		transient := collectAttributes(state, "transient_attributes/instance_attributes/nvpair")
+		for _, name := range sortedKeys(transient) {
+			if !strings.HasPrefix(name, "fail-count-") || transient[name] == "0" {
+				continue
+			}
+
+			// Newer pacemakers track fail counts per operation, as fail-count-rsc#op_interval
+			resource := strings.TrimPrefix(name, "fail-count-")
+			operation := ""
+			if idx := strings.Index(resource, "#"); idx >= 0 {
+				resource, operation = resource[:idx], resource[idx+1:]
+			}
+
+			failures.FailCounts = append(failures.FailCounts, FailCount{
+				Node:      node,
+				Resource:  resource,
+				Operation: operation,
+				Count:     transient[name],
+			})
+		}
+
+		for _, op := range state.FindElements("lrm/lrm_resources/lrm_resource/lrm_rsc_op") {
+			if !strings.HasSuffix(op.SelectAttrValue("id", ""), "_last_failure_0") {
+				continue
+			}
+
+			action := FailedAction{
+				Node:       node,
+				Resource:   op.Parent().SelectAttrValue("id", ""),
+				Operation:  op.SelectAttrValue("operation_key", ""),
+				RC:         atoi(op.SelectAttrValue("rc-code", "")),
+				Status:     atoi(op.SelectAttrValue("op-status", "")),
+				ExitReason: op.SelectAttrValue("exit-reason", ""),
+			}
+
+			if changed := atoi(op.SelectAttrValue("last-rc-change", "")); changed > 0 {
+				action.LastChange = time.Unix(int64(changed), 0).UTC()
+			}
+
+			// Probes that find the resource already running are recorded as failures, as the
+			// result differs from that expected, but crm_mon doesn't consider them failed.
+			if isProbe(op) && action.Status == 0 && (action.RC == 0 || action.RC == 8) {
+				continue
+			}
+
+			failures.FailedActions = append(failures.FailedActions, action)
+		}
+	}
+
+	return failures
+}
+
+func isProbe(op *etree.Element) bool {
+	return op.SelectAttrValue("operation", "") == "monitor" && op.SelectAttrValue("interval", "") == "0"
+}
+
+// atoi parses cib integers, treating anything unparseable as zero
+func atoi(value string) int {
+	i, _ := strconv.Atoi(value)
+	return i
+}
@@ -0,0 +1,76 @@
+package pacemaker
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/beevik/etree"
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseFailures", func() {
+	parse := func(fixture string) *Failures {
+		content, err := ioutil.ReadFile(fixture)
+		Expect(err).NotTo(HaveOccurred())
+
+		doc := etree.NewDocument()
+		Expect(doc.ReadFromBytes(content)).To(Succeed())
+
+		return ParseFailures(doc)
+	}
+
+	It("Parses fail counts and failed actions", func() {
+		failures := parse("./testdata/cib_master_died_died.xml")
+
+		Expect(failures.FailCounts).To(Equal([]FailCount{
+			{Node: "pg03", Resource: "Postgresql", Count: "1"},
+			{Node: "pg02", Resource: "Postgresql", Count: "1"},
+		}))
+
+		Expect(failures.FailedActions).To(HaveLen(2))
+		Expect(failures.FailedActions[0]).To(Equal(FailedAction{
+			Node:       "pg03",
+			Resource:   "Postgresql",
+			Operation:  "Postgresql_monitor_2000",
+			RC:         7,
+			Status:     0,
+			LastChange: time.Unix(1506185689, 0).UTC(),
+		}))
+		Expect(failures.FailedActions[0].Result()).To(Equal("not running"))
+	})
+
+	It("Ignores probes that found the resource running", func() {
+		failures := parse("./testdata/cib_async_master_sync.xml")
+
+		Expect(failures.FailCounts).To(BeEmpty())
+		Expect(failures.FailedActions).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Cleanup", func() {
+	var (
+		ctx      context.Context
+		executor *fakeExecutor
+		crm      *Pacemaker
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		executor = new(fakeExecutor)
+		crm = NewPacemaker(executor, nil, PgsqlProfile)
+	})
+
+	It("Cleans up the resource on the node", func() {
+		executor.On("CombinedOutput", ctx, "crm", []string{"resource", "cleanup", "msPostgresql", "pg02"}).Return([]byte(""), nil)
+		Expect(crm.Cleanup(ctx, "pg02")).To(Succeed())
+	})
+
+	It("Uses crm_resource with the native backend", func() {
+		crm.backend = NativeBackend{}
+		executor.On("CombinedOutput", ctx, "crm_resource", []string{"--cleanup", "--resource", "msPostgresql", "--node", "pg02"}).Return([]byte(""), nil)
+		Expect(crm.Cleanup(ctx, "pg02")).To(Succeed())
+	})
+})
@@ -5,6 +5,7 @@ import (
 	"os/exec"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"golang.org/x/net/context"
@@ -12,16 +13,21 @@ import (
 	"github.com/beevik/etree"
 )
 
+// XPaths that select nodes of each role, when using the default pgsql profile
 var (
-	MasterXPath = "//node/instance_attributes/nvpair[@value='LATEST']/../.."
-	SyncXPath   = "//node/instance_attributes/nvpair[@value='STREAMING|SYNC']/../.."
-	AsyncXPath  = "//node/instance_attributes/nvpair[@value='STREAMING|POTENTIAL']/../.."
+	MasterXPath = PgsqlProfile.MasterXPath()
+	SyncXPath   = PgsqlProfile.SyncXPath()
+	AsyncXPath  = PgsqlProfile.AsyncXPath()
 )
 
 // Pacemaker wraps the executables provided by pacemaker, providing querying of the cib as
 // well as running commands against crm.
 type Pacemaker struct {
 	executor
+	backend  Backend
+	profile  Profile
+	resolver Resolver
+	family   AddressFamily
 }
 
 type executor interface {
@@ -34,12 +40,23 @@ func (e systemExecutor) CombinedOutput(ctx context.Context, name string, args ..
 	return exec.CommandContext(ctx, name, args...).CombinedOutput()
 }
 
-func NewPacemaker(exec executor) *Pacemaker {
+func NewPacemaker(exec executor, backend Backend, profile Profile) *Pacemaker {
 	if exec == nil {
 		exec = systemExecutor{}
 	}
 
-	return &Pacemaker{exec}
+	if backend == nil {
+		backend = CrmshBackend{}
+	}
+
+	return &Pacemaker{executor: exec, backend: backend, profile: profile}
+}
+
+// WithResolver configures how node addresses are resolved, replacing the default of the
+// first address reported by corosync.
+func (p *Pacemaker) WithResolver(resolver Resolver, family AddressFamily) *Pacemaker {
+	p.resolver, p.family = resolver, family
+	return p
 }
 
 type NoQuorumError struct{}
@@ -53,20 +70,15 @@ func (e NoQuorumError) Error() string {
 // on values being correct with respect to the quorate.
 func (p Pacemaker) Get(ctx context.Context, xpaths ...string) ([]*etree.Element, error) {
 	nodes := make([]*etree.Element, 0)
-	xmlOutput, err := p.CombinedOutput(ctx, "cibadmin", "--query", "--local")
+	doc, err := p.Query(ctx)
 
 	if err != nil {
 		return nil, err
 	}
 
-	doc := etree.NewDocument()
-	if err := doc.ReadFromBytes(xmlOutput); err != nil {
-		return nil, err
-	}
-
 	// We don't want to be returning values if we don't have quorum. Those values would only
 	// ever be invalid to act upon.
-	if doc.FindElement("cib[@have-quorum='1']") == nil {
+	if !quorate(doc) {
 		return nil, NoQuorumError{}
 	}
 
@@ -77,6 +89,63 @@ func (p Pacemaker) Get(ctx context.Context, xpaths ...string) ([]*etree.Element,
 	return nodes, nil
 }
 
+// Query parses the output of cibadmin into an XML document
+func (p Pacemaker) Query(ctx context.Context) (*etree.Document, error) {
+	xmlOutput, err := p.CombinedOutput(ctx, "cibadmin", "--query", "--local")
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(xmlOutput); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// Version identifies a revision of the cib. Pacemaker increments these counters whenever
+// the cib is modified, so an unchanged version implies unchanged cib contents.
+type Version struct {
+	AdminEpoch, Epoch, NumUpdates string
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%s.%s.%s", v.AdminEpoch, v.Epoch, v.NumUpdates)
+}
+
+// Version queries only the root cib element, which is far cheaper than querying the
+// entire cib. This can be used to detect whether the cib has changed before performing a
+// full query.
+func (p Pacemaker) Version(ctx context.Context) (Version, error) {
+	xmlOutput, err := p.CombinedOutput(ctx, "cibadmin", "--query", "--local", "--xpath", "/cib", "--no-children")
+
+	if err != nil {
+		return Version{}, err
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(xmlOutput); err != nil {
+		return Version{}, err
+	}
+
+	cib := doc.SelectElement("cib")
+	if cib == nil {
+		return Version{}, fmt.Errorf("cibadmin returned no cib element")
+	}
+
+	return Version{
+		AdminEpoch: cib.SelectAttrValue("admin_epoch", ""),
+		Epoch:      cib.SelectAttrValue("epoch", ""),
+		NumUpdates: cib.SelectAttrValue("num_updates", ""),
+	}, nil
+}
+
+func quorate(doc *etree.Document) bool {
+	return doc.FindElement("cib[@have-quorum='1']") != nil
+}
+
 type InvalidNodeIDError string
 
 func (e InvalidNodeIDError) Error() string {
@@ -91,33 +160,105 @@ func (p Pacemaker) ResolveAddress(ctx context.Context, nodeID string) (string, e
 		return "", InvalidNodeIDError(nodeID)
 	}
 
-	output, err := p.CombinedOutput(ctx, "corosync-cfgtool", "-a", nodeID)
+	resolver, family := p.resolver, p.family
+	if resolver == nil {
+		resolver = CorosyncResolver{Ring: -1}
+	}
+
+	if family == "" {
+		family = AddressFamilyAny
+	}
+
+	chain, ok := resolver.(ChainResolver)
+	if !ok {
+		chain = ChainResolver{resolver}
+	}
+
+	return chain.selectAddress(ctx, p, nodeID, family)
+}
 
+// LocalNode returns the name of the node we're running on, as known to pacemaker
+func (p Pacemaker) LocalNode(ctx context.Context) (string, error) {
+	output, err := p.CombinedOutput(ctx, "crm_node", "--name")
 	if err != nil {
-		return "", errors.Wrap(err, "failed to run corosync-cfgtool")
+		return "", errors.Wrapf(err, "failed to run crm_node: %s", strings.TrimSpace(string(output)))
 	}
 
 	return strings.TrimSpace(string(output)), nil
 }
 
-// Migrate will issue a resource migration of msPostgresql to the given node
-func (p Pacemaker) Migrate(ctx context.Context, to string) error {
-	_, err := p.CombinedOutput(ctx, "crm", "resource", "migrate", "msPostgresql", to)
+// Backend returns the backend used to generate pacemaker commands, defaulting to crmsh
+func (p Pacemaker) Backend() Backend {
+	if p.backend == nil {
+		return CrmshBackend{}
+	}
 
-	if err != nil {
-		return errors.Wrap(err, "failed to execute crm migration")
+	return p.backend
+}
+
+// Profile returns the resource agent profile, defaulting to the bundled pgsql agent
+func (p Pacemaker) Profile() Profile {
+	if p.profile.Resource == "" {
+		return PgsqlProfile
 	}
 
-	return err
+	return p.profile
 }
 
-// Unmigrate will remove constraints previously created by migrate
+// Migrate will issue a migration of the Postgres resource to the given node. If lifetime
+// is non-zero, pacemaker will remove the migration constraint once it has elapsed.
+func (p Pacemaker) Migrate(ctx context.Context, to string, lifetime time.Duration) error {
+	if err := p.run(ctx, p.Backend().MigrateCommand(p.Profile().Resource, to, lifetime)); err != nil {
+		return errors.Wrap(err, "failed to execute resource migration")
+	}
+
+	return nil
+}
+
+// Unmigrate will remove constraints previously created by migrate. We've seen the tools
+// exit successfully without removing constraints, so we verify none remain.
 func (p Pacemaker) Unmigrate(ctx context.Context) error {
-	_, err := p.CombinedOutput(ctx, "crm", "resource", "unmigrate", "msPostgresql")
+	if err := p.run(ctx, p.Backend().UnmigrateCommand(p.Profile().Resource)); err != nil {
+		return errors.Wrap(err, "failed to execute resource unmigrate")
+	}
+
+	return p.verifyCleared(ctx, p.Profile().Resource)
+}
+
+// Standby puts the given node into standby, causing pacemaker to stop all resources on it
+func (p Pacemaker) Standby(ctx context.Context, node string) error {
+	if err := p.run(ctx, p.Backend().StandbyCommand(node)); err != nil {
+		return errors.Wrap(err, "failed to execute node standby")
+	}
+
+	return nil
+}
+
+// Unstandby brings a node out of standby, allowing it to run resources again
+func (p Pacemaker) Unstandby(ctx context.Context, node string) error {
+	if err := p.run(ctx, p.Backend().UnstandbyCommand(node)); err != nil {
+		return errors.Wrap(err, "failed to execute node unstandby")
+	}
+
+	return nil
+}
+
+// Restart restarts the Postgres resource on a single node
+func (p Pacemaker) Restart(ctx context.Context, node string) error {
+	if err := p.run(ctx, p.Backend().RestartCommand(p.Profile().Resource, node)); err != nil {
+		return errors.Wrap(err, "failed to execute resource restart")
+	}
+
+	return nil
+}
 
+// run executes the given command line, including the command output in any error to
+// help explain why the pacemaker tools failed.
+func (p Pacemaker) run(ctx context.Context, command []string) error {
+	output, err := p.CombinedOutput(ctx, command[0], command[1:]...)
 	if err != nil {
-		return errors.Wrap(err, "failed to execute crm resource unmigrate")
+		return errors.Wrapf(err, "%s: %s", strings.Join(command, " "), strings.TrimSpace(string(output)))
 	}
 
-	return err
+	return nil
 }
@@ -3,6 +3,7 @@ package pacemaker
 import (
 	"fmt"
 	"io/ioutil"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -64,6 +65,28 @@ var _ = Describe("Pacemaker", func() {
 			})
 		})
 
+		Context("With PAF resource agent", func() {
+			BeforeEach(func() {
+				loadFixture("./testdata/cib_paf_sync_async_master.xml", nil)
+			})
+
+			It("Finds master", func() {
+				Expect(get(PAFProfile.MasterXPath(), "uname")).To(Equal("pg03"))
+			})
+
+			It("Finds sync", func() {
+				Expect(get(PAFProfile.SyncXPath(), "uname")).To(Equal("pg01"))
+			})
+
+			It("Finds async", func() {
+				Expect(get(PAFProfile.AsyncXPath(), "uname")).To(Equal("pg02"))
+			})
+
+			It("Returns node IDs", func() {
+				Expect(get(PAFProfile.MasterXPath(), "id")).To(Equal("3"))
+			})
+		})
+
 		Context("With no quorum", func() {
 			BeforeEach(func() {
 				loadFixture("./testdata/cib_master_died_died.xml", nil)
@@ -123,6 +146,207 @@ var _ = Describe("Pacemaker", func() {
 			})
 		})
 	})
+
+	Describe("Migrate", func() {
+		expectCommand := func(name string, args ...string) {
+			executor.On("CombinedOutput", ctx, name, args).Return([]byte(""), nil)
+		}
+
+		Context("With default backend", func() {
+			BeforeEach(func() {
+				expectCommand("crm", "resource", "migrate", "msPostgresql", "pg02")
+			})
+
+			It("Uses crmsh", func() {
+				Expect(crm.Migrate(ctx, "pg02", 0)).To(Succeed())
+			})
+		})
+
+		Context("With PAF profile", func() {
+			BeforeEach(func() {
+				crm.profile = PAFProfile
+				expectCommand("crm", "resource", "migrate", "pgsql-ha", "pg02")
+			})
+
+			It("Migrates profile resource", func() {
+				Expect(crm.Migrate(ctx, "pg02", 0)).To(Succeed())
+			})
+		})
+
+		Context("With pcs backend", func() {
+			BeforeEach(func() {
+				crm.backend = PcsBackend{}
+				expectCommand("pcs", "resource", "move", "msPostgresql", "pg02", "--master")
+			})
+
+			It("Uses pcs", func() {
+				Expect(crm.Migrate(ctx, "pg02", 0)).To(Succeed())
+			})
+		})
+
+		Context("With native backend", func() {
+			BeforeEach(func() {
+				crm.backend = NativeBackend{}
+				expectCommand("crm_resource", "--move", "--master", "--resource", "msPostgresql", "--node", "pg02")
+			})
+
+			It("Uses crm_resource", func() {
+				Expect(crm.Migrate(ctx, "pg02", 0)).To(Succeed())
+			})
+		})
+
+		Context("With lifetime", func() {
+			It("Passes lifetime to crmsh", func() {
+				expectCommand("crm", "resource", "migrate", "msPostgresql", "pg02", "PT90S")
+				Expect(crm.Migrate(ctx, "pg02", 90*time.Second)).To(Succeed())
+			})
+
+			It("Passes lifetime to pcs", func() {
+				crm.backend = PcsBackend{}
+				expectCommand("pcs", "resource", "move", "msPostgresql", "pg02", "lifetime=PT90S", "--master")
+				Expect(crm.Migrate(ctx, "pg02", 90*time.Second)).To(Succeed())
+			})
+
+			It("Passes lifetime to crm_resource, rounding up", func() {
+				crm.backend = NativeBackend{}
+				expectCommand("crm_resource", "--move", "--master", "--resource", "msPostgresql", "--node", "pg02", "--lifetime", "PT2S")
+				Expect(crm.Migrate(ctx, "pg02", 1500*time.Millisecond)).To(Succeed())
+			})
+		})
+
+		Context("When command fails", func() {
+			BeforeEach(func() {
+				executor.
+					On("CombinedOutput", ctx, "crm", []string{"resource", "migrate", "msPostgresql", "pg02"}).
+					Return([]byte("ERROR: resource msPostgresql does not exist\n"), fmt.Errorf("exit status 1"))
+			})
+
+			It("Returns error including output", func() {
+				Expect(crm.Migrate(ctx, "pg02", 0)).To(
+					MatchError(MatchRegexp("ERROR: resource msPostgresql does not exist")),
+				)
+			})
+		})
+	})
+
+	Describe("Standby", func() {
+		expectCommand := func(name string, args ...string) {
+			executor.On("CombinedOutput", ctx, name, args).Return([]byte(""), nil)
+		}
+
+		Context("With default backend", func() {
+			BeforeEach(func() {
+				expectCommand("crm", "node", "standby", "pg02")
+				expectCommand("crm", "node", "online", "pg02")
+			})
+
+			It("Uses crmsh", func() {
+				Expect(crm.Standby(ctx, "pg02")).To(Succeed())
+				Expect(crm.Unstandby(ctx, "pg02")).To(Succeed())
+			})
+		})
+
+		Context("With pcs backend", func() {
+			BeforeEach(func() {
+				crm.backend = PcsBackend{}
+				expectCommand("pcs", "node", "standby", "pg02")
+				expectCommand("pcs", "node", "unstandby", "pg02")
+			})
+
+			It("Uses pcs", func() {
+				Expect(crm.Standby(ctx, "pg02")).To(Succeed())
+				Expect(crm.Unstandby(ctx, "pg02")).To(Succeed())
+			})
+		})
+
+		Context("With native backend", func() {
+			BeforeEach(func() {
+				crm.backend = NativeBackend{}
+				expectCommand("crm_standby", "--node", "pg02", "--update", "on")
+				expectCommand("crm_standby", "--node", "pg02", "--delete")
+			})
+
+			It("Uses crm_standby", func() {
+				Expect(crm.Standby(ctx, "pg02")).To(Succeed())
+				Expect(crm.Unstandby(ctx, "pg02")).To(Succeed())
+			})
+		})
+	})
+
+	Describe("Restart", func() {
+		expectCommand := func(name string, args ...string) {
+			executor.On("CombinedOutput", ctx, name, args).Return([]byte(""), nil)
+		}
+
+		Context("With default backend", func() {
+			BeforeEach(func() {
+				expectCommand("crm_resource", "--restart", "--resource", "msPostgresql", "--node", "pg02")
+			})
+
+			It("Uses crm_resource", func() {
+				Expect(crm.Restart(ctx, "pg02")).To(Succeed())
+			})
+		})
+
+		Context("With pcs backend", func() {
+			BeforeEach(func() {
+				crm.backend = PcsBackend{}
+				expectCommand("pcs", "resource", "restart", "msPostgresql", "pg02")
+			})
+
+			It("Uses pcs", func() {
+				Expect(crm.Restart(ctx, "pg02")).To(Succeed())
+			})
+		})
+	})
+})
+
+var _ = Describe("NewProfile", func() {
+	It("Returns profile by name", func() {
+		Expect(NewProfile("paf")).To(Equal(PAFProfile))
+	})
+
+	It("Fails for unknown profile", func() {
+		_, err := NewProfile("repmgr")
+		Expect(err).To(MatchError(UnknownProfileError("repmgr")))
+	})
+})
+
+var _ = Describe("NewBackend", func() {
+	It("Returns backend by name", func() {
+		Expect(NewBackend("pcs")).To(Equal(PcsBackend{}))
+	})
+
+	It("Fails for unknown backend", func() {
+		_, err := NewBackend("yast")
+		Expect(err).To(MatchError(UnknownBackendError("yast")))
+	})
+})
+
+var _ = Describe("DetectBackend", func() {
+	lookPath := func(available ...string) func(string) (string, error) {
+		return func(file string) (string, error) {
+			for _, candidate := range available {
+				if candidate == file {
+					return "/usr/sbin/" + file, nil
+				}
+			}
+
+			return "", fmt.Errorf("exec: \"%s\": executable file not found in $PATH", file)
+		}
+	}
+
+	It("Prefers crmsh", func() {
+		Expect(DetectBackend(lookPath("crm", "pcs", "crm_resource"))).To(Equal(CrmshBackend{}))
+	})
+
+	It("Finds pcs when crmsh is missing", func() {
+		Expect(DetectBackend(lookPath("pcs", "crm_resource"))).To(Equal(PcsBackend{}))
+	})
+
+	It("Falls back to native", func() {
+		Expect(DetectBackend(lookPath())).To(Equal(NativeBackend{}))
+	})
 })
 
 type fakeExecutor struct{ mock.Mock }
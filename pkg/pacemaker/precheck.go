@@ -0,0 +1,174 @@
+package pacemaker
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+	"golang.org/x/net/context"
+)
+
+// Precheck inspects the cluster for conditions that would make migrating the Postgres
+// resource to target unsafe, returning a description of each problem found. Migrating in
+// these conditions can fail outright or, worse, silently do nothing.
+func (p Pacemaker) Precheck(ctx context.Context, target string) ([]string, error) {
+	doc, err := p.Query(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := Precheck(doc, p.Profile(), target)
+
+	dc := designatedController(doc)
+	if dc == "" {
+		return append(problems, "cluster has no designated controller"), nil
+	}
+
+	state, err := p.ControllerState(ctx, dc)
+	if err != nil {
+		return append(problems, fmt.Sprintf("failed to query state of controller %s: %s", dc, err.Error())), nil
+	}
+
+	if state != "S_IDLE" {
+		problems = append(problems, fmt.Sprintf("controller %s is in state %s, a transition is pending", dc, state))
+	}
+
+	return problems, nil
+}
+
+// Precheck performs the checks that can be made against the cib alone
+func Precheck(doc *etree.Document, profile Profile, target string) []string {
+	problems := []string{}
+
+	for _, constraint := range doc.FindElements("//constraints/rsc_location") {
+		id := constraint.SelectAttrValue("id", "")
+		if constraint.SelectAttrValue("rsc", "") != profile.Resource {
+			continue
+		}
+
+		if strings.HasPrefix(id, "cli-prefer-") || strings.HasPrefix(id, "cli-ban-") {
+			problems = append(problems, fmt.Sprintf("resource has existing constraint %s", id))
+		}
+	}
+
+	if isFalse(clusterProperty(doc, "stonith-enabled")) {
+		problems = append(problems, "stonith is disabled")
+	}
+
+	if isTrue(clusterProperty(doc, "maintenance-mode")) {
+		problems = append(problems, "cluster is in maintenance mode")
+	}
+
+	resource := doc.FindElement(fmt.Sprintf("//resources/*[@id='%s']", profile.Resource))
+	if resource == nil {
+		problems = append(problems, fmt.Sprintf("resource %s does not exist", profile.Resource))
+	} else {
+		meta := collectAttributes(resource, "meta_attributes/nvpair")
+		if isFalse(meta["is-managed"]) || isTrue(meta["maintenance"]) {
+			problems = append(problems, fmt.Sprintf("resource %s is unmanaged", profile.Resource))
+		}
+	}
+
+	// Nodes that have unexpectedly left the cluster remain unclean until they are fenced,
+	// at which point pacemaker will mark them as expected to be down.
+	for _, state := range doc.FindElements("//status/node_state") {
+		if state.SelectAttrValue("in_ccm", "") == "false" && state.SelectAttrValue("expected", "") == "member" {
+			problems = append(problems, fmt.Sprintf("node %s is unclean, awaiting fencing", state.SelectAttrValue("uname", "")))
+		}
+	}
+
+	node := doc.FindElement(fmt.Sprintf("//configuration/nodes/node[@uname='%s']", target))
+	if node == nil {
+		problems = append(problems, fmt.Sprintf("node %s does not exist", target))
+	} else if isTrue(collectAttributes(node, "instance_attributes/nvpair")["maintenance"]) {
+		problems = append(problems, fmt.Sprintf("node %s is in maintenance mode", target))
+	}
+
+	state := doc.FindElement(fmt.Sprintf("//status/node_state[@uname='%s']", target))
+	if state != nil {
+		transient := collectAttributes(state, "transient_attributes/instance_attributes/nvpair")
+		for _, name := range sortedKeys(transient) {
+			if strings.HasPrefix(name, "fail-count-") && transient[name] != "0" {
+				problems = append(problems, fmt.Sprintf("node %s has %s=%s", target, name, transient[name]))
+			}
+		}
+	}
+
+	return problems
+}
+
+// ControllerState returns the state of the pacemaker controller on the given node, which
+// will be S_IDLE when no transition is in progress.
+func (p Pacemaker) ControllerState(ctx context.Context, node string) (string, error) {
+	output, err := p.CombinedOutput(ctx, "crmadmin", "--status", node)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", err.Error(), strings.TrimSpace(string(output)))
+	}
+
+	state := regexp.MustCompile(`S_[A-Z_]+`).FindString(string(output))
+	if state == "" {
+		return "", fmt.Errorf("failed to parse crmadmin output: %s", strings.TrimSpace(string(output)))
+	}
+
+	return state, nil
+}
+
+// designatedController returns the uname of the DC, or an empty string if there is none
+func designatedController(doc *etree.Document) string {
+	cib := doc.SelectElement("cib")
+	if cib == nil {
+		return ""
+	}
+
+	id := cib.SelectAttrValue("dc-uuid", "")
+	if id == "" {
+		return ""
+	}
+
+	if node := doc.FindElement(fmt.Sprintf("//configuration/nodes/node[@id='%s']", id)); node != nil {
+		return node.SelectAttrValue("uname", "")
+	}
+
+	return ""
+}
+
+func clusterProperty(doc *etree.Document, name string) string {
+	nvpair := doc.FindElement(fmt.Sprintf("//crm_config/cluster_property_set/nvpair[@name='%s']", name))
+	if nvpair == nil {
+		return ""
+	}
+
+	return nvpair.SelectAttrValue("value", "")
+}
+
+func sortedKeys(attributes map[string]string) []string {
+	keys := []string{}
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// isTrue and isFalse parse pacemaker booleans, which accept several spellings. An empty
+// value is neither true nor false, leaving pacemaker to apply its default.
+func isTrue(value string) bool {
+	switch strings.ToLower(value) {
+	case "true", "on", "yes", "y", "1":
+		return true
+	}
+
+	return false
+}
+
+func isFalse(value string) bool {
+	switch strings.ToLower(value) {
+	case "false", "off", "no", "n", "0":
+		return true
+	}
+
+	return false
+}
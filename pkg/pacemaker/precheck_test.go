@@ -0,0 +1,134 @@
+package pacemaker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/beevik/etree"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Precheck", func() {
+	var doc *etree.Document
+
+	load := func(fixture string) *etree.Document {
+		content, err := ioutil.ReadFile(fixture)
+		Expect(err).NotTo(HaveOccurred())
+
+		doc := etree.NewDocument()
+		Expect(doc.ReadFromBytes(content)).To(Succeed())
+
+		return doc
+	}
+
+	setAttribute := func(xpath, name, value string) {
+		element := doc.FindElement(xpath)
+		Expect(element).NotTo(BeNil(), "could not find %s", xpath)
+
+		element.CreateAttr(name, value)
+	}
+
+	BeforeEach(func() {
+		doc = load("./testdata/cib_async_master_sync.xml")
+	})
+
+	It("Finds no problems in a healthy cluster", func() {
+		Expect(Precheck(doc, PgsqlProfile, "pg03")).To(BeEmpty())
+	})
+
+	It("Detects existing migration constraints", func() {
+		constraint := doc.FindElement("//constraints").CreateElement("rsc_location")
+		constraint.CreateAttr("id", "cli-prefer-msPostgresql")
+		constraint.CreateAttr("rsc", "msPostgresql")
+
+		Expect(Precheck(doc, PgsqlProfile, "pg03")).To(
+			ConsistOf("resource has existing constraint cli-prefer-msPostgresql"),
+		)
+	})
+
+	It("Detects disabled stonith", func() {
+		Expect(Precheck(load("./testdata/cib_sync_async_master.xml"), PgsqlProfile, "pg01")).To(
+			ContainElement("stonith is disabled"),
+		)
+	})
+
+	It("Detects cluster maintenance mode", func() {
+		setAttribute("//crm_config/cluster_property_set/nvpair[@name='maintenance-mode']", "value", "true")
+		Expect(Precheck(doc, PgsqlProfile, "pg03")).To(ConsistOf("cluster is in maintenance mode"))
+	})
+
+	It("Detects node maintenance mode", func() {
+		setAttribute("//nodes/node[@uname='pg03']/instance_attributes/nvpair[@name='maintenance']", "value", "on")
+		Expect(Precheck(doc, PgsqlProfile, "pg03")).To(ConsistOf("node pg03 is in maintenance mode"))
+	})
+
+	It("Detects unmanaged resource", func() {
+		meta := doc.FindElement("//resources/master[@id='msPostgresql']").CreateElement("meta_attributes")
+		nvpair := meta.CreateElement("nvpair")
+		nvpair.CreateAttr("name", "is-managed")
+		nvpair.CreateAttr("value", "false")
+
+		Expect(Precheck(doc, PgsqlProfile, "pg03")).To(ConsistOf("resource msPostgresql is unmanaged"))
+	})
+
+	It("Detects unclean nodes", func() {
+		setAttribute("//status/node_state[@uname='pg01']", "in_ccm", "false")
+		Expect(Precheck(doc, PgsqlProfile, "pg03")).To(ConsistOf("node pg01 is unclean, awaiting fencing"))
+	})
+
+	It("Detects fail counts on the target", func() {
+		Expect(Precheck(load("./testdata/cib_sync_async_master.xml"), PgsqlProfile, "pg02")).To(
+			ContainElement("node pg02 has fail-count-Postgresql=1"),
+		)
+	})
+
+	It("Detects unknown targets", func() {
+		Expect(Precheck(doc, PgsqlProfile, "pg04")).To(ConsistOf("node pg04 does not exist"))
+	})
+})
+
+var _ = Describe("Pacemaker.Precheck", func() {
+	var (
+		ctx      = context.Background()
+		crm      *Pacemaker
+		executor *fakeExecutor
+	)
+
+	BeforeEach(func() {
+		executor = new(fakeExecutor)
+		crm = &Pacemaker{executor: executor}
+
+		content, err := ioutil.ReadFile("./testdata/cib_async_master_sync.xml")
+		Expect(err).NotTo(HaveOccurred())
+
+		executor.On("CombinedOutput", ctx, "cibadmin", queryArgs).Return(content, nil)
+	})
+
+	crmadmin := func(output string, err error) {
+		executor.
+			On("CombinedOutput", ctx, "crmadmin", []string{"--status", "pg02"}).
+			Return([]byte(output), err)
+	}
+
+	It("Succeeds when the controller is idle", func() {
+		crmadmin("Status of crmd@pg02: S_IDLE (ok)\n", nil)
+		Expect(crm.Precheck(ctx, "pg03")).To(BeEmpty())
+	})
+
+	It("Detects pending transitions", func() {
+		crmadmin("Controller on pg02 in state S_TRANSITION_ENGINE: ok\n", nil)
+		Expect(crm.Precheck(ctx, "pg03")).To(
+			ConsistOf("controller pg02 is in state S_TRANSITION_ENGINE, a transition is pending"),
+		)
+	})
+
+	It("Reports failure to query the controller", func() {
+		crmadmin("error: No route to host\n", fmt.Errorf("exit status 1"))
+		Expect(crm.Precheck(ctx, "pg03")).To(
+			ConsistOf("failed to query state of controller pg02: exit status 1: error: No route to host"),
+		)
+	})
+})
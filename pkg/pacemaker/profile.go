@@ -0,0 +1,140 @@
+package pacemaker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Profile describes how a resource agent exposes the Postgres role of each node in the
+// cib. Resource agents record roles as node attributes, which we can select with XPaths
+// generated from the profile.
+type Profile struct {
+	Name      string
+	Resource  string // id of the master/slave resource managing Postgres
+	Attribute string // name of the node attribute that denotes role
+	Transient bool   // whether Attribute is a transient (status) node attribute
+	Master    string // value of Attribute on the master
+	Sync      string // value of Attribute on the sync replica
+	Async     string // value of Attribute on async replicas, or the most up-to-date if scored
+
+	// AsyncScores, if set, bounds (exclusively) the integer values of Attribute that denote
+	// async replicas, for agents that rank replicas by score rather than a fixed value.
+	AsyncScores [2]int
+}
+
+var (
+	// PgsqlProfile matches the pgsql resource agent bundled in this repository, which
+	// tracks replication state in a permanent data-status node attribute.
+	PgsqlProfile = Profile{
+		Name:      "pgsql",
+		Resource:  "msPostgresql",
+		Attribute: "Postgresql-data-status",
+		Master:    "LATEST",
+		Sync:      "STREAMING|SYNC",
+		Async:     "STREAMING|POTENTIAL",
+	}
+
+	// PAFProfile matches the PostgreSQL Automatic Failover (pgsqlms) resource agent, which
+	// expresses roles through promotion scores. The master has a score of 1001, while the
+	// most up-to-date replica (the one pacemaker would promote) has a score of 1000. The
+	// remaining replicas are ranked by lag as 990, 980 and so on.
+	PAFProfile = Profile{
+		Name:        "paf",
+		Resource:    "pgsql-ha",
+		Attribute:   "master-pgsqld",
+		Transient:   true,
+		Master:      "1001",
+		Sync:        "1000",
+		Async:       "990",
+		AsyncScores: [2]int{0, 1000},
+	}
+
+	// Profiles lists the built-in profiles, selectable by name
+	Profiles = []Profile{PgsqlProfile, PAFProfile}
+)
+
+type UnknownProfileError string
+
+func (e UnknownProfileError) Error() string {
+	return fmt.Sprintf("unknown pacemaker profile: '%s'", string(e))
+}
+
+// NewProfile returns the built-in profile of the given name
+func NewProfile(name string) (Profile, error) {
+	for _, profile := range Profiles {
+		if profile.Name == name {
+			return profile, nil
+		}
+	}
+
+	return Profile{}, UnknownProfileError(name)
+}
+
+// ParseScoreRange parses exclusive AsyncScores bounds given as "low,high"
+func ParseScoreRange(value string) ([2]int, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 2 {
+		return [2]int{}, fmt.Errorf("invalid score range '%s', expected low,high", value)
+	}
+
+	var bounds [2]int
+	for idx, part := range parts {
+		bound, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return [2]int{}, fmt.Errorf("invalid score range '%s': %s", value, err)
+		}
+
+		bounds[idx] = bound
+	}
+
+	if bounds[0] >= bounds[1] {
+		return [2]int{}, fmt.Errorf("invalid score range '%s', low must be less than high", value)
+	}
+
+	return bounds, nil
+}
+
+// Role classifies a node by the value of its role attribute
+func (p Profile) Role(value string) Role {
+	switch {
+	case value == "":
+		return RoleStopped
+	case value == p.Master:
+		return RoleMaster
+	case value == p.Sync:
+		return RoleSync
+	case value == p.Async:
+		return RoleAsync
+	}
+
+	if p.AsyncScores != [2]int{} {
+		if score, err := strconv.Atoi(value); err == nil && score > p.AsyncScores[0] && score < p.AsyncScores[1] {
+			return RoleAsync
+		}
+	}
+
+	return RoleStopped
+}
+
+func (p Profile) MasterXPath() string { return p.xpath(p.Master) }
+func (p Profile) SyncXPath() string   { return p.xpath(p.Sync) }
+
+// AsyncXPath selects async replicas with exactly the Async value, which for scored
+// profiles is only the most up-to-date. Use Role to classify every async.
+func (p Profile) AsyncXPath() string { return p.xpath(p.Async) }
+
+// xpath generates an XPath that selects the node element (either node or node_state,
+// both of which provide id and uname attributes) with the profile attribute set to value.
+func (p Profile) xpath(value string) string {
+	if p.Transient {
+		return fmt.Sprintf(
+			"//node_state/transient_attributes/instance_attributes/nvpair[@name='%s'][@value='%s']/../../..",
+			p.Attribute, value,
+		)
+	}
+
+	return fmt.Sprintf(
+		"//node/instance_attributes/nvpair[@name='%s'][@value='%s']/../..", p.Attribute, value,
+	)
+}
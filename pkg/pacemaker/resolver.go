@@ -0,0 +1,258 @@
+package pacemaker
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// Resolver finds the candidate addresses of a cluster node, given its corosync node ID.
+// Resolvers may return several addresses, such as one for each corosync ring, from which
+// a single address is chosen according to the AddressFamily.
+type Resolver interface {
+	Resolve(ctx context.Context, crm Pacemaker, nodeID string) ([]string, error)
+}
+
+// CorosyncResolver asks corosync for the addresses of the node. With multiple rings,
+// corosync-cfgtool reports one address per ring, of which we select Ring unless it is
+// negative, in which case all addresses are candidates.
+type CorosyncResolver struct {
+	Ring int
+}
+
+func (r CorosyncResolver) Resolve(ctx context.Context, crm Pacemaker, nodeID string) ([]string, error) {
+	output, err := crm.CombinedOutput(ctx, "corosync-cfgtool", "-a", nodeID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to run corosync-cfgtool")
+	}
+
+	addresses := strings.Fields(string(output))
+	if r.Ring < 0 {
+		return addresses, nil
+	}
+
+	if r.Ring >= len(addresses) {
+		return nil, fmt.Errorf("corosync reports no address for ring %d of node %s", r.Ring, nodeID)
+	}
+
+	return addresses[r.Ring : r.Ring+1], nil
+}
+
+// StaticResolver resolves nodes using a fixed map of node name to addresses, typically
+// provided in configuration. Nodes absent from the map resolve to no addresses.
+type StaticResolver map[string][]string
+
+func (r StaticResolver) Resolve(ctx context.Context, crm Pacemaker, nodeID string) ([]string, error) {
+	node, err := crm.node(ctx, nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return r[node.Name], nil
+}
+
+// DNSResolver looks up the node name, with an optional suffix, in DNS. This allows
+// publishing an address on a different network to that used by corosync, provided each
+// node has a DNS record such as pg01.clients.example.com.
+type DNSResolver struct {
+	Suffix string
+	lookup func(context.Context, string) ([]string, error)
+}
+
+func (r DNSResolver) Resolve(ctx context.Context, crm Pacemaker, nodeID string) ([]string, error) {
+	node, err := crm.node(ctx, nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := r.lookup
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupHost
+	}
+
+	addresses, err := lookup(ctx, node.Name+r.Suffix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to lookup node address")
+	}
+
+	return addresses, nil
+}
+
+// AttributeResolver reads addresses from a pacemaker node attribute, either permanent or
+// transient. Multiple addresses may be given, separated by whitespace or commas.
+type AttributeResolver struct {
+	Attribute string
+}
+
+func (r AttributeResolver) Resolve(ctx context.Context, crm Pacemaker, nodeID string) ([]string, error) {
+	node, err := crm.node(ctx, nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.FieldsFunc(node.Attributes[r.Attribute], func(c rune) bool {
+		return c == ',' || c == ' ' || c == '\t'
+	}), nil
+}
+
+// ChainResolver tries each resolver in turn, falling through to the next whenever one
+// fails or returns no addresses.
+type ChainResolver []Resolver
+
+// Resolve returns the first non-empty result. Unlike ResolveAddress, this can't know
+// whether the result contains an address of the configured family.
+func (r ChainResolver) Resolve(ctx context.Context, crm Pacemaker, nodeID string) ([]string, error) {
+	errs := []string{}
+	for _, resolver := range r {
+		addresses, err := resolver.Resolve(ctx, crm, nodeID)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		if len(addresses) > 0 {
+			return addresses, nil
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("every resolver failed: %s", strings.Join(errs, "; "))
+	}
+
+	return []string{}, nil
+}
+
+// selectAddress resolves the node with each resolver in turn, returning the first
+// address of the family. Resolvers that fail or have no such address fall through to the
+// next, so an IPv4 corosync address doesn't prevent finding an IPv6 address in DNS. If
+// none succeed, we return each resolver's error.
+func (r ChainResolver) selectAddress(ctx context.Context, crm Pacemaker, nodeID string, family AddressFamily) (string, error) {
+	errs := []error{}
+	for _, resolver := range r {
+		candidates, err := resolver.Resolve(ctx, crm, nodeID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if address, ok := family.Select(candidates); ok {
+			return address, nil
+		}
+
+		errs = append(errs, NoAddressError{NodeID: nodeID, Family: family, Candidates: candidates})
+	}
+
+	if len(errs) == 1 {
+		return "", errs[0]
+	}
+
+	messages := make([]string, len(errs))
+	for idx, err := range errs {
+		messages[idx] = err.Error()
+	}
+
+	return "", fmt.Errorf("failed to resolve node %s: %s", nodeID, strings.Join(messages, "; "))
+}
+
+type UnknownResolverError string
+
+func (e UnknownResolverError) Error() string {
+	return fmt.Sprintf("unknown address resolver: '%s'", string(e))
+}
+
+// AddressFamily controls which of a node's candidate addresses is selected
+type AddressFamily string
+
+const (
+	AddressFamilyAny        AddressFamily = "any"         // first candidate
+	AddressFamilyIPv4       AddressFamily = "ipv4"        // first IPv4 candidate only
+	AddressFamilyIPv6       AddressFamily = "ipv6"        // first IPv6 candidate only
+	AddressFamilyPreferIPv4 AddressFamily = "prefer-ipv4" // IPv4 if available, else any
+	AddressFamilyPreferIPv6 AddressFamily = "prefer-ipv6" // IPv6 if available, else any
+)
+
+type UnknownAddressFamilyError string
+
+func (e UnknownAddressFamilyError) Error() string {
+	return fmt.Sprintf("unknown address family: '%s'", string(e))
+}
+
+// NewAddressFamily validates the given address family, defaulting to any
+func NewAddressFamily(name string) (AddressFamily, error) {
+	switch family := AddressFamily(name); family {
+	case "":
+		return AddressFamilyAny, nil
+	case AddressFamilyAny, AddressFamilyIPv4, AddressFamilyIPv6, AddressFamilyPreferIPv4, AddressFamilyPreferIPv6:
+		return family, nil
+	}
+
+	return "", UnknownAddressFamilyError(name)
+}
+
+type NoAddressError struct {
+	NodeID     string
+	Family     AddressFamily
+	Candidates []string
+}
+
+func (e NoAddressError) Error() string {
+	return fmt.Sprintf("no %s address for node %s in candidates [%s]",
+		e.Family, e.NodeID, strings.Join(e.Candidates, ", "))
+}
+
+// Select chooses an address from the candidates. Candidates that are not IP addresses,
+// such as hostnames, are only selected by any.
+func (f AddressFamily) Select(candidates []string) (string, bool) {
+	first := func(match func(net.IP) bool) (string, bool) {
+		for _, candidate := range candidates {
+			if ip := net.ParseIP(candidate); ip != nil && match(ip) {
+				return candidate, true
+			}
+		}
+
+		return "", false
+	}
+
+	ipv4 := func(ip net.IP) bool { return ip.To4() != nil }
+	ipv6 := func(ip net.IP) bool { return ip.To4() == nil }
+
+	switch f {
+	case AddressFamilyIPv4:
+		return first(ipv4)
+	case AddressFamilyIPv6:
+		return first(ipv6)
+	case AddressFamilyPreferIPv4:
+		if address, ok := first(ipv4); ok {
+			return address, true
+		}
+	case AddressFamilyPreferIPv6:
+		if address, ok := first(ipv6); ok {
+			return address, true
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	return candidates[0], true
+}
+
+// node finds the node with the given ID in the cib
+func (p Pacemaker) node(ctx context.Context, nodeID string) (*Node, error) {
+	topology, err := p.Topology(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx := range topology.Nodes {
+		if topology.Nodes[idx].ID == nodeID {
+			return &topology.Nodes[idx], nil
+		}
+	}
+
+	return nil, fmt.Errorf("failed to find node with ID %s", nodeID)
+}
@@ -0,0 +1,150 @@
+package pacemaker
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var resolverCib = `<cib have-quorum="1">
+  <configuration>
+    <nodes>
+      <node id="1" uname="pg01">
+        <instance_attributes id="nodes-1">
+          <nvpair id="nodes-1-client-address" name="client-address" value="10.1.0.1, fd00:1::1"/>
+        </instance_attributes>
+      </node>
+      <node id="2" uname="pg02"/>
+    </nodes>
+  </configuration>
+  <status/>
+</cib>`
+
+var _ = Describe("Resolver", func() {
+	var (
+		ctx      = context.Background()
+		crm      *Pacemaker
+		executor *fakeExecutor
+	)
+
+	BeforeEach(func() {
+		executor = new(fakeExecutor)
+		executor.On("CombinedOutput", ctx, "cibadmin", []string{"--query", "--local"}).Return([]byte(resolverCib), nil)
+		executor.On("CombinedOutput", ctx, "corosync-cfgtool", []string{"-a", "1"}).Return([]byte("192.168.0.1 10.1.0.1 fd00:1::1\n"), nil)
+		crm = &Pacemaker{executor: executor}
+	})
+
+	Describe("ResolveAddress", func() {
+		It("Defaults to the first corosync address", func() {
+			Expect(crm.ResolveAddress(ctx, "1")).To(Equal("192.168.0.1"))
+		})
+
+		It("Selects the given corosync ring", func() {
+			crm.WithResolver(CorosyncResolver{Ring: 1}, AddressFamilyAny)
+			Expect(crm.ResolveAddress(ctx, "1")).To(Equal("10.1.0.1"))
+		})
+
+		It("Fails when ring does not exist", func() {
+			crm.WithResolver(CorosyncResolver{Ring: 3}, AddressFamilyAny)
+			_, err := crm.ResolveAddress(ctx, "1")
+			Expect(err).To(MatchError("corosync reports no address for ring 3 of node 1"))
+		})
+
+		It("Filters by address family", func() {
+			crm.WithResolver(CorosyncResolver{Ring: -1}, AddressFamilyIPv6)
+			Expect(crm.ResolveAddress(ctx, "1")).To(Equal("fd00:1::1"))
+		})
+
+		It("Fails when no address matches family", func() {
+			crm.WithResolver(StaticResolver{"pg01": {"10.1.0.1"}}, AddressFamilyIPv6)
+			_, err := crm.ResolveAddress(ctx, "1")
+			Expect(err).To(MatchError("no ipv6 address for node 1 in candidates [10.1.0.1]"))
+		})
+
+		It("Reads addresses from node attributes", func() {
+			crm.WithResolver(AttributeResolver{Attribute: "client-address"}, AddressFamilyPreferIPv6)
+			Expect(crm.ResolveAddress(ctx, "1")).To(Equal("fd00:1::1"))
+		})
+
+		It("Looks up node names in DNS", func() {
+			lookup := func(_ context.Context, host string) ([]string, error) {
+				if host == "pg01.clients.example.com" {
+					return []string{"10.1.0.1"}, nil
+				}
+
+				return nil, errors.New("no such host")
+			}
+
+			crm.WithResolver(DNSResolver{Suffix: ".clients.example.com", lookup: lookup}, AddressFamilyIPv4)
+			Expect(crm.ResolveAddress(ctx, "1")).To(Equal("10.1.0.1"))
+		})
+
+		It("Falls through chained resolvers", func() {
+			crm.WithResolver(ChainResolver{
+				StaticResolver{"pg02": {"10.1.0.2"}},
+				CorosyncResolver{Ring: 1},
+			}, AddressFamilyAny)
+
+			Expect(crm.ResolveAddress(ctx, "1")).To(Equal("10.1.0.1"))
+		})
+
+		It("Falls through chained resolvers without an address of the family", func() {
+			crm.WithResolver(ChainResolver{
+				CorosyncResolver{Ring: 1},
+				AttributeResolver{Attribute: "client-address"},
+			}, AddressFamilyIPv6)
+
+			Expect(crm.ResolveAddress(ctx, "1")).To(Equal("fd00:1::1"))
+		})
+
+		It("Falls through chained resolvers that fail", func() {
+			lookup := func(_ context.Context, host string) ([]string, error) {
+				return nil, errors.New("no such host")
+			}
+
+			crm.WithResolver(ChainResolver{
+				DNSResolver{lookup: lookup},
+				CorosyncResolver{Ring: 1},
+			}, AddressFamilyAny)
+
+			Expect(crm.ResolveAddress(ctx, "1")).To(Equal("10.1.0.1"))
+		})
+
+		It("Fails with every error when no chained resolver finds an address", func() {
+			crm.WithResolver(ChainResolver{
+				CorosyncResolver{Ring: 3},
+				StaticResolver{"pg01": {"10.1.0.1"}},
+			}, AddressFamilyIPv6)
+
+			_, err := crm.ResolveAddress(ctx, "1")
+			Expect(err).To(MatchError("failed to resolve node 1: corosync reports no address for ring 3 of node 1; " +
+				"no ipv6 address for node 1 in candidates [10.1.0.1]"))
+		})
+	})
+
+	Describe("AddressFamily", func() {
+		for _, tc := range []struct {
+			family     AddressFamily
+			candidates []string
+			expected   string
+		}{
+			{AddressFamilyAny, []string{"fd00::1", "10.0.0.1"}, "fd00::1"},
+			{AddressFamilyIPv4, []string{"fd00::1", "10.0.0.1"}, "10.0.0.1"},
+			{AddressFamilyIPv4, []string{"fd00::1"}, ""},
+			{AddressFamilyIPv4, []string{"pg01.example.com"}, ""},
+			{AddressFamilyPreferIPv4, []string{"fd00::1"}, "fd00::1"},
+			{AddressFamilyPreferIPv6, []string{"10.0.0.1", "fd00::1"}, "fd00::1"},
+		} {
+			tc := tc
+
+			It(fmt.Sprintf("Selects %q from %v with %s", tc.expected, tc.candidates, tc.family), func() {
+				address, _ := tc.family.Select(tc.candidates)
+				Expect(address).To(Equal(tc.expected))
+			})
+		}
+	})
+})
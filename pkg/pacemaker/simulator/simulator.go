@@ -0,0 +1,803 @@
+// Package simulator provides an in-memory pacemaker cluster that responds to the
+// commands issued by the pacemaker package. It can be supplied as the executor to
+// pacemaker.NewPacemaker, allowing the failover API and supervise to be exercised without
+// running a real cluster.
+package simulator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pacemaker"
+	"golang.org/x/net/context"
+)
+
+// Options configures the behaviour of the simulated cluster
+type Options struct {
+	Latency        time.Duration // delay applied to every command
+	PromotionDelay time.Duration // time between a migration and the new master appearing
+	FailPromotion  bool          // if true, migrations are accepted but never take effect
+}
+
+// Simulator maintains an in-memory cib, mutating it in response to pacemaker commands
+type Simulator struct {
+	sync.Mutex
+	profile     pacemaker.Profile
+	opt         Options
+	nodes       []*Node
+	quorate     bool
+	epoch       int
+	numUpdates  int
+	constraints []*constraint
+	failures    map[string]error
+	dcState     string
+	localNode   string
+}
+
+// constraint is a location constraint preferring the resource run on node, which is
+// ignored once expires has passed.
+type constraint struct {
+	id, node string
+	expires  time.Time
+}
+
+func (c *constraint) expired() bool {
+	return !c.expires.IsZero() && time.Now().After(c.expires)
+}
+
+// Node is a simulated cluster member. Attributes are the permanent node attributes, while
+// Transient are those that would be found in the status section of the cib.
+type Node struct {
+	ID, Name, Address string
+	Online            bool
+	Attributes        map[string]string
+	Transient         map[string]string
+	failedAt          time.Time // time of the last failed monitor, if any
+}
+
+func New(profile pacemaker.Profile, opt Options) *Simulator {
+	return &Simulator{
+		profile:  profile,
+		opt:      opt,
+		quorate:  true,
+		epoch:    1,
+		failures: map[string]error{},
+		dcState:  "S_IDLE",
+	}
+}
+
+// AddNode adds an online node to the cluster, hosting Postgres in the given role
+func (s *Simulator) AddNode(name, address string, role pacemaker.Role) *Simulator {
+	s.Lock()
+	defer s.Unlock()
+
+	node := &Node{
+		ID:         fmt.Sprintf("%d", len(s.nodes)+1),
+		Name:       name,
+		Address:    address,
+		Online:     true,
+		Attributes: map[string]string{},
+		Transient:  map[string]string{},
+	}
+
+	s.nodes = append(s.nodes, node)
+	s.setRole(node, role)
+
+	return s
+}
+
+// SetLocalNode changes the node reported by crm_node as the one we're running on
+func (s *Simulator) SetLocalNode(name string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.localNode = name
+}
+
+// SetRole changes the role of the named node
+func (s *Simulator) SetRole(name string, role pacemaker.Role) {
+	s.Lock()
+	defer s.Unlock()
+
+	if node := s.node(name); node != nil {
+		s.setRole(node, role)
+	}
+}
+
+// SetOnline marks the named node as online or offline
+func (s *Simulator) SetOnline(name string, online bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	if node := s.node(name); node != nil {
+		node.Online = online
+		s.bump()
+	}
+}
+
+// SetQuorate controls whether the cluster reports having quorum
+func (s *Simulator) SetQuorate(quorate bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.quorate = quorate
+	s.bump()
+}
+
+// FailMonitor records a failed monitor of the resource on the named node, incrementing
+// its fail count. The role of the node is left unchanged.
+func (s *Simulator) FailMonitor(name string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if node := s.node(name); node != nil {
+		key := fmt.Sprintf("fail-count-%s", s.profile.Resource)
+		count := 0
+		fmt.Sscanf(node.Transient[key], "%d", &count)
+
+		node.Transient[key] = fmt.Sprintf("%d", count+1)
+		node.failedAt = time.Now()
+		s.bump()
+	}
+}
+
+// SetControllerState sets the state reported by the designated controller, such as
+// S_TRANSITION_ENGINE to simulate a pending transition.
+func (s *Simulator) SetControllerState(state string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.dcState = state
+}
+
+// Fail causes any command beginning with the given prefix to fail with err. Supplying a
+// nil error removes the failure.
+func (s *Simulator) Fail(prefix string, err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if err == nil {
+		delete(s.failures, prefix)
+	} else {
+		s.failures[prefix] = err
+	}
+}
+
+// Role returns the name of the first node with the given role, or an empty string if no
+// node has that role.
+func (s *Simulator) Role(role pacemaker.Role) string {
+	s.Lock()
+	defer s.Unlock()
+
+	if node := s.first(role); node != nil {
+		return node.Name
+	}
+
+	return ""
+}
+
+// AddConstraint adds a location constraint for the resource, such as one left behind by
+// a previous migration.
+func (s *Simulator) AddConstraint(id, node string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.constraints = append(s.constraints, &constraint{id: id, node: node})
+	s.bump()
+}
+
+// Constraints returns the IDs of all unexpired location constraints in the cib
+func (s *Simulator) Constraints() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	ids := []string{}
+	for _, constraint := range s.constraints {
+		if !constraint.expired() {
+			ids = append(ids, constraint.id)
+		}
+	}
+
+	return ids
+}
+
+// CombinedOutput implements the executor interface required by pacemaker.NewPacemaker
+func (s *Simulator) CombinedOutput(ctx context.Context, name string, args ...string) ([]byte, error) {
+	select {
+	case <-time.After(s.opt.Latency):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	command := strings.Join(append([]string{name}, args...), " ")
+	for prefix, err := range s.failures {
+		if strings.HasPrefix(command, prefix) {
+			return []byte(err.Error()), err
+		}
+	}
+
+	switch name {
+	case "cibadmin":
+		return s.cibadmin(args)
+	case "corosync-cfgtool":
+		return s.corosyncCfgtool(args)
+	case "crmadmin":
+		return s.crmadmin(args)
+	case "crm_node":
+		return s.crmNode(args)
+	case "crm":
+		return s.crm(args)
+	case "pcs":
+		return s.pcs(args)
+	case "crm_resource":
+		return s.crmResource(args)
+	case "crm_standby":
+		return s.crmStandby(args)
+	}
+
+	return unknownCommand(command)
+}
+
+func (s *Simulator) cibadmin(args []string) ([]byte, error) {
+	doc := s.cib()
+	if contains(args, "--no-children") {
+		for _, child := range doc.Root().ChildElements() {
+			doc.Root().RemoveChild(child)
+		}
+	}
+
+	return doc.WriteToBytes()
+}
+
+func (s *Simulator) corosyncCfgtool(args []string) ([]byte, error) {
+	if len(args) != 2 || args[0] != "-a" {
+		return unknownCommand("corosync-cfgtool " + strings.Join(args, " "))
+	}
+
+	for _, node := range s.nodes {
+		if node.ID == args[1] {
+			return []byte(node.Address + "\n"), nil
+		}
+	}
+
+	return []byte(""), nil
+}
+
+func (s *Simulator) crmadmin(args []string) ([]byte, error) {
+	name := flag(args, "--status")
+	if name == "" {
+		return unknownCommand("crmadmin " + strings.Join(args, " "))
+	}
+
+	node := s.node(name)
+	if node == nil || !node.Online {
+		return []byte(fmt.Sprintf("error: Could not contact controller on %s", name)), fmt.Errorf("exit status 1")
+	}
+
+	state := "S_NOT_DC"
+	if node == s.nodes[0] {
+		state = s.dcState
+	}
+
+	return []byte(fmt.Sprintf("Status of crmd@%s: %s (ok)\n", name, state)), nil
+}
+
+// crmNode reports the name of the local node, which is the DC unless set otherwise
+func (s *Simulator) crmNode(args []string) ([]byte, error) {
+	if len(args) != 1 || args[0] != "--name" {
+		return unknownCommand("crm_node " + strings.Join(args, " "))
+	}
+
+	if s.localNode != "" {
+		return []byte(s.localNode + "\n"), nil
+	}
+
+	if len(s.nodes) == 0 {
+		return []byte("error: Could not determine local node name"), fmt.Errorf("exit status 1")
+	}
+
+	return []byte(s.nodes[0].Name + "\n"), nil
+}
+
+// crm handles crmsh commands of the form: crm resource <action> <resource> [node], or
+// crm node <action> <node>
+func (s *Simulator) crm(args []string) ([]byte, error) {
+	if len(args) == 3 && args[0] == "node" && args[1] == "standby" {
+		return s.standby(args[2])
+	}
+
+	if len(args) == 3 && args[0] == "node" && args[1] == "online" {
+		return s.unstandby(args[2])
+	}
+
+	if len(args) >= 4 && args[0] == "resource" && args[1] == "migrate" {
+		lifetime := ""
+		if len(args) > 4 {
+			lifetime = args[4]
+		}
+
+		return s.migrate(args[2], args[3], lifetime)
+	}
+
+	if len(args) == 3 && args[0] == "resource" && args[1] == "unmigrate" {
+		return s.unmigrate(args[2])
+	}
+
+	if len(args) == 4 && args[0] == "resource" && args[1] == "cleanup" {
+		return s.cleanup(args[2], args[3])
+	}
+
+	return unknownCommand("crm " + strings.Join(args, " "))
+}
+
+// pcs handles pcs commands of the form: pcs resource <action> <resource> [node], or
+// pcs node <action> <node>
+func (s *Simulator) pcs(args []string) ([]byte, error) {
+	if len(args) == 3 && args[0] == "node" && args[1] == "standby" {
+		return s.standby(args[2])
+	}
+
+	if len(args) == 3 && args[0] == "node" && args[1] == "unstandby" {
+		return s.unstandby(args[2])
+	}
+
+	if len(args) >= 4 && args[0] == "resource" && args[1] == "move" {
+		lifetime := ""
+		for _, arg := range args[4:] {
+			if strings.HasPrefix(arg, "lifetime=") {
+				lifetime = strings.TrimPrefix(arg, "lifetime=")
+			}
+		}
+
+		return s.migrate(args[2], args[3], lifetime)
+	}
+
+	if len(args) == 3 && args[0] == "resource" && args[1] == "clear" {
+		return s.unmigrate(args[2])
+	}
+
+	if len(args) == 4 && args[0] == "resource" && args[1] == "restart" {
+		return s.restart(args[2], args[3])
+	}
+
+	if len(args) == 5 && args[0] == "resource" && args[1] == "cleanup" {
+		return s.cleanup(args[2], flag(args, "--node"))
+	}
+
+	return unknownCommand("pcs " + strings.Join(args, " "))
+}
+
+// crmResource handles crm_resource commands, which use flags rather than positional
+// arguments.
+func (s *Simulator) crmResource(args []string) ([]byte, error) {
+	switch {
+	case contains(args, "--move"):
+		return s.migrate(flag(args, "--resource"), flag(args, "--node"), flag(args, "--lifetime"))
+	case contains(args, "--clear"):
+		return s.unmigrate(flag(args, "--resource"))
+	case contains(args, "--restart"):
+		return s.restart(flag(args, "--resource"), flag(args, "--node"))
+	case contains(args, "--cleanup"):
+		return s.cleanup(flag(args, "--resource"), flag(args, "--node"))
+	}
+
+	return unknownCommand("crm_resource " + strings.Join(args, " "))
+}
+
+func (s *Simulator) crmStandby(args []string) ([]byte, error) {
+	switch {
+	case flag(args, "--update") == "on":
+		return s.standby(flag(args, "--node"))
+	case contains(args, "--delete"):
+		return s.unstandby(flag(args, "--node"))
+	}
+
+	return unknownCommand("crm_standby " + strings.Join(args, " "))
+}
+
+// migrate places a location constraint on the target node and schedules its promotion.
+// Once the promotion delay has elapsed, the target becomes master, the old master is
+// stopped and the remaining replica becomes sync. Lifetimes are ISO8601 durations in
+// seconds, as generated by the pacemaker backends.
+func (s *Simulator) migrate(resource, to, lifetime string) ([]byte, error) {
+	if resource != s.profile.Resource {
+		return resourceNotFound(resource)
+	}
+
+	target := s.node(to)
+	if target == nil || !target.Online {
+		return []byte(fmt.Sprintf("Error performing operation: node '%s' is unknown or offline", to)),
+			fmt.Errorf("exit status 1")
+	}
+
+	prefer := &constraint{id: fmt.Sprintf("cli-prefer-%s", resource), node: to}
+	if lifetime != "" {
+		var seconds int
+		if _, err := fmt.Sscanf(lifetime, "PT%dS", &seconds); err != nil {
+			return []byte(fmt.Sprintf("Error: invalid lifetime '%s'", lifetime)), fmt.Errorf("exit status 1")
+		}
+
+		prefer.expires = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+
+	s.constraints = append(s.constraints, prefer)
+	s.bump()
+
+	if !s.opt.FailPromotion {
+		time.AfterFunc(s.opt.PromotionDelay, func() { s.promote(to) })
+	}
+
+	return []byte(""), nil
+}
+
+func (s *Simulator) promote(name string) {
+	s.Lock()
+	defer s.Unlock()
+
+	target := s.node(name)
+	if target == nil || !target.Online {
+		return
+	}
+
+	for _, node := range s.nodes {
+		switch {
+		case node == target:
+			s.setRole(node, pacemaker.RoleMaster)
+		case s.role(node) == pacemaker.RoleMaster:
+			s.setRole(node, pacemaker.RoleStopped)
+		case s.role(node) == pacemaker.RoleAsync && available(node):
+			s.setRole(node, pacemaker.RoleSync)
+		}
+	}
+}
+
+// restart stops Postgres on the node, starting it again in the same role once the
+// promotion delay has elapsed.
+func (s *Simulator) restart(resource, name string) ([]byte, error) {
+	if resource != s.profile.Resource {
+		return resourceNotFound(resource)
+	}
+
+	node := s.node(name)
+	if node == nil {
+		return nodeNotFound(name)
+	}
+
+	role := s.role(node)
+	s.setRole(node, pacemaker.RoleStopped)
+
+	time.AfterFunc(s.opt.PromotionDelay, func() {
+		s.Lock()
+		defer s.Unlock()
+
+		if available(node) {
+			s.setRole(node, role)
+		}
+	})
+
+	return []byte(""), nil
+}
+
+// cleanup clears the failure history of the resource on the node
+func (s *Simulator) cleanup(resource, name string) ([]byte, error) {
+	if resource != s.profile.Resource {
+		return resourceNotFound(resource)
+	}
+
+	node := s.node(name)
+	if node == nil {
+		return nodeNotFound(name)
+	}
+
+	delete(node.Transient, fmt.Sprintf("fail-count-%s", resource))
+	node.failedAt = time.Time{}
+	s.bump()
+
+	return []byte(""), nil
+}
+
+// standby stops Postgres on the node. If the node was master or sync, another node takes
+// over that role once the promotion delay has elapsed.
+func (s *Simulator) standby(name string) ([]byte, error) {
+	node := s.node(name)
+	if node == nil {
+		return nodeNotFound(name)
+	}
+
+	role := s.role(node)
+	node.Attributes["standby"] = "on"
+	s.setRole(node, pacemaker.RoleStopped)
+
+	time.AfterFunc(s.opt.PromotionDelay, func() {
+		s.Lock()
+		defer s.Unlock()
+
+		switch role {
+		case pacemaker.RoleMaster:
+			s.replace(pacemaker.RoleSync, pacemaker.RoleMaster)
+			s.replace(pacemaker.RoleAsync, pacemaker.RoleSync)
+		case pacemaker.RoleSync:
+			s.replace(pacemaker.RoleAsync, pacemaker.RoleSync)
+		}
+	})
+
+	return []byte(""), nil
+}
+
+// unstandby allows Postgres to start on the node, which rejoins the cluster as a replica
+// once the promotion delay has elapsed.
+func (s *Simulator) unstandby(name string) ([]byte, error) {
+	node := s.node(name)
+	if node == nil {
+		return nodeNotFound(name)
+	}
+
+	delete(node.Attributes, "standby")
+	s.bump()
+
+	time.AfterFunc(s.opt.PromotionDelay, func() {
+		s.Lock()
+		defer s.Unlock()
+
+		if !available(node) || s.role(node) != pacemaker.RoleStopped {
+			return
+		}
+
+		role := pacemaker.RoleAsync
+		if s.first(pacemaker.RoleSync) == nil {
+			role = pacemaker.RoleSync
+		}
+
+		s.setRole(node, role)
+	})
+
+	return []byte(""), nil
+}
+
+// replace moves the first available node with role from into role to
+func (s *Simulator) replace(from, to pacemaker.Role) {
+	for _, node := range s.nodes {
+		if s.role(node) == from && available(node) {
+			s.setRole(node, to)
+			return
+		}
+	}
+}
+
+func (s *Simulator) first(role pacemaker.Role) *Node {
+	for _, node := range s.nodes {
+		if s.role(node) == role {
+			return node
+		}
+	}
+
+	return nil
+}
+
+func (s *Simulator) unmigrate(resource string) ([]byte, error) {
+	if resource != s.profile.Resource {
+		return resourceNotFound(resource)
+	}
+
+	constraints := []*constraint{}
+	for _, constraint := range s.constraints {
+		if !strings.HasPrefix(constraint.id, "cli-") {
+			constraints = append(constraints, constraint)
+		}
+	}
+
+	s.constraints = constraints
+	s.bump()
+
+	return []byte(""), nil
+}
+
+func (s *Simulator) node(name string) *Node {
+	for _, node := range s.nodes {
+		if node.Name == name {
+			return node
+		}
+	}
+
+	return nil
+}
+
+// setRole writes the profile role attribute to the appropriate attribute set. Nodes that
+// are stopped have the attribute removed.
+func (s *Simulator) setRole(node *Node, role pacemaker.Role) {
+	attributes := node.Attributes
+	if s.profile.Transient {
+		attributes = node.Transient
+	}
+
+	switch role {
+	case pacemaker.RoleMaster:
+		attributes[s.profile.Attribute] = s.profile.Master
+	case pacemaker.RoleSync:
+		attributes[s.profile.Attribute] = s.profile.Sync
+	case pacemaker.RoleAsync:
+		attributes[s.profile.Attribute] = s.profile.Async
+	default:
+		delete(attributes, s.profile.Attribute)
+	}
+
+	s.bump()
+}
+
+func (s *Simulator) role(node *Node) pacemaker.Role {
+	attributes := node.Attributes
+	if s.profile.Transient {
+		attributes = node.Transient
+	}
+
+	switch attributes[s.profile.Attribute] {
+	case s.profile.Master:
+		return pacemaker.RoleMaster
+	case s.profile.Sync:
+		return pacemaker.RoleSync
+	case s.profile.Async:
+		return pacemaker.RoleAsync
+	}
+
+	return pacemaker.RoleStopped
+}
+
+// bump increments the cib version, as pacemaker would on every modification
+func (s *Simulator) bump() {
+	s.numUpdates++
+}
+
+// cib renders the simulated cluster into a document resembling cibadmin output
+func (s *Simulator) cib() *etree.Document {
+	doc := etree.NewDocument()
+	cib := doc.CreateElement("cib")
+	cib.CreateAttr("admin_epoch", "0")
+	cib.CreateAttr("epoch", fmt.Sprintf("%d", s.epoch))
+	cib.CreateAttr("num_updates", fmt.Sprintf("%d", s.numUpdates))
+	cib.CreateAttr("have-quorum", map[bool]string{true: "1", false: "0"}[s.quorate])
+
+	if len(s.nodes) > 0 {
+		cib.CreateAttr("dc-uuid", s.nodes[0].ID)
+	}
+
+	configuration := cib.CreateElement("configuration")
+	configuration.CreateElement("crm_config")
+
+	nodes := configuration.CreateElement("nodes")
+	for _, node := range s.nodes {
+		element := nodes.CreateElement("node")
+		element.CreateAttr("id", node.ID)
+		element.CreateAttr("uname", node.Name)
+		createAttributes(element, fmt.Sprintf("nodes-%s", node.ID), node.Attributes)
+	}
+
+	resources := configuration.CreateElement("resources")
+	resources.CreateElement("master").CreateAttr("id", s.profile.Resource)
+
+	constraints := configuration.CreateElement("constraints")
+	for _, c := range s.constraints {
+		constraint := constraints.CreateElement("rsc_location")
+		constraint.CreateAttr("id", c.id)
+		constraint.CreateAttr("rsc", s.profile.Resource)
+		constraint.CreateAttr("role", "Master")
+
+		if c.expires.IsZero() {
+			constraint.CreateAttr("node", c.node)
+			constraint.CreateAttr("score", "INFINITY")
+			continue
+		}
+
+		rule := constraint.CreateElement("rule")
+		rule.CreateAttr("id", fmt.Sprintf("%s-rule", c.id))
+		rule.CreateAttr("score", "INFINITY")
+
+		expression := rule.CreateElement("expression")
+		expression.CreateAttr("attribute", "#uname")
+		expression.CreateAttr("operation", "eq")
+		expression.CreateAttr("value", c.node)
+
+		expiry := rule.CreateElement("date_expression")
+		expiry.CreateAttr("operation", "lt")
+		expiry.CreateAttr("end", c.expires.UTC().Format("2006-01-02 15:04:05Z"))
+	}
+
+	status := cib.CreateElement("status")
+	for _, node := range s.nodes {
+		state := status.CreateElement("node_state")
+		state.CreateAttr("id", node.ID)
+		state.CreateAttr("uname", node.Name)
+		state.CreateAttr("in_ccm", map[bool]string{true: "true", false: "false"}[node.Online])
+		state.CreateAttr("crmd", map[bool]string{true: "online", false: "offline"}[node.Online])
+
+		if !node.failedAt.IsZero() {
+			lrm := state.CreateElement("lrm")
+			lrm.CreateAttr("id", node.ID)
+
+			resource := lrm.CreateElement("lrm_resources").CreateElement("lrm_resource")
+			resource.CreateAttr("id", s.profile.Resource)
+
+			op := resource.CreateElement("lrm_rsc_op")
+			op.CreateAttr("id", fmt.Sprintf("%s_last_failure_0", s.profile.Resource))
+			op.CreateAttr("operation_key", fmt.Sprintf("%s_monitor_2000", s.profile.Resource))
+			op.CreateAttr("operation", "monitor")
+			op.CreateAttr("interval", "2000")
+			op.CreateAttr("rc-code", "7")
+			op.CreateAttr("op-status", "0")
+			op.CreateAttr("last-rc-change", fmt.Sprintf("%d", node.failedAt.Unix()))
+		}
+
+		transient := state.CreateElement("transient_attributes")
+		transient.CreateAttr("id", node.ID)
+		createAttributes(transient, fmt.Sprintf("status-%s", node.ID), node.Transient)
+	}
+
+	doc.Indent(2)
+	return doc
+}
+
+func createAttributes(parent *etree.Element, id string, attributes map[string]string) {
+	set := parent.CreateElement("instance_attributes")
+	set.CreateAttr("id", id)
+
+	// Sort attribute names so our output is stable between queries
+	names := []string{}
+	for name := range attributes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		nvpair := set.CreateElement("nvpair")
+		nvpair.CreateAttr("id", fmt.Sprintf("%s-%s", id, name))
+		nvpair.CreateAttr("name", name)
+		nvpair.CreateAttr("value", attributes[name])
+	}
+}
+
+// available returns true if the node is able to run resources
+func available(node *Node) bool {
+	return node.Online && node.Attributes["standby"] != "on"
+}
+
+func contains(args []string, arg string) bool {
+	for _, candidate := range args {
+		if candidate == arg {
+			return true
+		}
+	}
+
+	return false
+}
+
+// flag returns the value following the given flag in args
+func flag(args []string, name string) string {
+	for idx, arg := range args {
+		if arg == name && idx+1 < len(args) {
+			return args[idx+1]
+		}
+	}
+
+	return ""
+}
+
+func unknownCommand(command string) ([]byte, error) {
+	return []byte(fmt.Sprintf("simulator: unsupported command '%s'", command)), fmt.Errorf("exit status 127")
+}
+
+func nodeNotFound(node string) ([]byte, error) {
+	return []byte(fmt.Sprintf("Error performing operation: node '%s' not found", node)),
+		fmt.Errorf("exit status 6")
+}
+
+func resourceNotFound(resource string) ([]byte, error) {
+	return []byte(fmt.Sprintf("Error performing operation: resource '%s' not found", resource)),
+		fmt.Errorf("exit status 6")
+}
@@ -0,0 +1,218 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pacemaker"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Simulator", func() {
+	var (
+		ctx = context.Background()
+		sim *Simulator
+		opt Options
+	)
+
+	BeforeEach(func() {
+		opt = Options{PromotionDelay: 10 * time.Millisecond}
+	})
+
+	newCluster := func(profile pacemaker.Profile, backend pacemaker.Backend) *pacemaker.Pacemaker {
+		sim = New(profile, opt).
+			AddNode("pg01", "10.0.0.1", pacemaker.RoleMaster).
+			AddNode("pg02", "10.0.0.2", pacemaker.RoleSync).
+			AddNode("pg03", "10.0.0.3", pacemaker.RoleAsync)
+
+		return pacemaker.NewPacemaker(sim, backend, profile)
+	}
+
+	roles := func(crm *pacemaker.Pacemaker) func() []string {
+		return func() []string {
+			topology, err := crm.Topology(ctx)
+			Expect(err).NotTo(HaveOccurred())
+
+			names := []string{}
+			for _, role := range []pacemaker.Role{pacemaker.RoleMaster, pacemaker.RoleSync, pacemaker.RoleAsync} {
+				if node := topology.Role(role); node != nil {
+					names = append(names, node.Name)
+				} else {
+					names = append(names, "")
+				}
+			}
+
+			return names
+		}
+	}
+
+	for _, profile := range pacemaker.Profiles {
+		profile := profile
+
+		Context("With "+profile.Name+" profile", func() {
+			It("Reports node roles", func() {
+				crm := newCluster(profile, nil)
+				Expect(roles(crm)()).To(Equal([]string{"pg01", "pg02", "pg03"}))
+			})
+
+			It("Finds master using profile XPaths", func() {
+				crm := newCluster(profile, nil)
+				nodes, err := crm.Get(ctx, profile.MasterXPath())
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(nodes[0].SelectAttrValue("uname", "")).To(Equal("pg01"))
+			})
+		})
+	}
+
+	for _, backend := range pacemaker.Backends {
+		backend := backend
+
+		Context("With "+backend.Name()+" backend", func() {
+			It("Promotes target after migration", func() {
+				crm := newCluster(pacemaker.PgsqlProfile, backend)
+				Expect(crm.Migrate(ctx, "pg02", 0)).To(Succeed())
+
+				Eventually(roles(crm)).Should(Equal([]string{"pg02", "pg03", ""}))
+			})
+
+			It("Replaces sync placed into standby", func() {
+				crm := newCluster(pacemaker.PgsqlProfile, backend)
+				Expect(crm.Standby(ctx, "pg02")).To(Succeed())
+				Eventually(roles(crm)).Should(Equal([]string{"pg01", "pg03", ""}))
+
+				topology, err := crm.Topology(ctx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(topology.Node("pg02").Standby).To(BeTrue())
+
+				Expect(crm.Unstandby(ctx, "pg02")).To(Succeed())
+				Eventually(roles(crm)).Should(Equal([]string{"pg01", "pg03", "pg02"}))
+			})
+
+			It("Restarts Postgres in the same role", func() {
+				crm := newCluster(pacemaker.PgsqlProfile, backend)
+				Expect(crm.Restart(ctx, "pg02")).To(Succeed())
+				Expect(roles(crm)()).To(Equal([]string{"pg01", "", "pg03"}))
+
+				Eventually(roles(crm)).Should(Equal([]string{"pg01", "pg02", "pg03"}))
+			})
+
+			It("Clears failures on cleanup", func() {
+				crm := newCluster(pacemaker.PgsqlProfile, backend)
+				sim.FailMonitor("pg03")
+
+				failures, err := crm.Failures(ctx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(failures.FailCounts).To(Equal([]pacemaker.FailCount{
+					{Node: "pg03", Resource: "msPostgresql", Count: "1"},
+				}))
+				Expect(failures.FailedActions).To(HaveLen(1))
+
+				Expect(crm.Cleanup(ctx, "pg03")).To(Succeed())
+
+				failures, err = crm.Failures(ctx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(failures.FailCounts).To(BeEmpty())
+				Expect(failures.FailedActions).To(BeEmpty())
+			})
+
+			It("Expires migration constraints after their lifetime", func() {
+				crm := newCluster(pacemaker.PgsqlProfile, backend)
+				Expect(crm.Migrate(ctx, "pg02", time.Second)).To(Succeed())
+				Expect(sim.Constraints()).To(ConsistOf("cli-prefer-msPostgresql"))
+
+				Eventually(sim.Constraints, 2*time.Second).Should(BeEmpty())
+			})
+
+			It("Removes constraints on unmigrate", func() {
+				crm := newCluster(pacemaker.PgsqlProfile, backend)
+				Expect(crm.Migrate(ctx, "pg02", 0)).To(Succeed())
+				Expect(sim.Constraints()).To(ConsistOf("cli-prefer-msPostgresql"))
+
+				Expect(crm.Unmigrate(ctx)).To(Succeed())
+				Expect(sim.Constraints()).To(BeEmpty())
+			})
+		})
+	}
+
+	It("Resolves node addresses", func() {
+		crm := newCluster(pacemaker.PgsqlProfile, nil)
+		Expect(crm.ResolveAddress(ctx, "2")).To(Equal("10.0.0.2"))
+	})
+
+	It("Reports the local node and DC", func() {
+		crm := newCluster(pacemaker.PgsqlProfile, nil)
+		sim.SetLocalNode("pg02")
+
+		Expect(crm.LocalNode(ctx)).To(Equal("pg02"))
+
+		topology, err := crm.Topology(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(topology.DC).To(Equal("pg01"))
+	})
+
+	It("Changes version whenever the cib is modified", func() {
+		crm := newCluster(pacemaker.PgsqlProfile, nil)
+		before, err := crm.Version(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		sim.SetOnline("pg03", false)
+		Expect(crm.Version(ctx)).NotTo(Equal(before))
+	})
+
+	It("Reports loss of quorum", func() {
+		crm := newCluster(pacemaker.PgsqlProfile, nil)
+		sim.SetQuorate(false)
+
+		_, err := crm.Get(ctx, pacemaker.MasterXPath)
+		Expect(err).To(MatchError(pacemaker.NoQuorumError{}))
+	})
+
+	It("Refuses to migrate to offline nodes", func() {
+		crm := newCluster(pacemaker.PgsqlProfile, nil)
+		sim.SetOnline("pg02", false)
+
+		Expect(crm.Migrate(ctx, "pg02", 0)).NotTo(Succeed())
+	})
+
+	Context("With injected failure", func() {
+		It("Fails matching commands", func() {
+			crm := newCluster(pacemaker.PgsqlProfile, nil)
+			sim.Fail("crm resource migrate", errors.New("exit status 1"))
+
+			Expect(crm.Migrate(ctx, "pg02", 0)).To(MatchError(MatchRegexp("exit status 1")))
+			Expect(crm.Unmigrate(ctx)).To(Succeed())
+		})
+	})
+
+	Context("When promotion fails", func() {
+		BeforeEach(func() {
+			opt.FailPromotion = true
+		})
+
+		It("Accepts migration but never promotes", func() {
+			crm := newCluster(pacemaker.PgsqlProfile, nil)
+			Expect(crm.Migrate(ctx, "pg02", 0)).To(Succeed())
+
+			Consistently(roles(crm), 50*time.Millisecond).Should(Equal([]string{"pg01", "pg02", "pg03"}))
+		})
+	})
+
+	Context("With latency", func() {
+		BeforeEach(func() {
+			opt.Latency = time.Second
+		})
+
+		It("Respects context cancellation", func() {
+			crm := newCluster(pacemaker.PgsqlProfile, nil)
+			timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+			defer cancel()
+
+			_, err := crm.Query(timeoutCtx)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+	})
+})
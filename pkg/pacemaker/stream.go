@@ -1,6 +1,7 @@
 package pacemaker
 
 import (
+	"encoding/json"
 	"strings"
 	"time"
 
@@ -10,11 +11,12 @@ import (
 )
 
 type StreamOptions struct {
-	Ctx          context.Context
-	Attribute    string
-	XPaths       []AliasedXPath
-	PollInterval time.Duration
-	GetTimeout   time.Duration
+	Ctx            context.Context
+	Attribute      string
+	XPaths         []AliasedXPath
+	PollInterval   time.Duration
+	ResyncInterval time.Duration
+	GetTimeout     time.Duration
 }
 
 type AliasedXPath struct {
@@ -30,8 +32,6 @@ func AliasXPath(alias, xpath string) AliasedXPath {
 }
 
 func NewStream(logger kitlog.Logger, crm *Pacemaker, opt StreamOptions) (<-chan *mvccpb.KeyValue, <-chan struct{}) {
-	out, done := make(chan *mvccpb.KeyValue), make(chan struct{})
-
 	// Precompute the xpaths in a form that is easily supplied to crm.Get()
 	xpaths := make([]string, 0)
 	for _, ax := range opt.XPaths {
@@ -40,13 +40,79 @@ func NewStream(logger kitlog.Logger, crm *Pacemaker, opt StreamOptions) (<-chan
 
 	logger = kitlog.With(logger, "xpaths", strings.Join(xpaths, ","))
 
+	return poll(logger, crm, opt, func(ctx context.Context) ([]*mvccpb.KeyValue, error) {
+		nodes, err := crm.Get(ctx, xpaths...)
+		if err != nil {
+			return nil, err
+		}
+
+		kvs := make([]*mvccpb.KeyValue, 0)
+		for idx, ax := range opt.XPaths {
+			if nodes[idx] == nil {
+				continue
+			}
+
+			kvs = append(kvs, &mvccpb.KeyValue{
+				Key:   []byte(ax.Alias),
+				Value: []byte(nodes[idx].SelectAttrValue(opt.Attribute, "")),
+			})
+		}
+
+		return kvs, nil
+	})
+}
+
+// NewTopologyStream polls pacemaker for the cluster topology, pushing it down the output
+// channel as JSON under the given key. Attribute and XPaths options are ignored.
+func NewTopologyStream(logger kitlog.Logger, crm *Pacemaker, key string, opt StreamOptions) (<-chan *mvccpb.KeyValue, <-chan struct{}) {
+	logger = kitlog.With(logger, "key", key)
+
+	return poll(logger, crm, opt, func(ctx context.Context) ([]*mvccpb.KeyValue, error) {
+		topology, err := crm.Topology(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := json.Marshal(topology)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*mvccpb.KeyValue{&mvccpb.KeyValue{Key: []byte(key), Value: value}}, nil
+	})
+}
+
+// poll checks the cib version on every poll interval, calling get and pushing the
+// resulting kvs down the output channel whenever the cib has changed. Querying the
+// version is cheap compared to parsing the entire cib, which allows us to poll frequently
+// and detect changes quickly.
+//
+// If we fail to query the version, we fall back to calling get on every interval. We'll
+// also call get once every resync interval, regardless of version, to ensure consumers
+// will eventually see our values even if they missed an earlier update.
+func poll(logger kitlog.Logger, crm *Pacemaker, opt StreamOptions, get func(context.Context) ([]*mvccpb.KeyValue, error)) (<-chan *mvccpb.KeyValue, <-chan struct{}) {
+	out, done := make(chan *mvccpb.KeyValue), make(chan struct{})
+
 	go func() {
+		var lastVersion Version
+		var lastSync time.Time
+
 		for {
 			select {
 			case <-time.After(opt.PollInterval):
-				logger.Log("event", "poll.start")
 				getCtx, cancel := context.WithTimeout(opt.Ctx, opt.GetTimeout)
-				nodes, err := crm.Get(getCtx, xpaths...)
+				version, err := crm.Version(getCtx)
+
+				if err != nil {
+					logger.Log("event", "poll.version_error", "error", err,
+						"msg", "failed to query cib version, falling back to full query")
+				} else if version == lastVersion && !resyncDue(opt, lastSync) {
+					cancel()
+					continue
+				}
+
+				logger.Log("event", "poll.start", "version", version.String())
+				kvs, err := get(getCtx)
 				cancel()
 
 				if err != nil {
@@ -54,15 +120,10 @@ func NewStream(logger kitlog.Logger, crm *Pacemaker, opt StreamOptions) (<-chan
 					continue
 				}
 
-				for idx, ax := range opt.XPaths {
-					if nodes[idx] == nil {
-						continue
-					}
+				lastVersion, lastSync = version, time.Now()
 
-					out <- &mvccpb.KeyValue{
-						Key:   []byte(ax.Alias),
-						Value: []byte(nodes[idx].SelectAttrValue(opt.Attribute, "")),
-					}
+				for _, kv := range kvs {
+					out <- kv
 				}
 			case <-opt.Ctx.Done():
 				logger.Log("event", "poll.stop", "msg", "context expired, stopping")
@@ -76,3 +137,7 @@ func NewStream(logger kitlog.Logger, crm *Pacemaker, opt StreamOptions) (<-chan
 
 	return out, done
 }
+
+func resyncDue(opt StreamOptions, lastSync time.Time) bool {
+	return opt.ResyncInterval > 0 && time.Since(lastSync) >= opt.ResyncInterval
+}
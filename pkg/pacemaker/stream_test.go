@@ -1,7 +1,10 @@
 package pacemaker
 
 import (
+	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/context"
@@ -34,24 +37,26 @@ var _ = Describe("NewStream", func() {
 		cancel()
 	})
 
+	// loadFixtures mocks both the version and full cib queries. The root cib element of
+	// each fixture provides the version, so we can return the whole fixture for both.
 	loadFixtures := func(fixtures ...string) {
 		for _, fixture := range fixtures {
 			content, err := ioutil.ReadFile(fixture)
 			Expect(err).NotTo(HaveOccurred())
 
-			executor.
-				On("CombinedOutput",
-					mock.Anything, "cibadmin", []string{"--query", "--local"},
-				).
-				Return(content, nil).
-				Once()
+			for _, args := range [][]string{versionArgs, queryArgs} {
+				executor.
+					On("CombinedOutput", mock.Anything, "cibadmin", args).
+					Return(content, nil).
+					Once()
+			}
 		}
 
-		executor.
-			On("CombinedOutput",
-				mock.Anything, "cibadmin", []string{"--query", "--local"},
-			).
-			Return([]byte(""), nil)
+		for _, args := range [][]string{versionArgs, queryArgs} {
+			executor.
+				On("CombinedOutput", mock.Anything, "cibadmin", args).
+				Return([]byte(""), nil)
+		}
 	}
 
 	newStream := func() <-chan *mvccpb.KeyValue {
@@ -109,4 +114,101 @@ var _ = Describe("NewStream", func() {
 			cancel()
 		})
 	})
+
+	Context("With unchanged cib version", func() {
+		var queries int32
+
+		BeforeEach(func() {
+			content, err := ioutil.ReadFile("./testdata/cib_sync_async_master.xml")
+			Expect(err).NotTo(HaveOccurred())
+
+			atomic.StoreInt32(&queries, 0)
+			executor.On("CombinedOutput", mock.Anything, "cibadmin", versionArgs).Return(content, nil)
+			executor.
+				On("CombinedOutput", mock.Anything, "cibadmin", queryArgs).
+				Return(content, nil).
+				Run(func(mock.Arguments) { atomic.AddInt32(&queries, 1) })
+		})
+
+		It("Queries the full cib only once", func() {
+			out := newStream()
+
+			Eventually(out).Should(Receive(matchKv("master", "pg03")))
+			Eventually(out).Should(Receive(matchKv("sync", "pg01")))
+			Consistently(out, 50*time.Millisecond).ShouldNot(Receive())
+
+			Expect(atomic.LoadInt32(&queries)).To(BeEquivalentTo(1))
+			cancel()
+		})
+	})
+
+	Context("When cib version is unavailable", func() {
+		BeforeEach(func() {
+			content, err := ioutil.ReadFile("./testdata/cib_sync_async_master.xml")
+			Expect(err).NotTo(HaveOccurred())
+
+			executor.
+				On("CombinedOutput", mock.Anything, "cibadmin", versionArgs).
+				Return([]byte("cibadmin: unrecognized option '--no-children'"), errors.New("exit status 64"))
+			executor.On("CombinedOutput", mock.Anything, "cibadmin", queryArgs).Return(content, nil)
+		})
+
+		It("Falls back to querying the full cib on every interval", func() {
+			out := newStream()
+
+			for i := 0; i < 3; i++ {
+				Eventually(out).Should(Receive(matchKv("master", "pg03")))
+				Eventually(out).Should(Receive(matchKv("sync", "pg01")))
+			}
+
+			cancel()
+		})
+	})
+})
+
+var (
+	versionArgs = []string{"--query", "--local", "--xpath", "/cib", "--no-children"}
+	queryArgs   = []string{"--query", "--local"}
+)
+
+var _ = Describe("NewTopologyStream", func() {
+	var (
+		ctx      context.Context
+		cancel   func()
+		crm      *Pacemaker
+		executor *fakeExecutor
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+		executor = new(fakeExecutor)
+		crm = &Pacemaker{executor: executor}
+
+		content, err := ioutil.ReadFile("./testdata/cib_sync_async_master.xml")
+		Expect(err).NotTo(HaveOccurred())
+
+		executor.On("CombinedOutput", mock.Anything, "cibadmin", versionArgs).Return(content, nil)
+		executor.On("CombinedOutput", mock.Anything, "cibadmin", queryArgs).Return(content, nil)
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("Pushes JSON encoded topology down channel", func() {
+		out, _ := NewTopologyStream(
+			kitlog.NewLogfmtLogger(GinkgoWriter), crm, "/topology",
+			StreamOptions{Ctx: ctx, PollInterval: time.Millisecond},
+		)
+
+		var kv *mvccpb.KeyValue
+		Eventually(out).Should(Receive(&kv))
+
+		var topology Topology
+		Expect(string(kv.Key)).To(Equal("/topology"))
+		Expect(json.Unmarshal(kv.Value, &topology)).To(Succeed())
+		Expect(topology.Role(RoleMaster).Name).To(Equal("pg03"))
+
+		cancel()
+	})
 })
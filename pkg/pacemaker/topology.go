@@ -0,0 +1,133 @@
+package pacemaker
+
+import (
+	"fmt"
+
+	"github.com/beevik/etree"
+	"golang.org/x/net/context"
+)
+
+type Role string
+
+const (
+	RoleMaster  Role = "master"
+	RoleSync    Role = "sync"
+	RoleAsync   Role = "async"
+	RoleStopped Role = "stopped"
+)
+
+// Topology is a snapshot of the cluster, as viewed from the local cib. It is intended to
+// be serialised as JSON so consumers can inspect cluster state without access to
+// pacemaker.
+type Topology struct {
+	Quorate bool   `json:"quorate"`
+	DC      string `json:"dc,omitempty"` // name of the designated controller, if any
+	Nodes   []Node `json:"nodes"`
+}
+
+// Node describes a pacemaker node and the role of the Postgres instance it hosts.
+// Attributes include both permanent and transient (status) node attributes, with
+// transient values taking precedence.
+type Node struct {
+	Name       string            `json:"name"`
+	ID         string            `json:"id"`
+	Address    string            `json:"address,omitempty"`
+	Role       Role              `json:"role"`
+	Online     bool              `json:"online"`
+	Standby    bool              `json:"standby"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// Node returns the node with the given name, or nil if no such node exists
+func (t *Topology) Node(name string) *Node {
+	for idx := range t.Nodes {
+		if t.Nodes[idx].Name == name {
+			return &t.Nodes[idx]
+		}
+	}
+
+	return nil
+}
+
+// Role returns the first node with the given role, or nil if no node has that role
+func (t *Topology) Role(role Role) *Node {
+	for idx := range t.Nodes {
+		if t.Nodes[idx].Role == role {
+			return &t.Nodes[idx]
+		}
+	}
+
+	return nil
+}
+
+// Topology builds a Topology from the local cib. Unlike Get, we don't error when the
+// cluster has no quorum, as quorum state is part of what we want to report.
+func (p Pacemaker) Topology(ctx context.Context) (*Topology, error) {
+	doc, err := p.Query(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseTopology(doc, p.Profile())
+}
+
+// ParseTopology extracts the cluster topology from a cib document, using the profile to
+// determine the role of each node.
+func ParseTopology(doc *etree.Document, profile Profile) (*Topology, error) {
+	cib := doc.SelectElement("cib")
+	if cib == nil {
+		return nil, fmt.Errorf("cib document has no root cib element")
+	}
+
+	topology := &Topology{Quorate: quorate(doc), DC: designatedController(doc), Nodes: []Node{}}
+
+	for _, element := range doc.FindElements("//configuration/nodes/node") {
+		node := Node{
+			Name:       element.SelectAttrValue("uname", ""),
+			ID:         element.SelectAttrValue("id", ""),
+			Role:       RoleStopped,
+			Attributes: map[string]string{},
+		}
+
+		permanent := collectAttributes(element, "instance_attributes/nvpair")
+		transient := map[string]string{}
+
+		state := cib.FindElement(fmt.Sprintf("status/node_state[@id='%s']", node.ID))
+		if state != nil {
+			node.Online = state.SelectAttrValue("crmd", "") == "online" &&
+				state.SelectAttrValue("in_ccm", "") == "true"
+			transient = collectAttributes(state, "transient_attributes/instance_attributes/nvpair")
+		}
+
+		for name, value := range permanent {
+			node.Attributes[name] = value
+		}
+
+		for name, value := range transient {
+			node.Attributes[name] = value
+		}
+
+		// Standby is normally a permanent attribute, but can be set with a reboot lifetime
+		node.Standby = node.Attributes["standby"] == "on"
+
+		roleAttributes := permanent
+		if profile.Transient {
+			roleAttributes = transient
+		}
+
+		node.Role = profile.Role(roleAttributes[profile.Attribute])
+
+		topology.Nodes = append(topology.Nodes, node)
+	}
+
+	return topology, nil
+}
+
+func collectAttributes(element *etree.Element, path string) map[string]string {
+	attributes := map[string]string{}
+	for _, nvpair := range element.FindElements(path) {
+		attributes[nvpair.SelectAttrValue("name", "")] = nvpair.SelectAttrValue("value", "")
+	}
+
+	return attributes
+}
@@ -0,0 +1,150 @@
+package pacemaker
+
+import (
+	"io/ioutil"
+
+	"github.com/beevik/etree"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+)
+
+var _ = Describe("ParseTopology", func() {
+	parse := func(fixture string, profile Profile) *Topology {
+		content, err := ioutil.ReadFile(fixture)
+		Expect(err).NotTo(HaveOccurred())
+
+		doc := etree.NewDocument()
+		Expect(doc.ReadFromBytes(content)).To(Succeed())
+
+		topology, err := ParseTopology(doc, profile)
+		Expect(err).NotTo(HaveOccurred())
+
+		return topology
+	}
+
+	Context("With full cluster", func() {
+		var topology *Topology
+
+		BeforeEach(func() {
+			topology = parse("./testdata/cib_sync_async_master.xml", PgsqlProfile)
+		})
+
+		It("Is quorate", func() {
+			Expect(topology.Quorate).To(BeTrue())
+		})
+
+		It("Identifies the designated controller", func() {
+			Expect(topology.DC).To(Equal("pg01"))
+		})
+
+		It("Assigns roles to each node", func() {
+			Expect(topology.Nodes).To(
+				ConsistOf(
+					MatchFields(IgnoreExtras, Fields{"Name": Equal("pg01"), "ID": Equal("1"), "Role": Equal(RoleSync)}),
+					MatchFields(IgnoreExtras, Fields{"Name": Equal("pg02"), "ID": Equal("2"), "Role": Equal(RoleAsync)}),
+					MatchFields(IgnoreExtras, Fields{"Name": Equal("pg03"), "ID": Equal("3"), "Role": Equal(RoleMaster)}),
+				),
+			)
+		})
+
+		It("Merges permanent and transient attributes", func() {
+			Expect(topology.Node("pg03").Attributes).To(
+				Equal(
+					map[string]string{
+						"Postgresql-data-status":     "LATEST",
+						"Postgresql-status":          "PRI",
+						"Postgresql-master-baseline": "0000000002000090",
+						"master-Postgresql":          "1000",
+						"probe_complete":             "true",
+					},
+				),
+			)
+		})
+
+		It("Marks nodes as online", func() {
+			Expect(topology.Node("pg01").Online).To(BeTrue())
+		})
+
+		It("Finds nodes by role", func() {
+			Expect(topology.Role(RoleMaster).Name).To(Equal("pg03"))
+		})
+	})
+
+	Context("With no quorum", func() {
+		var topology *Topology
+
+		BeforeEach(func() {
+			topology = parse("./testdata/cib_master_died_died.xml", PgsqlProfile)
+		})
+
+		It("Is not quorate", func() {
+			Expect(topology.Quorate).To(BeFalse())
+		})
+
+		It("Marks failed nodes as offline", func() {
+			Expect(topology.Node("pg02").Online).To(BeFalse())
+			Expect(topology.Node("pg03").Online).To(BeFalse())
+		})
+	})
+
+	Context("With PAF resource agent", func() {
+		var topology *Topology
+
+		BeforeEach(func() {
+			topology = parse("./testdata/cib_paf_sync_async_master.xml", PAFProfile)
+		})
+
+		It("Assigns roles from transient attributes", func() {
+			Expect(topology.Role(RoleMaster).Name).To(Equal("pg03"))
+			Expect(topology.Role(RoleSync).Name).To(Equal("pg01"))
+			Expect(topology.Role(RoleAsync).Name).To(Equal("pg02"))
+		})
+
+		It("Classifies every lag-ranked replica as async", func() {
+			topology = parse("./testdata/cib_paf_sync_two_async_master.xml", PAFProfile)
+
+			Expect(topology.Node("pg02").Role).To(Equal(RoleAsync))
+			Expect(topology.Node("pg04").Role).To(Equal(RoleAsync))
+		})
+	})
+})
+
+var _ = Describe("Profile", func() {
+	Describe("Role", func() {
+		cases := []struct {
+			value string
+			role  Role
+		}{
+			{"1001", RoleMaster},
+			{"1000", RoleSync},
+			{"990", RoleAsync},
+			{"10", RoleAsync},
+			{"0", RoleStopped},
+			{"-1", RoleStopped},
+			{"", RoleStopped},
+		}
+
+		for _, tc := range cases {
+			tc := tc
+
+			It("Classifies PAF score '"+tc.value+"' as "+string(tc.role), func() {
+				Expect(PAFProfile.Role(tc.value)).To(Equal(tc.role))
+			})
+		}
+	})
+
+	Describe("ParseScoreRange", func() {
+		It("Parses exclusive bounds", func() {
+			Expect(ParseScoreRange("0, 1000")).To(Equal([2]int{0, 1000}))
+		})
+
+		It("Rejects malformed ranges", func() {
+			for _, value := range []string{"", "1000", "0,high", "1000,0"} {
+				_, err := ParseScoreRange(value)
+				Expect(err).To(HaveOccurred(), value)
+			}
+		})
+	})
+})
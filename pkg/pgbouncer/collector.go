@@ -0,0 +1,150 @@
+package pgbouncer
+
+import (
+	"context"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stater is satisfied by PgBouncer, and allows stubbing in tests
+type stater interface {
+	ShowDatabases(context.Context) ([]Database, error)
+	ShowPools(context.Context) ([]Pool, error)
+	ShowStats(context.Context) ([]Stats, error)
+	Paused() bool
+}
+
+func newDesc(name, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName("pgbouncer", "", name), help, labels, nil)
+}
+
+var (
+	upDesc       = newDesc("up", "Whether the last scrape of PgBouncer succeeded")
+	globalDesc   = newDesc("paused", "Whether we last paused PgBouncer as a whole, rather than resumed it")
+	pausedDesc   = newDesc("database_paused", "Whether the database is paused (PgBouncer 1.8+)", "database")
+	disabledDesc = newDesc("database_disabled", "Whether the database is disabled (PgBouncer 1.8+)", "database")
+
+	clientsActiveDesc  = newDesc("pools_client_active_connections", "Client connections linked to a server connection", "database", "user")
+	clientsWaitingDesc = newDesc("pools_client_waiting_connections", "Client connections waiting on a server connection", "database", "user")
+	serversActiveDesc  = newDesc("pools_server_active_connections", "Server connections linked to a client", "database", "user")
+	serversIdleDesc    = newDesc("pools_server_idle_connections", "Server connections idle and ready for a client", "database", "user")
+	serversUsedDesc    = newDesc("pools_server_used_connections", "Server connections idle for more than server_check_delay", "database", "user")
+	serversTestedDesc  = newDesc("pools_server_testing_connections", "Server connections running server_reset_query or server_check_query", "database", "user")
+	serversLoginDesc   = newDesc("pools_server_login_connections", "Server connections in the process of logging in", "database", "user")
+	maxWaitDesc        = newDesc("pools_client_maxwait_seconds", "Age of the oldest waiting client", "database", "user")
+
+	queriesDesc      = newDesc("stats_queries_pooled_total", "Queries pooled by PgBouncer", "database")
+	transactionsDesc = newDesc("stats_transactions_pooled_total", "Transactions pooled by PgBouncer (PgBouncer 1.8+)", "database")
+	receivedDesc     = newDesc("stats_received_bytes_total", "Bytes received from clients", "database")
+	sentDesc         = newDesc("stats_sent_bytes_total", "Bytes sent to clients", "database")
+	queryTimeDesc    = newDesc("stats_queries_duration_seconds_total", "Time spent by PgBouncer actively querying Postgres", "database")
+	waitTimeDesc     = newDesc("stats_client_wait_seconds_total", "Time spent by clients waiting for a server connection (PgBouncer 1.8+)", "database")
+	avgWaitTimeDesc  = newDesc("stats_average_wait_seconds", "Average time clients waited for a server over the last stats_period", "database")
+)
+
+// Collector exports PgBouncer pools and stats as Prometheus metrics, reading them from
+// PgBouncer whenever we're scraped.
+//
+// Scrapes share the admin connection with commands such as PAUSE, which may wait on a
+// scrape that's in progress, so the timeout should be short.
+type Collector struct {
+	logger  kitlog.Logger
+	bouncer stater
+	timeout time.Duration
+}
+
+func NewCollector(logger kitlog.Logger, bouncer stater, timeout time.Duration) *Collector {
+	return &Collector{logger: logger, bouncer: bouncer, timeout: timeout}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		upDesc, globalDesc, pausedDesc, disabledDesc,
+		clientsActiveDesc, clientsWaitingDesc, serversActiveDesc, serversIdleDesc,
+		serversUsedDesc, serversTestedDesc, serversLoginDesc, maxWaitDesc,
+		queriesDesc, transactionsDesc, receivedDesc, sentDesc, queryTimeDesc, waitTimeDesc,
+		avgWaitTimeDesc,
+	} {
+		ch <- desc
+	}
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	// We track the pause state ourselves, so can report it even if PgBouncer is unreachable
+	ch <- prometheus.MustNewConstMetric(globalDesc, prometheus.GaugeValue, boolToFloat(c.bouncer.Paused()))
+
+	if err := c.collect(ctx, ch); err != nil {
+		c.logger.Log("event", "pgbouncer.scrape_error", "error", err)
+		ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 0)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, 1)
+}
+
+func (c *Collector) collect(ctx context.Context, ch chan<- prometheus.Metric) error {
+	databases, err := c.bouncer.ShowDatabases(ctx)
+	if err != nil {
+		return err
+	}
+
+	pools, err := c.bouncer.ShowPools(ctx)
+	if err != nil {
+		return err
+	}
+
+	stats, err := c.bouncer.ShowStats(ctx)
+	if err != nil {
+		return err
+	}
+
+	gauge := func(desc *prometheus.Desc, value float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+	}
+
+	counter := func(desc *prometheus.Desc, value float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, labels...)
+	}
+
+	for _, db := range databases {
+		gauge(pausedDesc, boolToFloat(db.Paused), db.Name)
+		gauge(disabledDesc, boolToFloat(db.Disabled), db.Name)
+	}
+
+	for _, pool := range pools {
+		gauge(clientsActiveDesc, float64(pool.ClientsActive), pool.Database, pool.User)
+		gauge(clientsWaitingDesc, float64(pool.ClientsWaiting), pool.Database, pool.User)
+		gauge(serversActiveDesc, float64(pool.ServersActive), pool.Database, pool.User)
+		gauge(serversIdleDesc, float64(pool.ServersIdle), pool.Database, pool.User)
+		gauge(serversUsedDesc, float64(pool.ServersUsed), pool.Database, pool.User)
+		gauge(serversTestedDesc, float64(pool.ServersTested), pool.Database, pool.User)
+		gauge(serversLoginDesc, float64(pool.ServersLogin), pool.Database, pool.User)
+		gauge(maxWaitDesc, pool.MaxWait().Seconds(), pool.Database, pool.User)
+	}
+
+	// PgBouncer reports times in microseconds
+	for _, stat := range stats {
+		counter(queriesDesc, float64(stat.TotalQueryCount), stat.Database)
+		counter(transactionsDesc, float64(stat.TotalXactCount), stat.Database)
+		counter(receivedDesc, float64(stat.TotalReceived), stat.Database)
+		counter(sentDesc, float64(stat.TotalSent), stat.Database)
+		counter(queryTimeDesc, float64(stat.TotalQueryTime)/1e6, stat.Database)
+		counter(waitTimeDesc, float64(stat.TotalWaitTime)/1e6, stat.Database)
+		gauge(avgWaitTimeDesc, float64(stat.AverageWaitTime)/1e6, stat.Database)
+	}
+
+	return nil
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,165 @@
+package pgbouncer_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pgbouncer"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/mock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeStater struct{ mock.Mock }
+
+func (s *fakeStater) ShowDatabases(ctx context.Context) ([]pgbouncer.Database, error) {
+	args := s.Called(ctx)
+	return args.Get(0).([]pgbouncer.Database), args.Error(1)
+}
+
+func (s *fakeStater) ShowPools(ctx context.Context) ([]pgbouncer.Pool, error) {
+	args := s.Called(ctx)
+	return args.Get(0).([]pgbouncer.Pool), args.Error(1)
+}
+
+func (s *fakeStater) ShowStats(ctx context.Context) ([]pgbouncer.Stats, error) {
+	args := s.Called(ctx)
+	return args.Get(0).([]pgbouncer.Stats), args.Error(1)
+}
+
+func (s *fakeStater) Paused() bool {
+	return s.Called().Bool(0)
+}
+
+var _ = Describe("Collector", func() {
+	var (
+		bouncer  *fakeStater
+		registry *prometheus.Registry
+	)
+
+	BeforeEach(func() {
+		bouncer = new(fakeStater)
+		bouncer.On("Paused").Return(false)
+		registry = prometheus.NewRegistry()
+		registry.MustRegister(pgbouncer.NewCollector(kitlog.NewNopLogger(), bouncer, time.Second))
+	})
+
+	// gather returns the value of each metric, keyed by name and the value of its first
+	// label, such as pgbouncer_database_paused/postgres
+	gather := func() map[string]float64 {
+		families, err := registry.Gather()
+		Expect(err).NotTo(HaveOccurred())
+
+		values := map[string]float64{}
+		for _, family := range families {
+			for _, metric := range family.Metric {
+				key := family.GetName()
+				if len(metric.Label) > 0 {
+					key += "/" + metric.Label[0].GetValue()
+				}
+
+				values[key] = value(metric)
+			}
+		}
+
+		return values
+	}
+
+	Context("When PgBouncer responds", func() {
+		BeforeEach(func() {
+			bouncer.On("ShowDatabases", mock.Anything).Return([]pgbouncer.Database{{Name: "postgres", Paused: true}}, nil)
+			bouncer.On("ShowPools", mock.Anything).Return([]pgbouncer.Pool{
+				{Database: "postgres", User: "app", ClientsActive: 4, ClientsWaiting: 2, MaxWaitMicros: 250000},
+			}, nil)
+			bouncer.On("ShowStats", mock.Anything).Return([]pgbouncer.Stats{
+				{Database: "postgres", TotalQueryCount: 100, TotalXactCount: 50, TotalWaitTime: 1500000, AverageWaitTime: 2000},
+			}, nil)
+		})
+
+		It("Exports pools, stats and pause state", func() {
+			Expect(gather()).To(And(
+				HaveKeyWithValue("pgbouncer_up", 1.0),
+				HaveKeyWithValue("pgbouncer_paused", 0.0),
+				HaveKeyWithValue("pgbouncer_database_paused/postgres", 1.0),
+				HaveKeyWithValue("pgbouncer_database_disabled/postgres", 0.0),
+				HaveKeyWithValue("pgbouncer_pools_client_active_connections/postgres", 4.0),
+				HaveKeyWithValue("pgbouncer_pools_client_waiting_connections/postgres", 2.0),
+				HaveKeyWithValue("pgbouncer_pools_client_maxwait_seconds/postgres", 0.25),
+				HaveKeyWithValue("pgbouncer_stats_queries_pooled_total/postgres", 100.0),
+				HaveKeyWithValue("pgbouncer_stats_transactions_pooled_total/postgres", 50.0),
+				HaveKeyWithValue("pgbouncer_stats_client_wait_seconds_total/postgres", 1.5),
+				HaveKeyWithValue("pgbouncer_stats_average_wait_seconds/postgres", 0.002),
+			))
+		})
+	})
+
+	Context("When PgBouncer fails", func() {
+		BeforeEach(func() {
+			bouncer.On("ShowDatabases", mock.Anything).Return([]pgbouncer.Database{}, errors.New("connection refused"))
+		})
+
+		It("Reports PgBouncer as down", func() {
+			Expect(gather()).To(Equal(map[string]float64{"pgbouncer_up": 0, "pgbouncer_paused": 0}))
+		})
+	})
+
+	Context("When we have paused PgBouncer", func() {
+		BeforeEach(func() {
+			bouncer.ExpectedCalls = nil
+			bouncer.On("Paused").Return(true)
+			bouncer.On("ShowDatabases", mock.Anything).Return([]pgbouncer.Database{}, errors.New("connection refused"))
+		})
+
+		It("Reports the pause state, even when PgBouncer is unreachable", func() {
+			Expect(gather()).To(HaveKeyWithValue("pgbouncer_paused", 1.0))
+		})
+	})
+
+	Context("When pausing through PgBouncer", func() {
+		var (
+			pgBouncer *pgbouncer.PgBouncer
+			executor  *fakeExecutor
+		)
+
+		BeforeEach(func() {
+			executor = &fakeExecutor{}
+			pgBouncer = &pgbouncer.PgBouncer{Executor: executor}
+
+			registry = prometheus.NewRegistry()
+			registry.MustRegister(pgbouncer.NewCollector(kitlog.NewNopLogger(), pgBouncer, time.Second))
+		})
+
+		It("Reports the pause state as we pause and resume", func() {
+			Expect(pgBouncer.Pause(context.Background())).To(Succeed())
+			Expect(gather()).To(HaveKeyWithValue("pgbouncer_paused", 1.0))
+
+			Expect(pgBouncer.Resume(context.Background())).To(Succeed())
+			Expect(gather()).To(HaveKeyWithValue("pgbouncer_paused", 0.0))
+		})
+
+		It("Reports PgBouncer as paused when PAUSE times out", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 0)
+			defer cancel()
+			executor.err = ctx.Err()
+
+			Expect(pgBouncer.Pause(ctx)).NotTo(Succeed())
+			Expect(gather()).To(HaveKeyWithValue("pgbouncer_paused", 1.0))
+		})
+	})
+})
+
+func value(metric *dto.Metric) float64 {
+	switch {
+	case metric.Gauge != nil:
+		return metric.Gauge.GetValue()
+	case metric.Counter != nil:
+		return metric.Counter.GetValue()
+	}
+
+	return 0
+}
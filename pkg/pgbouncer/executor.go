@@ -2,7 +2,15 @@ package pgbouncer
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/jackc/pgx"
 	"github.com/jackc/pgx/pgtype"
@@ -10,63 +18,371 @@ import (
 )
 
 type executor interface {
-	Query(context.Context, string, ...interface{}) (*pgx.Rows, error)
+	Query(context.Context, string, func(*pgx.Rows) error, ...interface{}) error
 	Execute(context.Context, string, ...interface{}) error
+	Ping(context.Context) error
+	Close() error
 }
 
+// AuthorizedExecutor runs commands against the PgBouncer admin console over a single
+// long-lived connection, which is opened on first use and reopened whenever it breaks.
+// Holding the connection open means time-critical commands such as PAUSE don't wait on
+// connection setup.
+//
+// Commands are serialised, as the connection can only run one at a time. Callers waiting
+// their turn give up once their context expires.
+//
+// We connect to the unix socket in SocketDir unless given a Host, such as when PgBouncer
+// runs in a separate network namespace. TLS settings follow libpq's sslmode, and default
+// to prefer for TCP connections and disable for unix sockets.
 type AuthorizedExecutor struct {
 	User, Password, Database, SocketDir, Port string
+
+	Host         string // connect over TCP to this host, instead of SocketDir
+	PasswordFile string // read the password from this file on each connection, if set
+	SSLMode      string // disable, allow, prefer, require, verify-ca or verify-full
+	SSLRootCert  string // CA certificates to verify PgBouncer against
+	SSLCert      string // client certificate, if PgBouncer requires one
+	SSLKey       string // key for SSLCert
+
+	ConnectBackoff    time.Duration // initial delay between failed connection attempts, default 100ms
+	MaxConnectBackoff time.Duration // delay between attempts doubles until this, default 5s
+
+	once sync.Once
+	sem  chan struct{} // holds a token while a command uses conn
+	conn *pgx.Conn
 }
 
-func (e AuthorizedExecutor) Query(ctx context.Context, query string, params ...interface{}) (*pgx.Rows, error) {
-	conn, err := e.Connection()
+// Query runs the query, passing its rows to scan. Rows are closed once scan returns, so
+// must not be retained.
+func (e *AuthorizedExecutor) Query(ctx context.Context, query string, scan func(*pgx.Rows) error, params ...interface{}) error {
+	return e.withConnection(ctx, func(conn *pgx.Conn) error {
+		rows, err := conn.QueryEx(ctx, query, &pgx.QueryExOptions{SimpleProtocol: true}, params...)
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		return nil, err
+		defer rows.Close()
+		if err := scan(rows); err != nil {
+			return err
+		}
+
+		rows.Close()
+		return rows.Err()
+	})
+}
+
+func (e *AuthorizedExecutor) Execute(ctx context.Context, query string, params ...interface{}) error {
+	return e.withConnection(ctx, func(conn *pgx.Conn) error {
+		_, err := conn.ExecEx(ctx, query, &pgx.QueryExOptions{SimpleProtocol: true}, params...)
+		return err
+	})
+}
+
+// Ping checks the health of the connection, reconnecting if it has broken
+func (e *AuthorizedExecutor) Ping(ctx context.Context) error {
+	return e.Execute(ctx, `SHOW VERSION;`)
+}
+
+// Close closes the connection, if open. The executor may continue to be used, and will
+// reconnect when next needed.
+func (e *AuthorizedExecutor) Close() error {
+	e.lock(context.Background())
+	defer e.unlock()
+
+	return e.disconnect()
+}
+
+// withConnection runs fn against our connection, connecting first if necessary. Should
+// the connection break, such as when PgBouncer restarts, we reconnect and retry fn once.
+// All our admin commands are safe to repeat, and PAUSE/RESUME tolerate being applied
+// twice.
+func (e *AuthorizedExecutor) withConnection(ctx context.Context, fn func(*pgx.Conn) error) error {
+	if err := e.lock(ctx); err != nil {
+		return err
 	}
 
-	return conn.QueryEx(ctx, query, &pgx.QueryExOptions{SimpleProtocol: true}, params...)
+	defer e.unlock()
+
+	for attempt := 0; ; attempt++ {
+		if e.conn == nil {
+			if err := e.connect(ctx); err != nil {
+				return err
+			}
+		}
+
+		err := fn(e.conn)
+		if err == nil || e.conn.IsAlive() {
+			return err
+		}
+
+		// The connection is unusable, whether it broke or was abandoned mid-command when our
+		// context expired, so the next command will need a fresh one.
+		e.disconnect()
+
+		if attempt > 0 || ctx.Err() != nil {
+			return err
+		}
+	}
 }
 
-func (e AuthorizedExecutor) Execute(ctx context.Context, query string, params ...interface{}) error {
-	conn, err := e.Connection()
+// lock waits for our turn to use the connection, unless the context expires first. A
+// command stuck on a broken connection can hold it until its own context expires, and we
+// shouldn't leave others waiting beyond their deadlines.
+func (e *AuthorizedExecutor) lock(ctx context.Context) error {
+	e.once.Do(func() { e.sem = make(chan struct{}, 1) })
 
+	select {
+	case e.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "timed out waiting for PgBouncer connection")
+	}
+}
+
+func (e *AuthorizedExecutor) unlock() {
+	<-e.sem
+}
+
+// connect opens a connection, retrying with exponential backoff until the context
+// expires.
+func (e *AuthorizedExecutor) connect(ctx context.Context) error {
+	backoff, maxBackoff := e.ConnectBackoff, e.MaxConnectBackoff
+	if backoff == 0 {
+		backoff = 100 * time.Millisecond
+	}
+
+	if maxBackoff == 0 {
+		maxBackoff = 5 * time.Second
+	}
+
+	// Configuration errors won't be fixed by retrying, so we fail fast
+	config, err := e.ConnConfig()
 	if err != nil {
 		return err
 	}
 
-	_, err = conn.ExecEx(ctx, query, &pgx.QueryExOptions{SimpleProtocol: true}, params...)
+	for {
+		conn, err := dial(ctx, config)
+		if err == nil {
+			e.conn = conn
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(err, "failed to connect to PgBouncer")
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (e *AuthorizedExecutor) disconnect() error {
+	if e.conn == nil {
+		return nil
+	}
+
+	err := e.conn.Close()
+	e.conn = nil
+
 	return err
 }
 
-func (e AuthorizedExecutor) Connection() (*pgx.Conn, error) {
-	port, err := strconv.Atoi(e.Port)
+// Connection opens a new connection to the PgBouncer admin console, independent of the
+// one managed by the executor. Callers are responsible for closing it.
+func (e *AuthorizedExecutor) Connection(ctx context.Context) (*pgx.Conn, error) {
+	config, err := e.ConnConfig()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to parse valid port number")
-	}
-
-	return pgx.Connect(
-		pgx.ConnConfig{
-			Database:      e.Database,
-			User:          e.User,
-			Password:      e.Password,
-			Host:          e.SocketDir,
-			Port:          uint16(port),
-			RuntimeParams: map[string]string{"client_encoding": "UTF8"},
-			// We need to use SimpleProtocol in order to communicate with PgBouncer
-			PreferSimpleProtocol: true,
-			CustomConnInfo: func(_ *pgx.Conn) (*pgtype.ConnInfo, error) {
-				connInfo := pgtype.NewConnInfo()
-				connInfo.InitializeDataTypes(map[string]pgtype.OID{
-					"int4":    pgtype.Int4OID,
-					"name":    pgtype.NameOID,
-					"oid":     pgtype.OIDOID,
-					"text":    pgtype.TextOID,
-					"varchar": pgtype.VarcharOID,
-				})
-
-				return connInfo, nil
-			},
+		return nil, err
+	}
+
+	return dial(ctx, config)
+}
+
+// ConnConfig generates pgx configuration for connecting to the admin console
+func (e *AuthorizedExecutor) ConnConfig() (pgx.ConnConfig, error) {
+	config := pgx.ConnConfig{
+		Database:      e.Database,
+		User:          e.User,
+		Password:      e.Password,
+		Host:          e.SocketDir,
+		RuntimeParams: map[string]string{"client_encoding": "UTF8"},
+		// We need to use SimpleProtocol in order to communicate with PgBouncer
+		PreferSimpleProtocol: true,
+		CustomConnInfo: func(_ *pgx.Conn) (*pgtype.ConnInfo, error) {
+			connInfo := pgtype.NewConnInfo()
+			connInfo.InitializeDataTypes(map[string]pgtype.OID{
+				"int4":    pgtype.Int4OID,
+				"name":    pgtype.NameOID,
+				"oid":     pgtype.OIDOID,
+				"text":    pgtype.TextOID,
+				"varchar": pgtype.VarcharOID,
+			})
+
+			return connInfo, nil
 		},
-	)
+	}
+
+	port, err := strconv.Atoi(e.Port)
+	if err != nil {
+		return config, errors.Wrap(err, "failed to parse valid port number")
+	}
+
+	config.Port = uint16(port)
+
+	if e.PasswordFile != "" {
+		password, err := ioutil.ReadFile(e.PasswordFile)
+		if err != nil {
+			return config, errors.Wrap(err, "failed to read PgBouncer password file")
+		}
+
+		config.Password = strings.TrimRight(string(password), "\r\n")
+	}
+
+	sslMode := e.SSLMode
+	if e.Host != "" {
+		config.Host = e.Host
+		if sslMode == "" {
+			sslMode = "prefer"
+		}
+	}
+
+	return config, e.configureTLS(&config, sslMode)
+}
+
+// configureTLS applies the sslmode to the config, matching the behaviour of libpq
+func (e *AuthorizedExecutor) configureTLS(config *pgx.ConnConfig, sslMode string) error {
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+
+	switch sslMode {
+	case "", "disable":
+		return nil
+	case "allow":
+		config.UseFallbackTLS = true
+		config.FallbackTLSConfig = tlsConfig
+	case "prefer":
+		config.TLSConfig = tlsConfig
+		config.UseFallbackTLS = true
+	case "require":
+		config.TLSConfig = tlsConfig
+	case "verify-ca", "verify-full":
+		config.TLSConfig = tlsConfig
+		if e.SSLRootCert == "" {
+			return fmt.Errorf("sslmode %s requires a root certificate", sslMode)
+		}
+	default:
+		return fmt.Errorf("invalid sslmode: '%s'", sslMode)
+	}
+
+	if e.SSLRootCert != "" {
+		pem, err := ioutil.ReadFile(e.SSLRootCert)
+		if err != nil {
+			return errors.Wrap(err, "failed to read root certificate")
+		}
+
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", e.SSLRootCert)
+		}
+
+		// We verify certificates ourselves, as verify-ca must accept certificates issued to
+		// any host, which the standard verification won't allow.
+		tlsConfig.VerifyPeerCertificate = verifyPeer(roots, sslMode, config.Host)
+	}
+
+	if e.SSLCert != "" || e.SSLKey != "" {
+		cert, err := tls.LoadX509KeyPair(e.SSLCert, e.SSLKey)
+		if err != nil {
+			return errors.Wrap(err, "failed to load client certificate")
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return nil
+}
+
+// verifyPeer checks the server's certificate was issued by one of roots, and for
+// verify-full that it was issued to the host we're connecting to.
+func verifyPeer(roots *x509.CertPool, sslMode, host string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for idx, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return errors.Wrap(err, "failed to parse PgBouncer certificate")
+			}
+
+			certs[idx] = cert
+		}
+
+		if len(certs) == 0 {
+			return errors.New("PgBouncer presented no certificate")
+		}
+
+		opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+
+		if sslMode == "verify-full" {
+			opts.DNSName = host
+		}
+
+		_, err := certs[0].Verify(opts)
+		return err
+	}
+}
+
+// dial connects using the config. pgx doesn't accept a context when connecting, so we
+// apply its deadline to the socket for the whole of the TLS and startup handshake, which
+// would otherwise hang forever against a PgBouncer that accepts but never responds.
+//
+// pgx keeps config.Dial to open connections for cancelling queries, long after the
+// context has gone, so only dials made during the handshake are bound by it.
+func dial(ctx context.Context, config pgx.ConnConfig) (*pgx.Conn, error) {
+	dialer := &net.Dialer{KeepAlive: 5 * time.Minute}
+	deadline, hasDeadline := ctx.Deadline()
+
+	// pgx wraps the socket in TLS, so we keep hold of it to clear the deadline later
+	var socket net.Conn
+	handshake := true
+	config.Dial = func(network, address string) (net.Conn, error) {
+		if !handshake {
+			return dialer.Dial(network, address)
+		}
+
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		if hasDeadline {
+			if err := conn.SetDeadline(deadline); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+
+		socket = conn
+		return conn, nil
+	}
+
+	conn, err := pgx.Connect(config)
+	handshake = false
+	if err != nil {
+		return nil, err
+	}
+
+	// The connection is long-lived, and would break once the deadline passed
+	if err := socket.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
 }
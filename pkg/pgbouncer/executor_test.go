@@ -0,0 +1,202 @@
+package pgbouncer_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pgbouncer"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AuthorizedExecutor", func() {
+	var (
+		executor  *pgbouncer.AuthorizedExecutor
+		socketDir string
+	)
+
+	BeforeEach(func() {
+		var err error
+		socketDir, err = ioutil.TempDir("", "pgbouncer-socket-")
+		Expect(err).NotTo(HaveOccurred())
+
+		// Nothing listens in socketDir, so every connection attempt will fail
+		executor = &pgbouncer.AuthorizedExecutor{
+			User:           "pgbouncer",
+			Database:       "pgbouncer",
+			SocketDir:      socketDir,
+			Port:           "6432",
+			ConnectBackoff: 10 * time.Millisecond,
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(socketDir)
+	})
+
+	Context("When PgBouncer is unavailable", func() {
+		It("Retries connecting until the context expires", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			err := executor.Execute(ctx, `SHOW VERSION;`)
+
+			Expect(err).To(MatchError(ContainSubstring("failed to connect to PgBouncer")))
+			Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+		})
+	})
+
+	Context("When PgBouncer accepts connections but never responds", func() {
+		var listener net.Listener
+
+		BeforeEach(func() {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+
+					defer conn.Close()
+				}
+			}()
+
+			executor.Host, executor.SSLMode = "127.0.0.1", "disable"
+			executor.Port = strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+		})
+
+		AfterEach(func() {
+			listener.Close()
+		})
+
+		It("Gives up on the handshake once the context expires", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			done := make(chan error, 1)
+			go func() { done <- executor.Execute(ctx, `SHOW VERSION;`) }()
+
+			Eventually(done, time.Second).Should(Receive(MatchError(ContainSubstring("failed to connect to PgBouncer"))))
+		})
+
+		It("Stops waiting on a stuck command once the context expires", func() {
+			stuckCtx, cancelStuck := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancelStuck()
+
+			stuck := make(chan error, 1)
+			go func() { stuck <- executor.Execute(stuckCtx, `SHOW VERSION;`) }()
+			time.Sleep(50 * time.Millisecond)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			done := make(chan error, 1)
+			go func() { done <- executor.Execute(ctx, `PAUSE;`) }()
+
+			Eventually(done, time.Second).Should(Receive(MatchError(ContainSubstring("timed out waiting for PgBouncer connection"))))
+			Expect(stuck).NotTo(Receive())
+		})
+	})
+
+	It("Closes without an open connection", func() {
+		Expect(executor.Close()).To(Succeed())
+	})
+
+	Describe("ConnConfig", func() {
+		It("Connects to the unix socket without TLS by default", func() {
+			config, err := executor.ConnConfig()
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Host).To(Equal(socketDir))
+			Expect(config.Port).To(BeEquivalentTo(6432))
+			Expect(config.TLSConfig).To(BeNil())
+		})
+
+		It("Prefers TLS over TCP", func() {
+			executor.Host = "pgbouncer.internal"
+			config, err := executor.ConnConfig()
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Host).To(Equal("pgbouncer.internal"))
+			Expect(config.TLSConfig).NotTo(BeNil())
+			Expect(config.UseFallbackTLS).To(BeTrue())
+		})
+
+		It("Reads the password file", func() {
+			passwordFile := filepath.Join(socketDir, "password")
+			Expect(ioutil.WriteFile(passwordFile, []byte("secret\n"), 0600)).To(Succeed())
+
+			executor.PasswordFile = passwordFile
+			config, err := executor.ConnConfig()
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Password).To(Equal("secret"))
+		})
+
+		It("Rejects invalid sslmodes", func() {
+			executor.SSLMode = "sometimes"
+			_, err := executor.ConnConfig()
+
+			Expect(err).To(MatchError("invalid sslmode: 'sometimes'"))
+		})
+
+		It("Requires a root certificate to verify PgBouncer", func() {
+			executor.SSLMode = "verify-full"
+			_, err := executor.ConnConfig()
+
+			Expect(err).To(MatchError("sslmode verify-full requires a root certificate"))
+		})
+
+		Context("When verifying PgBouncer", func() {
+			var (
+				server *httptest.Server
+			)
+
+			BeforeEach(func() {
+				// httptest provides a certificate for example.com, which we trust as our root
+				server = httptest.NewTLSServer(nil)
+
+				rootCert := filepath.Join(socketDir, "root.crt")
+				Expect(ioutil.WriteFile(rootCert, pem.EncodeToMemory(
+					&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw},
+				), 0644)).To(Succeed())
+
+				executor.SSLRootCert = rootCert
+			})
+
+			AfterEach(func() {
+				server.Close()
+			})
+
+			verify := func(host, sslMode string) error {
+				executor.Host, executor.SSLMode = host, sslMode
+				config, err := executor.ConnConfig()
+				Expect(err).NotTo(HaveOccurred())
+
+				return config.TLSConfig.VerifyPeerCertificate([][]byte{server.Certificate().Raw}, nil)
+			}
+
+			It("Checks the host with verify-full", func() {
+				Expect(verify("example.com", "verify-full")).To(Succeed())
+				Expect(verify("pgbouncer.internal", "verify-full")).NotTo(Succeed())
+			})
+
+			It("Accepts any host with verify-ca", func() {
+				Expect(verify("pgbouncer.internal", "verify-ca")).To(Succeed())
+			})
+		})
+	})
+})
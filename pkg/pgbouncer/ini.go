@@ -0,0 +1,134 @@
+package pgbouncer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// INI is a parsed PgBouncer config file, mapping each section to its settings
+type INI map[string]map[string]string
+
+// ParseINI parses config in the format accepted by PgBouncer, rejecting anything
+// PgBouncer would fail to load, such as settings outside of a section.
+func ParseINI(config []byte) (INI, error) {
+	ini := INI{}
+	section := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(config))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "", strings.HasPrefix(line, ";"), strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "%include"):
+			continue // PgBouncer reads included files itself, which we can't validate
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") {
+				return nil, errors.Errorf("line %d: malformed section header '%s'", lineNo, line)
+			}
+
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := ini[section]; !ok {
+				ini[section] = map[string]string{}
+			}
+		default:
+			idx := strings.Index(line, "=")
+			if idx < 1 {
+				return nil, errors.Errorf("line %d: expected key = value, got '%s'", lineNo, line)
+			}
+
+			if section == "" {
+				return nil, errors.Errorf("line %d: setting outside of a section", lineNo)
+			}
+
+			ini[section][strings.TrimSpace(line[:idx])] = strings.TrimSpace(line[idx+1:])
+		}
+	}
+
+	return ini, scanner.Err()
+}
+
+// LintRule checks rendered config for mistakes that PgBouncer would accept, but that
+// would break our clients or our ability to manage PgBouncer.
+type LintRule struct {
+	Name  string
+	Check func(INI) error
+}
+
+// DefaultLintRules are applied to rendered config unless PgBouncer.LintRules is set
+var DefaultLintRules = []LintRule{
+	{"required-sections", lintRequiredSections},
+	{"empty-host", lintEmptyHosts},
+	{"pool-mode", lintPoolMode},
+	{"extra-float-digits", lintExtraFloatDigits},
+}
+
+// Lint applies each rule to the config, returning an error that describes every failure
+func Lint(ini INI, rules []LintRule) error {
+	failures := []string{}
+	for _, rule := range rules {
+		if err := rule.Check(ini); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", rule.Name, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return errors.Errorf("invalid PgBouncer config: %s", strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+func lintRequiredSections(ini INI) error {
+	for _, section := range []string{"databases", "pgbouncer"} {
+		if _, ok := ini[section]; !ok {
+			return errors.Errorf("missing [%s] section", section)
+		}
+	}
+
+	if len(ini["databases"]) == 0 {
+		return errors.New("no databases defined")
+	}
+
+	return nil
+}
+
+// lintEmptyHosts catches databases whose host rendered empty, such as a replica pool
+// when the topology is unknown. PgBouncer would connect these to the local socket.
+func lintEmptyHosts(ini INI) error {
+	for database, connstr := range ini["databases"] {
+		for _, param := range strings.Fields(connstr) {
+			if param == "host=" || param == "host=''" {
+				return errors.Errorf("database %s has an empty host", database)
+			}
+		}
+	}
+
+	return nil
+}
+
+func lintPoolMode(ini INI) error {
+	switch mode := ini["pgbouncer"]["pool_mode"]; mode {
+	case "", "session", "transaction", "statement":
+		return nil
+	default:
+		return errors.Errorf("unknown pool_mode '%s'", mode)
+	}
+}
+
+// lintExtraFloatDigits ensures clients that set extra_float_digits, like pgx and JDBC,
+// are not refused by PgBouncer.
+func lintExtraFloatDigits(ini INI) error {
+	for _, param := range strings.Split(ini["pgbouncer"]["ignore_startup_parameters"], ",") {
+		if strings.TrimSpace(param) == "extra_float_digits" {
+			return nil
+		}
+	}
+
+	return errors.New("expected ignore_startup_parameters to include extra_float_digits")
+}
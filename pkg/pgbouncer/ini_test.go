@@ -0,0 +1,75 @@
+package pgbouncer_test
+
+import (
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pgbouncer"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseINI", func() {
+	It("Parses sections and settings, ignoring comments", func() {
+		ini, err := pgbouncer.ParseINI([]byte(`
+; comment
+[databases]
+postgres = host=10.0.0.1 port=5432
+
+[pgbouncer]
+# comment
+pool_mode = session
+%include /etc/pgbouncer/extra.ini
+`))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ini).To(Equal(pgbouncer.INI{
+			"databases": {"postgres": "host=10.0.0.1 port=5432"},
+			"pgbouncer": {"pool_mode": "session"},
+		}))
+	})
+
+	It("Rejects settings outside of a section", func() {
+		_, err := pgbouncer.ParseINI([]byte("pool_mode = session\n"))
+		Expect(err).To(MatchError("line 1: setting outside of a section"))
+	})
+
+	It("Rejects lines that aren't settings", func() {
+		_, err := pgbouncer.ParseINI([]byte("[databases]\n{{if .Sync}}\n"))
+		Expect(err).To(MatchError(ContainSubstring("line 2: expected key = value")))
+	})
+})
+
+var _ = Describe("Lint", func() {
+	valid := func() pgbouncer.INI {
+		return pgbouncer.INI{
+			"databases": {"postgres": "host=10.0.0.1"},
+			"pgbouncer": {"ignore_startup_parameters": "extra_float_digits, application_name"},
+		}
+	}
+
+	It("Accepts valid config", func() {
+		Expect(pgbouncer.Lint(valid(), pgbouncer.DefaultLintRules)).To(Succeed())
+	})
+
+	cases := []struct {
+		name   string
+		modify func(pgbouncer.INI)
+		err    string
+	}{
+		{"missing sections", func(ini pgbouncer.INI) { delete(ini, "pgbouncer") }, "missing [pgbouncer] section"},
+		{"no databases", func(ini pgbouncer.INI) { ini["databases"] = map[string]string{} }, "no databases defined"},
+		{"empty hosts", func(ini pgbouncer.INI) { ini["databases"]["replica"] = "host= port=5432" }, "database replica has an empty host"},
+		{"unknown pool modes", func(ini pgbouncer.INI) { ini["pgbouncer"]["pool_mode"] = "sesion" }, "unknown pool_mode 'sesion'"},
+		{"missing extra_float_digits", func(ini pgbouncer.INI) { ini["pgbouncer"]["ignore_startup_parameters"] = "" }, "extra_float_digits"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		It("Rejects "+tc.name, func() {
+			ini := valid()
+			tc.modify(ini)
+
+			Expect(pgbouncer.Lint(ini, pgbouncer.DefaultLintRules)).To(MatchError(ContainSubstring(tc.err)))
+		})
+	}
+})
@@ -20,6 +20,9 @@ func StartPgBouncer(database, user, password, port string) (bouncer *pgbouncer.P
 	var workspace string
 
 	cleanup = func() {
+		if bouncer != nil {
+			bouncer.Close()
+		}
 		if proc != nil {
 			proc.Process.Kill()
 		}
@@ -51,13 +54,17 @@ func StartPgBouncer(database, user, password, port string) (bouncer *pgbouncer.P
 	)
 
 	// Generate a config file template that will place unix socket in our temporary
-	// workspace
-	for _, file := range []string{configFile, configFileTemplate} {
+	// workspace. Only the template defines a pool for the sync replica, as PgBouncer can't
+	// parse the template actions that omit it when no sync is known.
+	for file, replicas := range map[string]string{
+		configFile:         "",
+		configFileTemplate: fmt.Sprintf("{{if .Sync}}%s_sync = host={{.Sync}} port=%s pool_size=6{{end}}\n", database, port),
+	} {
 		err = ioutil.WriteFile(
 			file,
 			[]byte(fmt.Sprintf(`[databases]
 %s = host={{.Host}} port=%s pool_size=6
-
+%s
 [pgbouncer]
 logfile = %s/pgbouncer.log
 listen_port = 6432
@@ -66,7 +73,7 @@ auth_type = trust
 auth_file = %s/users.txt
 admin_users = postgres,pgbouncer
 pool_mode = session
-ignore_startup_parameters = extra_float_digits`, database, port, workspace, workspace, workspace)),
+ignore_startup_parameters = extra_float_digits`, database, port, replicas, workspace, workspace, workspace)),
 			0644,
 		)
 
@@ -81,7 +88,7 @@ ignore_startup_parameters = extra_float_digits`, database, port, workspace, work
 	bouncer = &pgbouncer.PgBouncer{
 		ConfigFile:         filepath.Join(workspace, "pgbouncer.ini"),
 		ConfigTemplateFile: filepath.Join(workspace, "pgbouncer.ini.template"),
-		Executor: pgbouncer.AuthorizedExecutor{
+		Executor: &pgbouncer.AuthorizedExecutor{
 			User:      "pgbouncer",
 			Database:  "pgbouncer",
 			SocketDir: workspace,
@@ -90,7 +97,13 @@ ignore_startup_parameters = extra_float_digits`, database, port, workspace, work
 	}
 
 	Eventually(
-		func() error { return bouncer.Connect(context.TODO()) },
+		func() error {
+			// Connect retries until the context expires, so we bound each attempt
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			return bouncer.Connect(ctx)
+		},
 		10*time.Second,
 		100*time.Millisecond,
 	).Should(
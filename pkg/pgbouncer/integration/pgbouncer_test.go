@@ -8,10 +8,12 @@ import (
 	"time"
 
 	"github.com/gocardless/pgsql-cluster-manager/pkg/pgbouncer"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
 	"github.com/jackc/pgx"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
 )
 
 func tryEnviron(key, otherwise string) string {
@@ -48,6 +50,11 @@ var _ = Describe("PgBouncer", func() {
 		cancel()
 	})
 
+	generate := func(data pgbouncer.ConfigData) error {
+		_, err := bouncer.GenerateConfig(data)
+		return err
+	}
+
 	readlogs := func() string {
 		workspace := path.Dir(bouncer.ConfigFile)
 		logs, err := ioutil.ReadFile(path.Join(workspace, "pgbouncer.log"))
@@ -57,7 +64,7 @@ var _ = Describe("PgBouncer", func() {
 	}
 
 	connectToDatabase := func() (*pgx.Conn, error) {
-		executor := bouncer.Executor.(pgbouncer.AuthorizedExecutor)
+		executor := bouncer.Executor.(*pgbouncer.AuthorizedExecutor)
 		return pgx.Connect(
 			pgx.ConnConfig{
 				Host:     executor.SocketDir,
@@ -78,7 +85,7 @@ var _ = Describe("PgBouncer", func() {
 	Context("Pointed at the integration database", func() {
 		BeforeEach(func() {
 			// Point the PgBouncer configuration at our integration Postgres database
-			Expect(bouncer.GenerateConfig(host)).To(Succeed())
+			Expect(generate(pgbouncer.NewConfigData(store.Master{Host: host}, nil))).To(Succeed())
 			Expect(bouncer.Reload(ctx)).To(Succeed())
 		})
 
@@ -109,6 +116,78 @@ var _ = Describe("PgBouncer", func() {
 			})
 		})
 
+		Describe("ShowPools", func() {
+			It("Lists the pool of each connected client", func() {
+				conn := mustConnectToDatabase()
+				defer conn.Close()
+
+				pools, err := bouncer.ShowPools(ctx)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(pools).To(ContainElement(
+					MatchFields(IgnoreExtras, Fields{
+						"Database":      Equal(database),
+						"User":          Equal(user),
+						"ClientsActive": BeEquivalentTo(1),
+						"PoolMode":      Equal("session"),
+					}),
+				))
+			})
+		})
+
+		Describe("ShowServers", func() {
+			It("Lists server connections", func() {
+				conn := mustConnectToDatabase()
+				defer conn.Close()
+
+				Expect(conn.ExecEx(ctx, "select now()", nil)).NotTo(BeNil())
+
+				servers, err := bouncer.ShowServers(ctx)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(servers).To(ContainElement(
+					MatchFields(IgnoreExtras, Fields{
+						"Type":     Equal("S"),
+						"Database": Equal(database),
+					}),
+				))
+			})
+		})
+
+		Describe("ShowStats", func() {
+			It("Lists stats for each database", func() {
+				stats, err := bouncer.ShowStats(ctx)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stats).To(ContainElement(
+					MatchFields(IgnoreExtras, Fields{"Database": Equal("pgbouncer")}),
+				))
+			})
+		})
+
+		Describe("ShowConfig", func() {
+			It("Lists settings", func() {
+				settings, err := bouncer.ShowConfig(ctx)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(settings).To(ContainElement(
+					MatchFields(IgnoreExtras, Fields{
+						"Key":   Equal("pool_mode"),
+						"Value": Equal("session"),
+					}),
+				))
+			})
+		})
+
+		Describe("ShowLists", func() {
+			It("Counts internal lists", func() {
+				lists, err := bouncer.ShowLists(ctx)
+
+				Expect(err).NotTo(HaveOccurred())
+				Expect(lists).To(ContainElement(pgbouncer.List{Name: "databases", Items: 2}))
+			})
+		})
+
 		Describe("Disable", func() {
 			It("Prevents new client connections", func() {
 				// Create a connection prior to the disable so we can check the bahviour
@@ -132,6 +211,16 @@ var _ = Describe("PgBouncer", func() {
 				Expect(original.ExecEx(ctx, "select now()", nil)).NotTo(BeNil())
 			})
 		})
+
+		Describe("Enable", func() {
+			It("Allows new client connections after disable", func() {
+				Expect(bouncer.Disable(ctx)).To(Succeed())
+				Expect(bouncer.Enable(ctx)).To(Succeed())
+
+				conn := mustConnectToDatabase()
+				defer conn.Close()
+			})
+		})
 	})
 
 	Describe("Reload", func() {
@@ -146,7 +235,7 @@ var _ = Describe("PgBouncer", func() {
 				),
 			)
 
-			Expect(bouncer.GenerateConfig("new-host")).To(Succeed())
+			Expect(generate(pgbouncer.NewConfigData(store.Master{Host: "new-host"}, nil))).To(Succeed())
 			Expect(bouncer.Reload(ctx)).To(Succeed())
 			Eventually(readlogs).Should(ContainSubstring("LOG RELOAD command issued"))
 
@@ -173,7 +262,7 @@ var _ = Describe("PgBouncer", func() {
 		Context("When session is blocking pause", func() {
 			It("Times out and resumes", func() {
 				// Point the PgBouncer configuration at our integration Postgres database
-				Expect(bouncer.GenerateConfig(host)).To(Succeed())
+				Expect(generate(pgbouncer.NewConfigData(store.Master{Host: host}, nil))).To(Succeed())
 				Expect(bouncer.Reload(ctx)).To(Succeed())
 
 				conn := mustConnectToDatabase()
@@ -225,4 +314,33 @@ var _ = Describe("PgBouncer", func() {
 			})
 		})
 	})
+
+	Describe("Executor", func() {
+		// adminClients counts the clients connected to the admin console, which includes the
+		// connection we're counting them with.
+		adminClients := func() (count int, err error) {
+			clients, err := bouncer.ShowClients(ctx)
+			for _, client := range clients {
+				if client.Database == "pgbouncer" {
+					count++
+				}
+			}
+
+			return
+		}
+
+		It("Reuses a single admin connection", func() {
+			for i := 0; i < 5; i++ {
+				Expect(bouncer.Reload(ctx)).To(Succeed())
+			}
+
+			Expect(adminClients()).To(Equal(1))
+		})
+
+		It("Reconnects once closed", func() {
+			Expect(bouncer.Close()).To(Succeed())
+			Expect(bouncer.Reload(ctx)).To(Succeed())
+			Expect(adminClients()).To(Equal(1))
+		})
+	})
 })
@@ -4,21 +4,32 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"database/sql"
 	"fmt"
-	"html/template"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"sync"
+	"text/template"
 
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pacemaker"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
 	"github.com/jackc/pgx"
 	"github.com/pkg/errors"
 )
 
 type PgBouncer struct {
 	ConfigFile         string
-	ConfigTemplateFile string // template that can be rendered with Host value
+	ConfigTemplateFile string     // template rendered with ConfigData, such as {{.Host}}
+	LintRules          []LintRule // checks applied to rendered config, DefaultLintRules if nil
 	Executor           executor
+
+	applyMu       sync.Mutex
+	reloadPending bool // config was written but PgBouncer has yet to reload it
+
+	pausedMu sync.Mutex
+	paused   bool // whether we last paused or resumed PgBouncer
 }
 
 // Config generates a key value map of config parameters from the PgBouncer config
@@ -46,104 +57,206 @@ func (b *PgBouncer) Config() (map[string]string, error) {
 	return config, nil
 }
 
-// GenerateConfig writes new configuration to PgBouncer.ConfigFile
-func (b *PgBouncer) GenerateConfig(host string) error {
-	var configBuffer bytes.Buffer
-	template, err := b.createTemplate()
+// ConfigData is rendered into the config template. Fields of the master record are
+// available directly, such as {{.Host}} and {{.Port}}, though records published in the
+// IP format only provide a Host.
+//
+// Replica addresses come from the cluster topology, and are empty until it is known or
+// if the cluster has no such replica. Templates should guard against this, such as with
+// {{if .Sync}}.
+type ConfigData struct {
+	store.Master
+	Sync   string           // address of the sync replica
+	Asyncs []string         // addresses of async replicas
+	Nodes  []pacemaker.Node // every node in the cluster
+}
 
+// NewConfigData combines the master record with replicas from the topology, which may
+// be nil if unknown.
+func NewConfigData(master store.Master, topology *pacemaker.Topology) ConfigData {
+	data := ConfigData{Master: master, Asyncs: []string{}, Nodes: []pacemaker.Node{}}
+	if topology == nil {
+		return data
+	}
+
+	data.Nodes = topology.Nodes
+	for _, node := range topology.Nodes {
+		switch node.Role {
+		case pacemaker.RoleSync:
+			data.Sync = node.Address
+		case pacemaker.RoleAsync:
+			data.Asyncs = append(data.Asyncs, node.Address)
+		}
+	}
+
+	return data
+}
+
+// templateFuncs are available to config templates, such as {{join .Asyncs ","}}
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"default": func(fallback, value string) string {
+		if value == "" {
+			return fallback
+		}
+
+		return value
+	},
+}
+
+// RenderConfig renders the template with the given data, failing if the result is not
+// valid PgBouncer config or breaks any of our lint rules.
+func (b *PgBouncer) RenderConfig(data ConfigData) ([]byte, error) {
+	template, err := b.createTemplate()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = template.Execute(&configBuffer, struct{ Host string }{host})
+	var configBuffer bytes.Buffer
+	if err := template.Execute(&configBuffer, data); err != nil {
+		return nil, errors.Wrap(err, "failed to render PgBouncer config")
+	}
 
+	ini, err := ParseINI(configBuffer.Bytes())
 	if err != nil {
-		return errors.Wrap(err, "failed to render PgBouncer config")
+		return nil, errors.Wrap(err, "failed to parse rendered PgBouncer config")
 	}
 
-	return ioutil.WriteFile(b.ConfigFile, configBuffer.Bytes(), 0644)
-}
+	rules := b.LintRules
+	if rules == nil {
+		rules = DefaultLintRules
+	}
 
-func (b *PgBouncer) createTemplate() (*template.Template, error) {
-	configTemplate, err := ioutil.ReadFile(b.ConfigTemplateFile)
+	return configBuffer.Bytes(), Lint(ini, rules)
+}
 
+// GenerateConfig renders the template and replaces PgBouncer.ConfigFile with the result,
+// reporting whether the config changed. The file is replaced atomically so PgBouncer
+// never reads a partial config, and the config it replaces is kept at PreviousConfigFile
+// for RollbackConfig.
+func (b *PgBouncer) GenerateConfig(data ConfigData) (bool, error) {
+	config, err := b.RenderConfig(data)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to read PgBouncer config template file")
+		return false, err
+	}
+
+	current, err := ioutil.ReadFile(b.ConfigFile)
+	if err != nil && !os.IsNotExist(err) {
+		return false, errors.Wrap(err, "failed to read PgBouncer config file")
+	}
+
+	if bytes.Equal(current, config) {
+		return false, nil
+	}
+
+	if current != nil {
+		if err := writeFileAtomic(b.PreviousConfigFile(), current); err != nil {
+			return false, errors.Wrap(err, "failed to keep previous PgBouncer config")
+		}
 	}
 
-	if matched, _ := regexp.Match("ignore_startup_parameters\\s*\\=.+extra_float_digits", configTemplate); !matched {
-		return nil, errors.Errorf(
-			"PgBouncer is misconfigured: expected config file '%s' to define "+
-				"'ignore_startup_paramets' to include 'extra_float_digits'",
-			b.ConfigTemplateFile,
-		)
+	if err := writeFileAtomic(b.ConfigFile, config); err != nil {
+		return false, errors.Wrap(err, "failed to write PgBouncer config file")
 	}
 
-	return template.Must(template.New("PgBouncerConfig").Parse(string(configTemplate))), err
+	return true, nil
 }
 
-type Database struct {
-	Name, Host, Port   string
-	CurrentConnections int64
+// PreviousConfigFile holds the config replaced by the last GenerateConfig
+func (b *PgBouncer) PreviousConfigFile() string {
+	return b.ConfigFile + ".previous"
 }
 
-// ShowDatabase extracts information from the SHOW DATABASE PgBouncer command, selecting
-// columns about database host details. This is quite cumbersome to write, due to the
-// inability to query select fields for database information, and the lack of guarantees
-// about the ordering of the columns returned from the command.
-func (b *PgBouncer) ShowDatabases(ctx context.Context) ([]Database, error) {
-	databases := make([]Database, 0)
-	rows, err := b.Executor.Query(ctx, `SHOW DATABASES;`)
+// RollbackConfig restores the config replaced by the last GenerateConfig
+func (b *PgBouncer) RollbackConfig() error {
+	previous, err := ioutil.ReadFile(b.PreviousConfigFile())
+	if err != nil {
+		return errors.Wrap(err, "failed to read previous PgBouncer config")
+	}
+
+	return errors.Wrap(writeFileAtomic(b.ConfigFile, previous), "failed to write PgBouncer config file")
+}
 
+// ApplyConfig generates new config and reloads PgBouncer, skipping the reload if the
+// config is unchanged. If PgBouncer rejects the config then we restore the previous one,
+// so a restart won't pick up config that PgBouncer has already refused.
+//
+// Failing to reach PgBouncer says nothing about the config, so we leave it in place and
+// retry the reload when next applied, even if the config is then unchanged.
+func (b *PgBouncer) ApplyConfig(ctx context.Context, data ConfigData) error {
+	b.applyMu.Lock()
+	defer b.applyMu.Unlock()
+
+	changed, err := b.GenerateConfig(data)
 	if err != nil {
-		return databases, err
+		return err
 	}
 
-	rows.Next()
-	defer rows.Close()
+	if !changed && !b.reloadPending {
+		return nil
+	}
 
-	fields := rows.FieldDescriptions()
-	columnPointers := make([]interface{}, len(fields))
+	err = b.Reload(ctx)
+	if err == nil {
+		b.reloadPending = false
+		return nil
+	}
 
-	indexOfColumn := func(c string) int {
-		for idx, field := range fields {
-			if field.Name == c {
-				return idx
-			}
-		}
+	if _, ok := err.(pgx.PgError); !ok {
+		b.reloadPending = true
+		return errors.Wrap(err, "failed to reload PgBouncer")
+	}
 
-		return -1
+	b.reloadPending = false
+	if rollbackErr := b.RollbackConfig(); rollbackErr != nil {
+		return errors.Wrapf(err, "PgBouncer rejected config, and failed to restore previous config (%s)", rollbackErr)
 	}
 
-	var name, host, port, null sql.NullString
-	var currentConnections sql.NullInt64
+	return errors.Wrap(err, "PgBouncer rejected config, restored previous config")
+}
 
-	for idx := range columnPointers {
-		columnPointers[idx] = &null
+// writeFileAtomic writes content to a temporary file beside path before renaming it into
+// place, ensuring readers see either the old or new content in full.
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
 	}
 
-	columnPointers[indexOfColumn("name")] = &name
-	columnPointers[indexOfColumn("host")] = &host
-	columnPointers[indexOfColumn("port")] = &port
-	columnPointers[indexOfColumn("current_connections")] = &currentConnections
+	defer os.Remove(tmp.Name()) // no-op once renamed
 
-	for {
-		err := rows.Scan(columnPointers...)
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
 
-		if err != nil {
-			return databases, err
-		}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
 
-		databases = append(databases, Database{
-			name.String, host.String, port.String, currentConnections.Int64,
-		})
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
 
-		if !rows.Next() {
-			break
-		}
+	if err != nil {
+		return err
 	}
 
-	return databases, rows.Err()
+	return os.Rename(tmp.Name(), path)
+}
+
+func (b *PgBouncer) createTemplate() (*template.Template, error) {
+	configTemplate, err := ioutil.ReadFile(b.ConfigTemplateFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read PgBouncer config template file")
+	}
+
+	template, err := template.New("PgBouncerConfig").Funcs(templateFuncs).Option("missingkey=error").Parse(string(configTemplate))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse PgBouncer config template file")
+	}
+
+	return template, nil
 }
 
 // These error codes are returned whenever PgBouncer is asked to PAUSE/RESUME, but is
@@ -155,17 +268,26 @@ const AlreadyResumedError = "pooler is not paused/suspended"
 // Pause causes PgBouncer to buffer incoming queries while waiting for those currently
 // processing to finish executing. The supplied timeout is applied to the Postgres
 // connection.
+//
+// Should the context expire while PAUSE waits on those queries, PgBouncer continues to
+// pause regardless, so we consider it paused despite returning the error.
 func (b *PgBouncer) Pause(ctx context.Context) error {
 	if err := b.Executor.Execute(ctx, `PAUSE;`); err != nil {
-		if err, ok := err.(pgx.PgError); ok {
-			if string(err.Code) == PoolerError && err.Message == AlreadyPausedError {
+		if pgErr, ok := err.(pgx.PgError); ok {
+			if string(pgErr.Code) == PoolerError && pgErr.Message == AlreadyPausedError {
+				b.setPaused(true)
 				return nil
 			}
 		}
 
+		if err == ctx.Err() {
+			b.setPaused(true)
+		}
+
 		return err
 	}
 
+	b.setPaused(true)
 	return nil
 }
 
@@ -174,6 +296,7 @@ func (b *PgBouncer) Resume(ctx context.Context) error {
 	if err := b.Executor.Execute(ctx, `RESUME;`); err != nil {
 		if err, ok := err.(pgx.PgError); ok {
 			if string(err.Code) == PoolerError && err.Message == AlreadyResumedError {
+				b.setPaused(false)
 				return nil
 			}
 		}
@@ -181,12 +304,42 @@ func (b *PgBouncer) Resume(ctx context.Context) error {
 		return err
 	}
 
+	b.setPaused(false)
 	return nil
 }
 
+// Paused reports whether we last paused PgBouncer, rather than resumed it. PgBouncer
+// offers no way to ask whether it is globally paused, so this only reflects the commands
+// we've issued.
+func (b *PgBouncer) Paused() bool {
+	b.pausedMu.Lock()
+	defer b.pausedMu.Unlock()
+
+	return b.paused
+}
+
+func (b *PgBouncer) setPaused(paused bool) {
+	b.pausedMu.Lock()
+	defer b.pausedMu.Unlock()
+
+	b.paused = paused
+}
+
 // Disable causes PgBouncer to reject all new client connections on the given databases.
 // If no databases are supplied then this operation will apply to all PgBouncer databases.
 func (b *PgBouncer) Disable(ctx context.Context, databases ...string) error {
+	return b.eachDatabase(ctx, "DISABLE", databases)
+}
+
+// Enable reverses a previous Disable, allowing new client connections to the given
+// databases. If no databases are supplied then all PgBouncer databases are enabled.
+func (b *PgBouncer) Enable(ctx context.Context, databases ...string) error {
+	return b.eachDatabase(ctx, "ENABLE", databases)
+}
+
+// eachDatabase runs the admin command against each database, or all databases except the
+// special pgbouncer database if none are given.
+func (b *PgBouncer) eachDatabase(ctx context.Context, command string, databases []string) error {
 	if len(databases) == 0 {
 		dbs, err := b.ShowDatabases(ctx)
 		if err != nil {
@@ -201,7 +354,7 @@ func (b *PgBouncer) Disable(ctx context.Context, databases ...string) error {
 	}
 
 	for _, database := range databases {
-		if err := b.Executor.Execute(ctx, fmt.Sprintf(`DISABLE %s;`, database)); err != nil {
+		if err := b.Executor.Execute(ctx, fmt.Sprintf(`%s %s;`, command, database)); err != nil {
 			return err
 		}
 	}
@@ -214,8 +367,19 @@ func (b *PgBouncer) Reload(ctx context.Context) error {
 	return b.Executor.Execute(ctx, `RELOAD;`)
 }
 
-// Connect runs the most basic of commands (SHOW VERSION) against PgBouncer to ensure the
-// connection is alive.
+// Connect opens our admin connection ahead of its first use
 func (b *PgBouncer) Connect(ctx context.Context) error {
-	return b.Executor.Execute(ctx, `SHOW VERSION;`)
+	return b.Ping(ctx)
+}
+
+// Ping checks our admin connection is alive, reconnecting if it has broken. Calling it
+// periodically ensures a broken connection is replaced before we next need it, rather
+// than while a failover waits on PAUSE.
+func (b *PgBouncer) Ping(ctx context.Context) error {
+	return b.Executor.Ping(ctx)
+}
+
+// Close closes our admin connection to PgBouncer, which is reopened if we're used again
+func (b *PgBouncer) Close() error {
+	return b.Executor.Close()
 }
@@ -1,15 +1,44 @@
 package pgbouncer_test
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
+	"github.com/gocardless/pgsql-cluster-manager/pkg/pacemaker"
 	"github.com/gocardless/pgsql-cluster-manager/pkg/pgbouncer"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+	"github.com/jackc/pgx"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
+// fakeExecutor records the commands it is asked to execute, failing each with err
+type fakeExecutor struct {
+	commands []string
+	err      error
+}
+
+func (e *fakeExecutor) Query(context.Context, string, func(*pgx.Rows) error, ...interface{}) error {
+	return e.err
+}
+
+func (e *fakeExecutor) Execute(_ context.Context, query string, _ ...interface{}) error {
+	e.commands = append(e.commands, query)
+	return e.err
+}
+
+func (e *fakeExecutor) Ping(ctx context.Context) error {
+	return e.Execute(ctx, `SHOW VERSION;`)
+}
+
+func (e *fakeExecutor) Close() error {
+	return nil
+}
+
 var _ = Describe("PgBouncer", func() {
 	var (
 		bouncer        *pgbouncer.PgBouncer
@@ -30,14 +59,110 @@ var _ = Describe("PgBouncer", func() {
 	AfterEach(func() {
 		tempConfigFile.Close()
 		os.Remove(tempConfigFile.Name())
+		os.Remove(bouncer.PreviousConfigFile())
 	})
 
+	generate := func(data pgbouncer.ConfigData) error {
+		_, err := bouncer.GenerateConfig(data)
+		return err
+	}
+
 	Describe("GenerateConfig", func() {
 		Context("With valid config template", func() {
 			It("Renders new config file", func() {
-				Expect(bouncer.GenerateConfig("db.prod")).To(Succeed())
+				Expect(generate(pgbouncer.NewConfigData(store.Master{Host: "db.prod"}, nil))).To(Succeed())
 				Expect(ioutil.ReadFile(bouncer.ConfigFile)).To(ContainSubstring("host=db.prod"))
 			})
+
+			It("Renders fields of the master record", func() {
+				Expect(generate(pgbouncer.NewConfigData(store.Master{Host: "db.prod", Port: 5433, Node: "pg01"}, nil))).To(Succeed())
+				Expect(ioutil.ReadFile(bouncer.ConfigFile)).To(And(
+					ContainSubstring("; primary is pg01"),
+					ContainSubstring("host=db.prod port=5433"),
+				))
+			})
+		})
+
+		Context("With topology", func() {
+			It("Renders replica addresses", func() {
+				topology := &pacemaker.Topology{
+					Nodes: []pacemaker.Node{
+						{Name: "pg01", Address: "10.0.0.1", Role: pacemaker.RoleMaster},
+						{Name: "pg02", Address: "10.0.0.2", Role: pacemaker.RoleSync},
+						{Name: "pg03", Address: "10.0.0.3", Role: pacemaker.RoleAsync},
+						{Name: "pg04", Address: "10.0.0.4", Role: pacemaker.RoleAsync},
+					},
+				}
+
+				Expect(generate(pgbouncer.NewConfigData(store.Master{Host: "10.0.0.1", Port: 5432}, topology))).To(Succeed())
+				Expect(ioutil.ReadFile(bouncer.ConfigFile)).To(And(
+					ContainSubstring("postgres_sync = host=10.0.0.2 port=5432"),
+					ContainSubstring("postgres_async0 = host=10.0.0.3 port=5432"),
+					ContainSubstring("postgres_async1 = host=10.0.0.4 port=5432"),
+				))
+			})
+
+			It("Omits replicas when topology is unknown", func() {
+				Expect(generate(pgbouncer.NewConfigData(store.Master{Host: "10.0.0.1"}, nil))).To(Succeed())
+				Expect(ioutil.ReadFile(bouncer.ConfigFile)).NotTo(ContainSubstring("postgres_sync"))
+			})
+		})
+
+		Context("With values HTML would escape", func() {
+			It("Renders them verbatim", func() {
+				Expect(generate(pgbouncer.NewConfigData(store.Master{Host: "db.prod", Node: "pg<01>"}, nil))).To(Succeed())
+				Expect(ioutil.ReadFile(bouncer.ConfigFile)).To(ContainSubstring("; primary is pg<01>"))
+			})
+		})
+
+		Context("With existing config", func() {
+			BeforeEach(func() {
+				Expect(generate(pgbouncer.NewConfigData(store.Master{Host: "db.old"}, nil))).To(Succeed())
+			})
+
+			It("Reports whether the config changed", func() {
+				Expect(bouncer.GenerateConfig(pgbouncer.NewConfigData(store.Master{Host: "db.old"}, nil))).To(BeFalse())
+				Expect(bouncer.GenerateConfig(pgbouncer.NewConfigData(store.Master{Host: "db.new"}, nil))).To(BeTrue())
+			})
+
+			It("Keeps the previous config, which can be restored", func() {
+				Expect(generate(pgbouncer.NewConfigData(store.Master{Host: "db.new"}, nil))).To(Succeed())
+				Expect(ioutil.ReadFile(bouncer.ConfigFile)).To(ContainSubstring("host=db.new"))
+				Expect(ioutil.ReadFile(bouncer.PreviousConfigFile())).To(ContainSubstring("host=db.old"))
+
+				Expect(bouncer.RollbackConfig()).To(Succeed())
+				Expect(ioutil.ReadFile(bouncer.ConfigFile)).To(ContainSubstring("host=db.old"))
+			})
+
+			It("Leaves no temporary files behind", func() {
+				Expect(generate(pgbouncer.NewConfigData(store.Master{Host: "db.new"}, nil))).To(Succeed())
+
+				matches, err := filepath.Glob(bouncer.ConfigFile + ".tmp*")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(matches).To(BeEmpty())
+			})
+
+			It("Leaves config untouched when rendering fails", func() {
+				Expect(generate(pgbouncer.NewConfigData(store.Master{Host: ""}, nil))).To(
+					MatchError(ContainSubstring("database postgres has an empty host")),
+				)
+				Expect(ioutil.ReadFile(bouncer.ConfigFile)).To(ContainSubstring("host=db.old"))
+			})
+		})
+
+		Context("With custom lint rules", func() {
+			It("Applies them instead of the defaults", func() {
+				bouncer.LintRules = []pgbouncer.LintRule{
+					{
+						Name:  "no-prod",
+						Check: func(pgbouncer.INI) error { return errors.New("refusing prod") },
+					},
+				}
+
+				Expect(generate(pgbouncer.NewConfigData(store.Master{Host: "db.prod"}, nil))).To(
+					MatchError("invalid PgBouncer config: no-prod: refusing prod"),
+				)
+			})
 		})
 
 		Context("With missing config template", func() {
@@ -46,7 +171,7 @@ var _ = Describe("PgBouncer", func() {
 			})
 
 			It("Returns error", func() {
-				Expect(bouncer.GenerateConfig("db.prod")).To(
+				Expect(generate(pgbouncer.NewConfigData(store.Master{Host: "db.prod"}, nil))).To(
 					MatchError(
 						MatchRegexp("failed to read PgBouncer config template file"),
 					),
@@ -54,4 +179,98 @@ var _ = Describe("PgBouncer", func() {
 			})
 		})
 	})
+
+	Describe("ApplyConfig", func() {
+		var (
+			ctx      context.Context
+			executor *fakeExecutor
+		)
+
+		apply := func(host string) error {
+			return bouncer.ApplyConfig(ctx, pgbouncer.NewConfigData(store.Master{Host: host}, nil))
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			executor = &fakeExecutor{}
+			bouncer.Executor = executor
+
+			Expect(apply("db.old")).To(Succeed())
+			executor.commands = nil
+		})
+
+		It("Reloads changed config", func() {
+			Expect(apply("db.new")).To(Succeed())
+			Expect(executor.commands).To(Equal([]string{`RELOAD;`}))
+		})
+
+		It("Skips the reload when config is unchanged", func() {
+			Expect(apply("db.old")).To(Succeed())
+			Expect(executor.commands).To(BeEmpty())
+		})
+
+		It("Restores the previous config when PgBouncer rejects the new one", func() {
+			executor.err = pgx.PgError{Code: "08P01", Message: "RELOAD failed"}
+
+			Expect(apply("db.new")).To(MatchError(ContainSubstring("restored previous config")))
+			Expect(ioutil.ReadFile(bouncer.ConfigFile)).To(ContainSubstring("host=db.old"))
+		})
+
+		It("Keeps the new config and retries the reload when PgBouncer is unreachable", func() {
+			executor.err = errors.New("connection refused")
+
+			Expect(apply("db.new")).To(MatchError(ContainSubstring("connection refused")))
+			Expect(ioutil.ReadFile(bouncer.ConfigFile)).To(ContainSubstring("host=db.new"))
+
+			executor.err, executor.commands = nil, nil
+			Expect(apply("db.new")).To(Succeed())
+			Expect(executor.commands).To(Equal([]string{`RELOAD;`}))
+
+			executor.commands = nil
+			Expect(apply("db.new")).To(Succeed())
+			Expect(executor.commands).To(BeEmpty())
+		})
+	})
+
+	Describe("Paused", func() {
+		var executor *fakeExecutor
+
+		BeforeEach(func() {
+			executor = &fakeExecutor{}
+			bouncer.Executor = executor
+		})
+
+		It("Tracks whether we last paused or resumed PgBouncer", func() {
+			Expect(bouncer.Paused()).To(BeFalse())
+
+			Expect(bouncer.Pause(context.Background())).To(Succeed())
+			Expect(bouncer.Paused()).To(BeTrue())
+
+			Expect(bouncer.Resume(context.Background())).To(Succeed())
+			Expect(bouncer.Paused()).To(BeFalse())
+		})
+
+		It("Treats PgBouncer already being paused as paused", func() {
+			executor.err = pgx.PgError{Code: pgbouncer.PoolerError, Message: pgbouncer.AlreadyPausedError}
+
+			Expect(bouncer.Pause(context.Background())).To(Succeed())
+			Expect(bouncer.Paused()).To(BeTrue())
+		})
+
+		It("Leaves the state unchanged when PAUSE fails", func() {
+			executor.err = errors.New("connection refused")
+
+			Expect(bouncer.Pause(context.Background())).NotTo(Succeed())
+			Expect(bouncer.Paused()).To(BeFalse())
+		})
+
+		It("Considers PgBouncer paused when PAUSE times out", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 0)
+			defer cancel()
+			executor.err = ctx.Err()
+
+			Expect(bouncer.Pause(ctx)).To(MatchError(context.DeadlineExceeded))
+			Expect(bouncer.Paused()).To(BeTrue())
+		})
+	})
 })
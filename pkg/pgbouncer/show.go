@@ -0,0 +1,250 @@
+package pgbouncer
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+	"github.com/pkg/errors"
+)
+
+type Database struct {
+	Name               string `pgbouncer:"name"`
+	Host               string `pgbouncer:"host"`
+	Port               string `pgbouncer:"port"`
+	CurrentConnections int64  `pgbouncer:"current_connections"`
+	Paused             bool   `pgbouncer:"paused"`   // since PgBouncer 1.8
+	Disabled           bool   `pgbouncer:"disabled"` // since PgBouncer 1.8
+}
+
+// Pool is a pool of server connections for a database and user pair
+type Pool struct {
+	Database       string `pgbouncer:"database"`
+	User           string `pgbouncer:"user"`
+	ClientsActive  int64  `pgbouncer:"cl_active"`
+	ClientsWaiting int64  `pgbouncer:"cl_waiting"`
+	ServersActive  int64  `pgbouncer:"sv_active"`
+	ServersIdle    int64  `pgbouncer:"sv_idle"`
+	ServersUsed    int64  `pgbouncer:"sv_used"`
+	ServersTested  int64  `pgbouncer:"sv_tested"`
+	ServersLogin   int64  `pgbouncer:"sv_login"`
+	MaxWaitSeconds int64  `pgbouncer:"maxwait"`
+	MaxWaitMicros  int64  `pgbouncer:"maxwait_us"` // since PgBouncer 1.8, added to MaxWaitSeconds
+	PoolMode       string `pgbouncer:"pool_mode"`
+}
+
+// MaxWait is how long the oldest waiting client has waited for a server connection
+func (p Pool) MaxWait() time.Duration {
+	return time.Duration(p.MaxWaitSeconds)*time.Second + time.Duration(p.MaxWaitMicros)*time.Microsecond
+}
+
+// Connection is a client or server connection, as listed by SHOW CLIENTS and SHOW SERVERS
+type Connection struct {
+	Type            string `pgbouncer:"type"` // C for clients, S for servers
+	User            string `pgbouncer:"user"`
+	Database        string `pgbouncer:"database"`
+	State           string `pgbouncer:"state"` // such as active, idle, used or waiting
+	Addr            string `pgbouncer:"addr"`
+	Port            int64  `pgbouncer:"port"`
+	LocalAddr       string `pgbouncer:"local_addr"`
+	LocalPort       int64  `pgbouncer:"local_port"`
+	ConnectTime     string `pgbouncer:"connect_time"`
+	RequestTime     string `pgbouncer:"request_time"`
+	ApplicationName string `pgbouncer:"application_name"`
+}
+
+// Stats are totals and averages of traffic through each database. Averages are taken
+// over the last stats_period, and times are in microseconds.
+//
+// PgBouncer 1.8 split requests into transactions and queries. Against older versions we
+// report requests as queries, and leave transaction stats empty.
+type Stats struct {
+	Database         string `pgbouncer:"database"`
+	TotalXactCount   int64  `pgbouncer:"total_xact_count"`
+	TotalQueryCount  int64  `pgbouncer:"total_query_count,total_requests"`
+	TotalReceived    int64  `pgbouncer:"total_received"`
+	TotalSent        int64  `pgbouncer:"total_sent"`
+	TotalXactTime    int64  `pgbouncer:"total_xact_time"`
+	TotalQueryTime   int64  `pgbouncer:"total_query_time"`
+	TotalWaitTime    int64  `pgbouncer:"total_wait_time"`
+	AverageXactCount int64  `pgbouncer:"avg_xact_count"`
+	AverageQuery     int64  `pgbouncer:"avg_query_count,avg_req"`
+	AverageReceived  int64  `pgbouncer:"avg_recv"`
+	AverageSent      int64  `pgbouncer:"avg_sent"`
+	AverageXactTime  int64  `pgbouncer:"avg_xact_time"`
+	AverageQueryTime int64  `pgbouncer:"avg_query_time,avg_query"`
+	AverageWaitTime  int64  `pgbouncer:"avg_wait_time"`
+}
+
+// ConfigSetting is a PgBouncer setting, as listed by SHOW CONFIG
+type ConfigSetting struct {
+	Key        string `pgbouncer:"key"`
+	Value      string `pgbouncer:"value"`
+	Default    string `pgbouncer:"default"` // since PgBouncer 1.12
+	Changeable bool   `pgbouncer:"changeable"`
+}
+
+// List counts the items in one of PgBouncer's internal lists, such as free_clients
+type List struct {
+	Name  string `pgbouncer:"list"`
+	Items int64  `pgbouncer:"items"`
+}
+
+// ShowDatabases lists each database configured in PgBouncer, including the special
+// pgbouncer admin database.
+func (b *PgBouncer) ShowDatabases(ctx context.Context) ([]Database, error) {
+	databases := make([]Database, 0)
+	return databases, b.show(ctx, `SHOW DATABASES;`, &databases)
+}
+
+func (b *PgBouncer) ShowPools(ctx context.Context) ([]Pool, error) {
+	pools := make([]Pool, 0)
+	return pools, b.show(ctx, `SHOW POOLS;`, &pools)
+}
+
+func (b *PgBouncer) ShowClients(ctx context.Context) ([]Connection, error) {
+	clients := make([]Connection, 0)
+	return clients, b.show(ctx, `SHOW CLIENTS;`, &clients)
+}
+
+func (b *PgBouncer) ShowServers(ctx context.Context) ([]Connection, error) {
+	servers := make([]Connection, 0)
+	return servers, b.show(ctx, `SHOW SERVERS;`, &servers)
+}
+
+func (b *PgBouncer) ShowStats(ctx context.Context) ([]Stats, error) {
+	stats := make([]Stats, 0)
+	return stats, b.show(ctx, `SHOW STATS;`, &stats)
+}
+
+func (b *PgBouncer) ShowConfig(ctx context.Context) ([]ConfigSetting, error) {
+	settings := make([]ConfigSetting, 0)
+	return settings, b.show(ctx, `SHOW CONFIG;`, &settings)
+}
+
+func (b *PgBouncer) ShowLists(ctx context.Context) ([]List, error) {
+	lists := make([]List, 0)
+	return lists, b.show(ctx, `SHOW LISTS;`, &lists)
+}
+
+func (b *PgBouncer) show(ctx context.Context, command string, dest interface{}) error {
+	return b.Executor.Query(ctx, command, func(rows *pgx.Rows) error {
+		return scanRows(rows, dest)
+	})
+}
+
+// rows is the subset of pgx.Rows used by scanRows
+type rows interface {
+	FieldDescriptions() []pgx.FieldDescription
+	Next() bool
+	Scan(...interface{}) error
+}
+
+// scanRows appends each row to dest, a pointer to a slice of structs. Columns are matched
+// to struct fields by the field's pgbouncer tag, which may list several column names to
+// accept the first present. PgBouncer adds, removes and renames columns between versions,
+// so columns without a field are ignored, and fields without a column left empty.
+//
+// Every column is read as text, which PgBouncer uses for all its output, and parsed into
+// the field's type. This avoids needing to know the type of every column PgBouncer might
+// return.
+func scanRows(rows rows, dest interface{}) error {
+	slice := reflect.ValueOf(dest).Elem()
+	elemType := slice.Type().Elem()
+
+	// Map each column to the field it populates, or -1 if no field wants it
+	fields := rows.FieldDescriptions()
+	columnFields := make([]int, len(fields))
+	for idx, field := range fields {
+		columnFields[idx] = columnField(elemType, field.Name, fields)
+	}
+
+	values := make([]pgtype.GenericText, len(fields))
+	valuePointers := make([]interface{}, len(fields))
+	for idx := range values {
+		valuePointers[idx] = &values[idx]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(valuePointers...); err != nil {
+			return err
+		}
+
+		elem := reflect.New(elemType).Elem()
+		for idx, value := range values {
+			if columnFields[idx] < 0 || value.Status != pgtype.Present {
+				continue
+			}
+
+			if err := setField(elem.Field(columnFields[idx]), value.String); err != nil {
+				return errors.Wrapf(err, "failed to parse column %s", fields[idx].Name)
+			}
+		}
+
+		slice.Set(reflect.Append(slice, elem))
+	}
+
+	return nil
+}
+
+// columnField returns the index of the field populated by the named column, or -1 if
+// there is none. Fields listing several columns are populated by the first that is
+// present in the result.
+func columnField(elemType reflect.Type, column string, fields []pgx.FieldDescription) int {
+	present := map[string]bool{}
+	for _, field := range fields {
+		present[field.Name] = true
+	}
+
+	for idx := 0; idx < elemType.NumField(); idx++ {
+		for _, name := range strings.Split(elemType.Field(idx).Tag.Get("pgbouncer"), ",") {
+			if name == column {
+				return idx
+			}
+
+			if present[name] {
+				break // an earlier column populates this field
+			}
+		}
+	}
+
+	return -1
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(parsed)
+	case reflect.Bool:
+		switch strings.ToLower(value) {
+		case "1", "t", "true", "yes", "on":
+			field.SetBool(true)
+		case "0", "f", "false", "no", "off":
+			field.SetBool(false)
+		default:
+			return errors.Errorf("invalid boolean '%s'", value)
+		}
+	default:
+		return errors.Errorf("unsupported field type %s", field.Type())
+	}
+
+	return nil
+}
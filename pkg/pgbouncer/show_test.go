@@ -0,0 +1,110 @@
+package pgbouncer
+
+import (
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/pgtype"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeRows returns rows of text values, where nil values are NULL
+type fakeRows struct {
+	columns []string
+	values  [][]interface{}
+	idx     int
+}
+
+func (r *fakeRows) FieldDescriptions() []pgx.FieldDescription {
+	fields := []pgx.FieldDescription{}
+	for _, column := range r.columns {
+		fields = append(fields, pgx.FieldDescription{Name: column, FormatCode: pgx.TextFormatCode})
+	}
+
+	return fields
+}
+
+func (r *fakeRows) Next() bool {
+	r.idx++
+	return r.idx <= len(r.values)
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	for idx, value := range r.values[r.idx-1] {
+		var src []byte
+		if value != nil {
+			src = []byte(value.(string))
+		}
+
+		if err := dest[idx].(pgtype.TextDecoder).DecodeText(nil, src); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var _ = Describe("scanRows", func() {
+	It("Populates fields from their columns, ignoring unknown columns", func() {
+		rows := &fakeRows{
+			columns: []string{"database", "user", "cl_active", "cl_waiting", "sv_active", "maxwait", "maxwait_us", "pool_mode", "cl_cancel_req"},
+			values: [][]interface{}{
+				{"postgres", "app", "4", "2", "4", "1", "500000", "transaction", "0"},
+				{"pgbouncer", "pgbouncer", "1", "0", "0", "0", "0", "statement", "0"},
+			},
+		}
+
+		pools := []Pool{}
+		Expect(scanRows(rows, &pools)).To(Succeed())
+		Expect(pools).To(Equal([]Pool{
+			{Database: "postgres", User: "app", ClientsActive: 4, ClientsWaiting: 2, ServersActive: 4, MaxWaitSeconds: 1, MaxWaitMicros: 500000, PoolMode: "transaction"},
+			{Database: "pgbouncer", User: "pgbouncer", ClientsActive: 1, PoolMode: "statement"},
+		}))
+
+		Expect(pools[0].MaxWait()).To(Equal(1500 * time.Millisecond))
+	})
+
+	It("Leaves NULL columns empty and parses booleans", func() {
+		rows := &fakeRows{
+			columns: []string{"name", "host", "port", "current_connections", "paused", "disabled"},
+			values:  [][]interface{}{{"pgbouncer", nil, "6432", "0", "1", "0"}},
+		}
+
+		databases := []Database{}
+		Expect(scanRows(rows, &databases)).To(Succeed())
+		Expect(databases).To(Equal([]Database{{Name: "pgbouncer", Port: "6432", Paused: true}}))
+	})
+
+	It("Reads renamed columns from older PgBouncers", func() {
+		rows := &fakeRows{
+			columns: []string{"database", "total_requests", "avg_req", "avg_query"},
+			values:  [][]interface{}{{"postgres", "100", "5", "1200"}},
+		}
+
+		stats := []Stats{}
+		Expect(scanRows(rows, &stats)).To(Succeed())
+		Expect(stats).To(Equal([]Stats{{Database: "postgres", TotalQueryCount: 100, AverageQuery: 5, AverageQueryTime: 1200}}))
+	})
+
+	It("Prefers current column names when both are present", func() {
+		rows := &fakeRows{
+			columns: []string{"database", "total_requests", "total_query_count"},
+			values:  [][]interface{}{{"postgres", "1", "2"}},
+		}
+
+		stats := []Stats{}
+		Expect(scanRows(rows, &stats)).To(Succeed())
+		Expect(stats[0].TotalQueryCount).To(BeEquivalentTo(2))
+	})
+
+	It("Fails on unparseable values", func() {
+		rows := &fakeRows{
+			columns: []string{"list", "items"},
+			values:  [][]interface{}{{"free_clients", "many"}},
+		}
+
+		Expect(scanRows(rows, &[]List{})).To(MatchError(ContainSubstring("failed to parse column items")))
+	})
+})
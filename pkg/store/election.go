@@ -0,0 +1,213 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+// ElectionOptions configures leader election between processes
+type ElectionOptions struct {
+	Key       string        // prefix under which candidates register
+	Candidate string        // value identifying us to other candidates, such as our hostname
+	TTL       time.Duration // time after which an unresponsive leader is replaced
+
+	// Preferred, if set, returns the candidate that should lead. Other candidates will
+	// delay campaigning by Delay, and will step down if they lead while the preferred
+	// candidate is campaigning.
+	Preferred func(context.Context) (string, error)
+	Delay     time.Duration
+
+	// Retain lists keys written with our lease that should survive us resigning, such as
+	// on handover. We release them from the lease before revoking it, leaving them in
+	// place until our successor rewrites them. Should we instead lose the lease, or stop
+	// campaigning as the parent context is done, they go along with the lease.
+	Retain []string
+}
+
+// Lead campaigns for leadership, calling lead whenever we are elected. The context
+// provided to lead is cancelled when we lose leadership, and the lease is our campaign
+// lease that will expire should we fail to keep it alive. Keys written with this lease
+// are therefore only present while we lead, unless listed in Retain.
+//
+// Candidates register under Key/candidates, and the leader is whoever holds the lock on
+// Key/leader. Once lead returns we resign and campaign again, until the parent context
+// is done. Any error from lead is returned immediately.
+func Lead(ctx context.Context, logger kitlog.Logger, store Store, opt ElectionOptions, lead func(context.Context, LeaseID) error) error {
+	logger = kitlog.With(logger, "key", opt.Key, "candidate", opt.Candidate)
+
+	for {
+		if err := opt.term(ctx, logger, store, lead); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+	}
+}
+
+func (opt ElectionOptions) term(parent context.Context, logger kitlog.Logger, store Store, lead func(context.Context, LeaseID) error) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	lease, err := store.Grant(ctx, opt.TTL)
+	if err != nil {
+		return errors.Wrap(err, "failed to grant election lease")
+	}
+
+	// Closed if we fail to keep the lease alive, after which it may already have expired
+	lost := make(chan struct{})
+	elected := false
+
+	// Revoking the lease removes our candidacy, releases the leader lock and deletes any
+	// keys we wrote, which ensures they are gone before our successor is elected. The
+	// exception is keys we retain, which we release first if we resigned while leading.
+	// Losing the lease or shutting down is not resigning, as no successor may follow.
+	defer func() {
+		revokeCtx, revokeCancel := context.WithTimeout(context.Background(), opt.TTL)
+		defer revokeCancel()
+
+		select {
+		case <-lost:
+		default:
+			if elected && parent.Err() == nil {
+				opt.release(revokeCtx, logger, store, lease)
+			}
+		}
+
+		if err := store.Revoke(revokeCtx, lease); err != nil {
+			logger.Log("event", "election.revoke_error", "error", err)
+		}
+	}()
+
+	alive, err := store.KeepAlive(ctx, lease)
+	if err != nil {
+		return errors.Wrap(err, "failed to keep election lease alive")
+	}
+
+	go func() {
+		select {
+		case <-alive:
+			select {
+			case <-ctx.Done():
+			default:
+				logger.Log("event", "election.lease_lost")
+				close(lost)
+			}
+		case <-ctx.Done():
+		}
+
+		cancel()
+	}()
+
+	if preferred := opt.preferred(ctx, logger); preferred != "" && preferred != opt.Candidate {
+		logger.Log("event", "election.defer", "preferred", preferred, "delay", opt.Delay)
+		select {
+		case <-time.After(opt.Delay):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	logger.Log("event", "election.campaign")
+	if err := store.Put(ctx, opt.Key+"/candidates/"+string(lease), opt.Candidate, lease); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		return errors.Wrap(err, "failed to register candidacy")
+	}
+
+	if err := store.Locker(opt.Key+"/leader", lease).Lock(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		return errors.Wrap(err, "failed to campaign for leadership")
+	}
+
+	logger.Log("event", "election.elected", "lease", string(lease))
+	elected = true
+	if opt.Preferred != nil {
+		go opt.handover(ctx, logger, store, cancel)
+	}
+
+	err = lead(ctx, lease)
+	logger.Log("event", "election.resign", "error", err)
+
+	return err
+}
+
+// release detaches each retained key from our lease, so revoking it won't delete them
+func (opt ElectionOptions) release(ctx context.Context, logger kitlog.Logger, store Store, lease LeaseID) {
+	for _, key := range opt.Retain {
+		if err := store.Release(ctx, key, lease); err != nil {
+			logger.Log("event", "election.release_error", "retained", key, "error", err)
+		}
+	}
+}
+
+// handover cancels our leadership if we are not the preferred candidate and the
+// preferred candidate is campaigning, allowing it to take over.
+func (opt ElectionOptions) handover(ctx context.Context, logger kitlog.Logger, store Store, cancel func()) {
+	for {
+		select {
+		case <-time.After(opt.Delay):
+		case <-ctx.Done():
+			return
+		}
+
+		preferred := opt.preferred(ctx, logger)
+		if preferred == "" || preferred == opt.Candidate {
+			continue
+		}
+
+		candidates, err := Candidates(ctx, store, opt.Key)
+		if err != nil {
+			logger.Log("event", "election.candidates_error", "error", err)
+			continue
+		}
+
+		for _, candidate := range candidates {
+			if candidate == preferred {
+				logger.Log("event", "election.handover", "preferred", preferred)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+func (opt ElectionOptions) preferred(ctx context.Context, logger kitlog.Logger) string {
+	if opt.Preferred == nil {
+		return ""
+	}
+
+	preferred, err := opt.Preferred(ctx)
+	if err != nil {
+		logger.Log("event", "election.preferred_error", "error", err)
+	}
+
+	return preferred
+}
+
+// Candidates returns the values of every candidate campaigning in the election under the
+// given key.
+func Candidates(ctx context.Context, store Store, key string) ([]string, error) {
+	kvs, err := store.List(ctx, key+"/candidates/")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list election candidates")
+	}
+
+	candidates := make([]string, 0, len(kvs))
+	for _, kv := range kvs {
+		candidates = append(candidates, kv.Value)
+	}
+
+	return candidates, nil
+}
@@ -0,0 +1,110 @@
+package store_test
+
+import (
+	"context"
+	"time"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store/memory"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lead", func() {
+	var (
+		ctx    context.Context
+		cancel func()
+		st     *memory.Store
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		st = memory.NewStore()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// campaign runs a candidate that writes the master with its lease whenever it leads,
+	// sending the lease once written. Candidates defer to preferred, if given.
+	campaign := func(ctx context.Context, candidate, preferred string, leading chan<- store.LeaseID) {
+		opt := store.ElectionOptions{Key: "/election", Candidate: candidate, TTL: time.Second, Retain: []string{"/master"}}
+		if preferred != "" {
+			opt.Preferred = func(context.Context) (string, error) { return preferred, nil }
+			opt.Delay = 50 * time.Millisecond
+		}
+
+		go store.Lead(ctx, kitlog.NewNopLogger(), st, opt, func(ctx context.Context, lease store.LeaseID) error {
+			if err := st.SetWithGeneration(ctx, "/master", "/master-generation", "pg01", 1, lease); err != nil {
+				return err
+			}
+
+			leading <- lease
+			<-ctx.Done()
+			return nil
+		})
+	}
+
+	master := func() *store.KeyValue {
+		kv, _, err := st.Get(ctx, "/master", 0)
+		Expect(err).NotTo(HaveOccurred())
+		return kv
+	}
+
+	It("Retains keys while handing over to the next leader", func() {
+		leading := make(chan store.LeaseID, 2)
+		campaign(ctx, "first", "second", leading)
+
+		var first store.LeaseID
+		Eventually(leading).Should(Receive(&first))
+
+		// The first leader hands over once it sees the preferred candidate campaigning
+		watch := st.Watch(ctx, "/master", st.Revision())
+		campaign(ctx, "second", "second", leading)
+
+		var second store.LeaseID
+		Eventually(leading).Should(Receive(&second))
+		Expect(master().Lease).To(Equal(second))
+
+		// We should see the key released from the first lease, then attached to the second,
+		// without it ever being deleted.
+		var changes []string
+		Eventually(func() []string {
+			select {
+			case resp := <-watch:
+				for _, kv := range resp.KeyValues {
+					changes = append(changes, kv.Value)
+				}
+			default:
+			}
+
+			return changes
+		}).Should(Equal([]string{"pg01", "pg01"}))
+	})
+
+	It("Deletes retained keys if the lease is lost", func() {
+		leading := make(chan store.LeaseID, 1)
+		campaign(ctx, "first", "", leading)
+
+		var lease store.LeaseID
+		Eventually(leading).Should(Receive(&lease))
+
+		Expect(st.Expire(lease)).To(Succeed())
+		Expect(master()).To(BeNil())
+	})
+
+	It("Deletes retained keys when we stop campaigning", func() {
+		leading := make(chan store.LeaseID, 1)
+		leaderCtx, stop := context.WithCancel(ctx)
+		defer stop()
+
+		campaign(leaderCtx, "first", "", leading)
+		Eventually(leading).Should(Receive())
+
+		stop()
+		Eventually(master, time.Second).Should(BeNil())
+	})
+})
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+// Generation returns the generation recorded in generationKey as of the given revision,
+// or the latest if that revision has been compacted. Keys written by processes unaware of
+// generations will have no generation key, and are considered generation zero.
+func Generation(ctx context.Context, store Store, generationKey string, revision int64) (int64, error) {
+	kv, _, err := store.Get(ctx, generationKey, revision)
+	if err == ErrCompacted {
+		kv, _, err = store.Get(ctx, generationKey, 0)
+	}
+
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get generation")
+	}
+
+	if kv == nil {
+		return 0, nil
+	}
+
+	return ParseGeneration(kv.Value)
+}
+
+// ParseGeneration parses the value of a generation key
+func ParseGeneration(value string) (int64, error) {
+	generation, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse generation")
+	}
+
+	return generation, nil
+}
+
+// GenerationFilter drops any kv for key whose generation is older than one we have
+// already emitted. Stores refuse writes with an older generation through
+// SetWithGeneration, but this also protects against writes that bypass it, such as
+// operators restoring keys from a backup. Unlike the RevisionFilter, which only guards against
+// out-of-order delivery, this protects against stale data that was written more recently.
+//
+// Empty values, representing missing keys, have no generation and are always emitted,
+// as are kvs for any other key. If we fail to read the generation we also emit the kv,
+// as dropping it would leave us unaware of the change until the key is next modified.
+func GenerationFilter(ctx context.Context, logger kitlog.Logger, store Store, key, generationKey string, timeout time.Duration, in <-chan *mvccpb.KeyValue) <-chan *mvccpb.KeyValue {
+	out := make(chan *mvccpb.KeyValue)
+
+	go func() {
+		var applied int64
+
+		for kv := range in {
+			if string(kv.Key) != key || len(kv.Value) == 0 {
+				out <- kv
+				continue
+			}
+
+			getCtx, cancel := context.WithTimeout(ctx, timeout)
+			generation, err := Generation(getCtx, store, generationKey, kv.ModRevision)
+			cancel()
+
+			if err != nil {
+				logger.Log("event", "generation.error", "key", string(kv.Key), "error", err)
+				out <- kv
+				continue
+			}
+
+			if generation < applied {
+				logger.Log("event", "stale_generation", "key", string(kv.Key), "value", string(kv.Value),
+					"generation", generation, "applied", applied)
+				continue
+			}
+
+			applied = generation
+			out <- kv
+		}
+
+		close(out)
+	}()
+
+	return out
+}
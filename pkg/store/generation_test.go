@@ -0,0 +1,69 @@
+package store_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store/memory"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GenerationFilter", func() {
+	var (
+		ctx    context.Context
+		cancel func()
+		st     *memory.Store
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		st = memory.NewStore()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	// put writes the key after its generation, returning the kv as a stream would see it
+	put := func(key, value, generation string) *mvccpb.KeyValue {
+		Expect(st.Put(ctx, "/master-generation", generation, store.NoLease)).To(Succeed())
+		Expect(st.Put(ctx, key, value, store.NoLease)).To(Succeed())
+
+		return &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value), ModRevision: st.Revision()}
+	}
+
+	filter := func(kvs ...*mvccpb.KeyValue) []string {
+		in := make(chan *mvccpb.KeyValue, len(kvs))
+		for _, kv := range kvs {
+			in <- kv
+		}
+		close(in)
+
+		values := []string{}
+		for kv := range store.GenerationFilter(ctx, kitlog.NewNopLogger(), st, "/master", "/master-generation", time.Second, in) {
+			values = append(values, string(kv.Value))
+		}
+
+		return values
+	}
+
+	It("Drops values with an older generation", func() {
+		Expect(filter(
+			put("/master", "10.0.0.1", "10"),
+			put("/master", "10.0.0.2", "5"),
+			put("/master", "10.0.0.3", "11"),
+		)).To(Equal([]string{"10.0.0.1", "10.0.0.3"}))
+	})
+
+	It("Passes through other keys", func() {
+		Expect(filter(
+			put("/master", "10.0.0.1", "10"),
+			put("/topology", "{}", "5"),
+		)).To(Equal([]string{"10.0.0.1", "{}"}))
+	})
+})
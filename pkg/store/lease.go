@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+// KeepAlive grants a lease with the given TTL, refreshing it until the context is done,
+// at which point the lease is revoked. The returned channel is closed if we fail to keep
+// the lease alive, such as when we lose contact with the store for longer than the TTL,
+// after which any keys attached to the lease will have been deleted.
+func KeepAlive(ctx context.Context, logger kitlog.Logger, store Store, ttl time.Duration) (LeaseID, <-chan struct{}, error) {
+	lease, err := store.Grant(ctx, ttl)
+	if err != nil {
+		return NoLease, nil, errors.Wrap(err, "failed to grant lease")
+	}
+
+	logger = kitlog.With(logger, "lease", string(lease), "ttl", ttl)
+	logger.Log("event", "lease.granted")
+
+	stopped, err := store.KeepAlive(ctx, lease)
+	if err != nil {
+		return NoLease, nil, errors.Wrap(err, "failed to keep lease alive")
+	}
+
+	lost := make(chan struct{})
+	go func() {
+		<-stopped
+
+		select {
+		case <-ctx.Done():
+			revokeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			if err := store.Revoke(revokeCtx, lease); err != nil {
+				logger.Log("event", "lease.revoke_error", "error", err)
+			}
+
+			logger.Log("event", "lease.revoked")
+		default:
+			logger.Log("event", "lease.lost", "msg", "failed to keep lease alive, leased keys will expire")
+			close(lost)
+		}
+	}()
+
+	return lease, lost, nil
+}
+
+// RestoreOnDelete passes through all kvs from the in channel, re-emitting the most recent
+// kv for any key that is deleted from the store. This allows processes that write leased
+// keys to restore them when another writer's lease expires.
+func RestoreOnDelete(ctx context.Context, logger kitlog.Logger, store Store, in <-chan *mvccpb.KeyValue) <-chan *mvccpb.KeyValue {
+	out := make(chan *mvccpb.KeyValue)
+
+	var mu sync.Mutex
+	last := map[string]*mvccpb.KeyValue{}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+
+	// watch restores the key whenever it is deleted, for as long as the context lasts
+	watch := func(key string) {
+		defer wg.Done()
+
+		for {
+			for resp := range store.Watch(ctx, key, 0) {
+				for _, kv := range resp.KeyValues {
+					if kv.Value != "" {
+						continue
+					}
+
+					mu.Lock()
+					restore := last[key]
+					mu.Unlock()
+
+					logger.Log("event", "key.deleted", "key", key, "msg", "restoring deleted key")
+					select {
+					case out <- restore:
+					case <-ctx.Done():
+					}
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchRetryInterval):
+			}
+		}
+	}
+
+	go func() {
+		for kv := range in {
+			mu.Lock()
+			_, watching := last[string(kv.Key)]
+			last[string(kv.Key)] = kv
+			mu.Unlock()
+
+			if !watching {
+				wg.Add(1)
+				go watch(string(kv.Key))
+			}
+
+			out <- kv
+		}
+
+		cancel()
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
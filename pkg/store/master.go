@@ -0,0 +1,84 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MasterVersion is the version of the master record we publish. Consumers accept records
+// of any version, relying on new versions only adding fields.
+const MasterVersion = 1
+
+// Master is the record we publish to the master key, describing the current Postgres
+// primary. Only the host is guaranteed to be present, as records written in the IP format
+// (or by older versions of supervise) carry nothing else.
+type Master struct {
+	Version   int       `json:"version"`
+	Host      string    `json:"host"`
+	Port      int       `json:"port,omitempty"`
+	Node      string    `json:"node,omitempty"`    // pacemaker node name
+	NodeID    string    `json:"node_id,omitempty"` // pacemaker node ID
+	Timeline  int64     `json:"timeline,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MasterFormat determines how we encode the master record into the master key
+type MasterFormat string
+
+const (
+	MasterFormatJSON MasterFormat = "json" // versioned JSON record
+	MasterFormatIP   MasterFormat = "ip"   // bare host, for consumers that predate the record
+)
+
+// Encode serialises the master in the given format
+func (m Master) Encode(format MasterFormat) (string, error) {
+	switch format {
+	case MasterFormatIP:
+		return m.Host, nil
+	case MasterFormatJSON, "":
+		m.Version = MasterVersion
+		value, err := json.Marshal(m)
+		return string(value), err
+	}
+
+	return "", fmt.Errorf("invalid master format: '%s'", format)
+}
+
+// ParseMaster decodes a master key value, accepting both JSON records and bare hosts so
+// consumers work regardless of the format supervise is configured to write.
+func ParseMaster(value string) (*Master, error) {
+	if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+		return &Master{Host: value}, nil
+	}
+
+	var master Master
+	if err := json.Unmarshal([]byte(value), &master); err != nil {
+		return nil, errors.Wrap(err, "failed to parse master record")
+	}
+
+	if master.Host == "" {
+		return nil, fmt.Errorf("master record has no host: %s", value)
+	}
+
+	return &master, nil
+}
+
+// Age returns how long ago the record was published, or zero if it has no timestamp
+func (m Master) Age(now time.Time) time.Duration {
+	if m.UpdatedAt.IsZero() {
+		return 0
+	}
+
+	return now.Sub(m.UpdatedAt)
+}
+
+// Describes reports whether both records describe the same master, ignoring when they
+// were published.
+func (m Master) Describes(other Master) bool {
+	return m.Host == other.Host && m.Port == other.Port && m.Node == other.Node &&
+		m.NodeID == other.NodeID && m.Timeline == other.Timeline
+}
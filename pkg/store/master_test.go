@@ -0,0 +1,88 @@
+package store_test
+
+import (
+	"time"
+
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Master", func() {
+	updatedAt := time.Date(2018, 4, 1, 12, 0, 0, 0, time.UTC)
+	master := store.Master{
+		Host: "172.17.0.2", Port: 5432, Node: "pg01", NodeID: "1", Timeline: 3, UpdatedAt: updatedAt,
+	}
+
+	Describe("Encode", func() {
+		It("Encodes a versioned JSON record", func() {
+			value, err := master.Encode(store.MasterFormatJSON)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(MatchJSON(`{
+				"version": 1,
+				"host": "172.17.0.2",
+				"port": 5432,
+				"node": "pg01",
+				"node_id": "1",
+				"timeline": 3,
+				"updated_at": "2018-04-01T12:00:00Z"
+			}`))
+		})
+
+		It("Encodes only the host in IP format", func() {
+			Expect(master.Encode(store.MasterFormatIP)).To(Equal("172.17.0.2"))
+		})
+
+		It("Rejects unknown formats", func() {
+			_, err := master.Encode("yaml")
+			Expect(err).To(MatchError("invalid master format: 'yaml'"))
+		})
+	})
+
+	Describe("ParseMaster", func() {
+		It("Parses JSON records", func() {
+			value, _ := master.Encode(store.MasterFormatJSON)
+			parsed, err := store.ParseMaster(value)
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Host).To(Equal("172.17.0.2"))
+			Expect(parsed.Node).To(Equal("pg01"))
+			Expect(parsed.Version).To(Equal(store.MasterVersion))
+			Expect(parsed.UpdatedAt.Equal(updatedAt)).To(BeTrue())
+		})
+
+		It("Parses bare hosts", func() {
+			Expect(store.ParseMaster("172.17.0.2")).To(Equal(&store.Master{Host: "172.17.0.2"}))
+		})
+
+		It("Rejects records without a host", func() {
+			_, err := store.ParseMaster(`{"version": 1, "node": "pg01"}`)
+			Expect(err).To(MatchError(ContainSubstring("master record has no host")))
+		})
+	})
+
+	Describe("Describes", func() {
+		It("Ignores when the records were published", func() {
+			republished := master
+			republished.UpdatedAt = updatedAt.Add(time.Hour)
+			Expect(master.Describes(republished)).To(BeTrue())
+		})
+
+		It("Detects a change of timeline", func() {
+			promoted := master
+			promoted.Timeline++
+			Expect(master.Describes(promoted)).To(BeFalse())
+		})
+	})
+
+	Describe("Age", func() {
+		It("Is zero for records without a timestamp", func() {
+			Expect(store.Master{Host: "172.17.0.2"}.Age(time.Now())).To(BeZero())
+		})
+
+		It("Measures time since the update", func() {
+			Expect(master.Age(updatedAt.Add(time.Minute))).To(Equal(time.Minute))
+		})
+	})
+})
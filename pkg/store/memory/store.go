@@ -0,0 +1,577 @@
+// Package memory implements our store in memory, for tests of anything built on the
+// store. It follows etcd semantics: the store starts at revision one, which every write
+// increments, reads
+// and watches can start from past revisions until they are compacted, and keys attached
+// to a lease are deleted when it expires.
+//
+// Leases never expire on their own, keeping tests deterministic. Use Expire to simulate a
+// lease timing out, along with Compact, Disconnect and SetDelay to inject the failures
+// that consumers of a real store must handle.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+	"github.com/pkg/errors"
+)
+
+// ErrDisconnected is returned from every operation while the store is disconnected, and
+// terminates any watch that was open when we disconnected.
+var ErrDisconnected = errors.New("store is disconnected")
+
+type Store struct {
+	sync.Mutex
+	revision  int64
+	compacted int64
+	entries   map[string]*entry
+	base      map[string]store.KeyValue       // state of every key as of the compacted revision
+	history   []event                         // every change after the compacted revision, in order
+	leases    map[store.LeaseID]chan struct{} // closed once the lease expires
+	nextLease int64
+
+	delay        time.Duration
+	disconnected bool
+	changed      chan struct{} // closed and replaced whenever anything changes
+}
+
+var _ store.Store = &Store{}
+
+type entry struct {
+	store.KeyValue
+	created int64 // revision at which the key was created, used to order lock waiters
+}
+
+// event records the state of a key after a change
+type event struct {
+	store.KeyValue
+	deleted bool
+}
+
+func NewStore() *Store {
+	return &Store{
+		revision: 1,
+		entries:  map[string]*entry{},
+		base:     map[string]store.KeyValue{},
+		leases:   map[store.LeaseID]chan struct{}{},
+		changed:  make(chan struct{}),
+	}
+}
+
+// SetDelay delays every operation, and the delivery of every watch response, by the
+// given duration.
+func (s *Store) SetDelay(delay time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.delay = delay
+}
+
+// Disconnect fails every operation with ErrDisconnected until Reconnect is called, and
+// terminates open watches with the same error.
+func (s *Store) Disconnect() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.disconnected = true
+	s.notify()
+}
+
+func (s *Store) Reconnect() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.disconnected = false
+	s.notify()
+}
+
+// Compact discards history before the given revision, or the current revision if zero.
+// As with etcd, reads and watches from before that revision fail with ErrCompacted.
+func (s *Store) Compact(revision int64) {
+	s.Lock()
+	defer s.Unlock()
+
+	if revision == 0 || revision > s.revision {
+		revision = s.revision
+	}
+
+	if revision <= s.compacted {
+		return
+	}
+
+	s.compacted = revision
+	for len(s.history) > 0 && s.history[0].Revision <= revision {
+		apply(s.base, s.history[0])
+		s.history = s.history[1:]
+	}
+
+	s.notify()
+}
+
+// Revision returns the current revision of the store
+func (s *Store) Revision() int64 {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.revision
+}
+
+// Expire simulates the lease timing out, deleting any keys attached to it
+func (s *Store) Expire(lease store.LeaseID) error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.revoke(lease)
+}
+
+func (s *Store) Get(ctx context.Context, key string, revision int64) (*store.KeyValue, int64, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.available(); err != nil {
+		return nil, 0, err
+	}
+
+	if revision == 0 || revision == s.revision {
+		if entry, ok := s.entries[key]; ok {
+			kv := entry.KeyValue
+			return &kv, s.revision, nil
+		}
+
+		return nil, s.revision, nil
+	}
+
+	if revision > s.revision {
+		return nil, 0, fmt.Errorf("revision %d is in the future, current revision is %d", revision, s.revision)
+	}
+
+	if revision < s.compacted {
+		return nil, 0, store.ErrCompacted
+	}
+
+	// Replay history onto the compacted state until we reach the requested revision
+	state := map[string]store.KeyValue{}
+	if kv, ok := s.base[key]; ok {
+		state[key] = kv
+	}
+
+	for _, event := range s.history {
+		if event.Revision > revision {
+			break
+		}
+
+		if event.Key == key {
+			apply(state, event)
+		}
+	}
+
+	if kv, ok := state[key]; ok {
+		return &kv, revision, nil
+	}
+
+	return nil, revision, nil
+}
+
+// apply records the change in state
+func apply(state map[string]store.KeyValue, event event) {
+	if event.deleted {
+		delete(state, event.Key)
+		return
+	}
+
+	state[event.Key] = event.KeyValue
+}
+
+func (s *Store) List(ctx context.Context, prefix string) ([]*store.KeyValue, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.available(); err != nil {
+		return nil, err
+	}
+
+	kvs := []*store.KeyValue{}
+	for key, entry := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			kv := entry.KeyValue
+			kvs = append(kvs, &kv)
+		}
+	}
+
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+
+	return kvs, nil
+}
+
+func (s *Store) Put(ctx context.Context, key, value string, lease store.LeaseID) error {
+	return s.update(ctx, func() error { return s.put(key, value, lease) })
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	return s.update(ctx, func() error { s.delete(key); return nil })
+}
+
+func (s *Store) CompareAndSet(ctx context.Context, key, value string, lease store.LeaseID) error {
+	return s.update(ctx, func() error {
+		if entry, ok := s.entries[key]; ok && entry.Value == value {
+			if lease == store.NoLease || entry.Lease != store.NoLease {
+				return nil
+			}
+		}
+
+		return s.put(key, value, lease)
+	})
+}
+
+// SetWithGeneration writes the key and generation in a single revision. As we hold the
+// lock throughout, we never see concurrent updates.
+func (s *Store) SetWithGeneration(ctx context.Context, key, generationKey, value string, generation int64, lease store.LeaseID) error {
+	return s.update(ctx, func() error {
+		var currentGeneration int64
+		generations, hasGeneration := s.entries[generationKey]
+		if hasGeneration {
+			var err error
+			if currentGeneration, err = store.ParseGeneration(generations.Value); err != nil {
+				return err
+			}
+		}
+
+		if generation < currentGeneration {
+			return store.ErrStaleGeneration
+		}
+
+		if entry, ok := s.entries[key]; ok && entry.Value == value && generation == currentGeneration {
+			if lease == store.NoLease || entry.Lease != store.NoLease {
+				return nil
+			}
+		}
+
+		if err := s.put(key, value, lease); err != nil {
+			return err
+		}
+
+		if !hasGeneration || generation != currentGeneration {
+			s.write(generationKey, strconv.FormatInt(generation, 10), store.NoLease)
+		}
+
+		return nil
+	})
+}
+
+// Watch replays changes to the key from our history, then waits for more. As with etcd,
+// watches from a compacted revision fail immediately with ErrCompacted.
+func (s *Store) Watch(ctx context.Context, key string, revision int64) <-chan store.WatchResponse {
+	out := make(chan store.WatchResponse)
+
+	go func() {
+		defer close(out)
+
+		s.Lock()
+		next := revision + 1
+		if revision == 0 {
+			next = s.revision + 1
+		}
+		s.Unlock()
+
+		for {
+			s.Lock()
+			resp, changed := s.pending(key, next), s.changed
+			s.Unlock()
+
+			if resp.Err == nil && len(resp.KeyValues) == 0 {
+				select {
+				case <-changed:
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if err := s.wait(ctx); err != nil {
+				return
+			}
+
+			select {
+			case out <- resp:
+			case <-ctx.Done():
+				return
+			}
+
+			if resp.Err != nil {
+				return
+			}
+
+			next = resp.Revision + 1
+		}
+	}()
+
+	return out
+}
+
+// pending returns a response containing changes to key from the next revision onward,
+// or an error if the watch can't continue.
+func (s *Store) pending(key string, next int64) store.WatchResponse {
+	if err := s.available(); err != nil {
+		return store.WatchResponse{Err: err}
+	}
+
+	if next < s.compacted {
+		return store.WatchResponse{Revision: s.revision, Err: store.ErrCompacted}
+	}
+
+	resp := store.WatchResponse{Revision: s.revision}
+	for _, event := range s.history {
+		if event.Revision >= next && event.Key == key {
+			kv := event.KeyValue
+			resp.KeyValues = append(resp.KeyValues, &kv)
+		}
+	}
+
+	return resp
+}
+
+func (s *Store) Grant(ctx context.Context, ttl time.Duration) (store.LeaseID, error) {
+	if err := s.wait(ctx); err != nil {
+		return store.NoLease, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.available(); err != nil {
+		return store.NoLease, err
+	}
+
+	s.nextLease++
+	id := store.LeaseID(strconv.FormatInt(s.nextLease, 16))
+	s.leases[id] = make(chan struct{})
+
+	return id, nil
+}
+
+// KeepAlive stops once the context is done or the lease expires. Leases never expire
+// unless revoked or expired with Expire, so we need not refresh anything.
+func (s *Store) KeepAlive(ctx context.Context, id store.LeaseID) (<-chan struct{}, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.available(); err != nil {
+		return nil, err
+	}
+
+	expired, ok := s.leases[id]
+	if !ok {
+		return nil, fmt.Errorf("lease %s not found", id)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		select {
+		case <-ctx.Done():
+		case <-expired:
+		}
+	}()
+
+	return stopped, nil
+}
+
+func (s *Store) Revoke(ctx context.Context, lease store.LeaseID) error {
+	return s.update(ctx, func() error { return s.revoke(lease) })
+}
+
+func (s *Store) Release(ctx context.Context, key string, lease store.LeaseID) error {
+	return s.update(ctx, func() error {
+		if entry, ok := s.entries[key]; ok && entry.Lease == lease {
+			return s.put(key, entry.Value, store.NoLease)
+		}
+
+		return nil
+	})
+}
+
+func (s *Store) Locker(key string, lease store.LeaseID) store.Locker {
+	return &locker{store: s, key: key + "/" + string(lease), prefix: key + "/", lease: lease}
+}
+
+// locker follows the etcd mutex, writing a key beneath the lock prefix and waiting until
+// ours is the oldest. Expiring the lease deletes the key, releasing the lock.
+type locker struct {
+	store  *Store
+	key    string
+	prefix string
+	lease  store.LeaseID
+}
+
+func (l *locker) Lock(ctx context.Context) error {
+	if err := l.store.CompareAndSet(ctx, l.key, "", l.lease); err != nil {
+		return err
+	}
+
+	for {
+		l.store.Lock()
+		held, changed := l.held(), l.store.changed
+		l.store.Unlock()
+
+		if held {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			l.Unlock(context.Background())
+			return ctx.Err()
+		}
+	}
+}
+
+// held reports whether our key is the oldest under the prefix
+func (l *locker) held() bool {
+	ours, ok := l.store.entries[l.key]
+	if !ok {
+		return false
+	}
+
+	for key, entry := range l.store.entries {
+		if strings.HasPrefix(key, l.prefix) && entry.created < ours.created {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (l *locker) Unlock(ctx context.Context) error {
+	return l.store.Delete(ctx, l.key)
+}
+
+// update runs fn holding the lock, after any delay and only while connected
+func (s *Store) update(ctx context.Context, fn func() error) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.available(); err != nil {
+		return err
+	}
+
+	return fn()
+}
+
+func (s *Store) put(key, value string, lease store.LeaseID) error {
+	if lease != store.NoLease {
+		if _, ok := s.leases[lease]; !ok {
+			return fmt.Errorf("lease %s not found", lease)
+		}
+	}
+
+	s.revision++
+	s.write(key, value, lease)
+
+	return nil
+}
+
+// write sets the key at the current revision, allowing several keys to change in a
+// single revision as they would in an etcd transaction.
+func (s *Store) write(key, value string, lease store.LeaseID) {
+	kv := store.KeyValue{Key: key, Value: value, Revision: s.revision, Lease: lease}
+
+	created := s.revision
+	if existing, ok := s.entries[key]; ok {
+		created = existing.created
+	}
+
+	s.entries[key] = &entry{KeyValue: kv, created: created}
+	s.history = append(s.history, event{KeyValue: kv})
+	s.notify()
+}
+
+func (s *Store) delete(key string) {
+	if _, ok := s.entries[key]; !ok {
+		return
+	}
+
+	s.revision++
+	delete(s.entries, key)
+	s.history = append(s.history, event{KeyValue: store.KeyValue{Key: key, Revision: s.revision}, deleted: true})
+	s.notify()
+}
+
+func (s *Store) revoke(id store.LeaseID) error {
+	expired, ok := s.leases[id]
+	if !ok {
+		return fmt.Errorf("lease %s not found", id)
+	}
+
+	keys := []string{}
+	for key, entry := range s.entries {
+		if entry.Lease == id {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		s.delete(key)
+	}
+
+	delete(s.leases, id)
+	close(expired)
+
+	return nil
+}
+
+func (s *Store) available() error {
+	if s.disconnected {
+		return ErrDisconnected
+	}
+
+	return nil
+}
+
+// notify wakes anyone waiting on a change, must be called holding the lock
+func (s *Store) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// wait applies any configured delay
+func (s *Store) wait(ctx context.Context) error {
+	s.Lock()
+	delay := s.delay
+	s.Unlock()
+
+	if delay == 0 {
+		return ctx.Err()
+	}
+
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,205 @@
+package memory_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store/memory"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store/storetest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		ctx    context.Context
+		cancel func()
+		st     *memory.Store
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		st = memory.NewStore()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	put := func(key, value string) {
+		Expect(st.Put(ctx, key, value, store.NoLease)).To(Succeed())
+	}
+
+	getAt := func(key string, revision int64) *store.KeyValue {
+		kv, _, err := st.Get(ctx, key, revision)
+		Expect(err).NotTo(HaveOccurred())
+		return kv
+	}
+
+	Describe("Get", func() {
+		It("Reads keys as of past revisions", func() {
+			put("/master", "pg01")
+			put("/other", "value")
+			put("/master", "pg02")
+			Expect(st.Delete(ctx, "/master")).To(Succeed())
+
+			Expect(getAt("/master", 1)).To(BeNil())
+			Expect(getAt("/master", 2).Value).To(Equal("pg01"))
+			Expect(getAt("/master", 3).Value).To(Equal("pg01"))
+			Expect(getAt("/master", 4).Value).To(Equal("pg02"))
+			Expect(getAt("/master", 5)).To(BeNil())
+		})
+
+		It("Reads keys changed before the compacted revision", func() {
+			put("/master", "pg01")
+			put("/other", "value")
+			st.Compact(0)
+			put("/master", "pg02")
+
+			Expect(getAt("/master", 3).Value).To(Equal("pg01"))
+			Expect(getAt("/master", 3).Revision).To(Equal(int64(2)))
+			Expect(getAt("/master", 4).Value).To(Equal("pg02"))
+
+			_, _, err := st.Get(ctx, "/master", 2)
+			Expect(err).To(Equal(store.ErrCompacted))
+		})
+	})
+
+	Describe("Watch", func() {
+		It("Replays changes after the revision, then streams new ones", func() {
+			put("/master", "pg01")
+			put("/master", "pg02")
+
+			watch := st.Watch(ctx, "/master", 2)
+
+			var resp store.WatchResponse
+			Eventually(watch).Should(Receive(&resp))
+			Expect(resp.KeyValues).To(HaveLen(1))
+			Expect(resp.KeyValues[0].Value).To(Equal("pg02"))
+
+			Expect(st.Delete(ctx, "/master")).To(Succeed())
+			Eventually(watch).Should(Receive(&resp))
+			Expect(resp.KeyValues[0].Value).To(BeEmpty())
+			Expect(resp.KeyValues[0].Revision).To(Equal(int64(4)))
+		})
+
+		It("Fails watches from compacted revisions", func() {
+			put("/master", "pg01")
+			put("/master", "pg02")
+			put("/master", "pg03")
+			st.Compact(0)
+
+			var resp store.WatchResponse
+			Eventually(st.Watch(ctx, "/master", 2)).Should(Receive(&resp))
+			Expect(resp.Err).To(Equal(store.ErrCompacted))
+		})
+
+		It("Terminates watches on disconnect", func() {
+			watch := st.Watch(ctx, "/master", 0)
+			st.Disconnect()
+
+			var resp store.WatchResponse
+			Eventually(watch).Should(Receive(&resp))
+			Expect(resp.Err).To(Equal(memory.ErrDisconnected))
+			Eventually(watch).Should(BeClosed())
+
+			Expect(st.Put(ctx, "/master", "pg01", store.NoLease)).To(Equal(memory.ErrDisconnected))
+			st.Reconnect()
+			put("/master", "pg01")
+		})
+
+		It("Delays responses", func() {
+			st.SetDelay(200 * time.Millisecond)
+			watch := st.Watch(ctx, "/master", 0)
+			put("/master", "pg01")
+
+			Consistently(watch, 100*time.Millisecond).ShouldNot(Receive())
+			Eventually(watch).Should(Receive())
+		})
+	})
+
+	Describe("Leases", func() {
+		It("Deletes keys when the lease expires", func() {
+			lease, err := st.Grant(ctx, 10*time.Second)
+			Expect(err).NotTo(HaveOccurred())
+
+			stopped, err := st.KeepAlive(ctx, lease)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(st.CompareAndSet(ctx, "/master", "pg01", lease)).To(Succeed())
+			Expect(getAt("/master", 0).Lease).To(Equal(lease))
+
+			Expect(st.Expire(lease)).To(Succeed())
+			Expect(getAt("/master", 0)).To(BeNil())
+			Eventually(stopped).Should(BeClosed())
+		})
+
+		It("Rejects unknown leases", func() {
+			Expect(st.Put(ctx, "/master", "pg01", "abc")).To(MatchError("lease abc not found"))
+		})
+	})
+
+	Describe("Locker", func() {
+		It("Grants the lock in order, releasing it once the holder's lease expires", func() {
+			first, _ := st.Grant(ctx, 10*time.Second)
+			second, _ := st.Grant(ctx, 10*time.Second)
+
+			Expect(st.Locker("/lock", first).Lock(ctx)).To(Succeed())
+
+			locked := make(chan error)
+			go func() { locked <- st.Locker("/lock", second).Lock(ctx) }()
+			Consistently(locked, 100*time.Millisecond).ShouldNot(Receive())
+
+			Expect(st.Expire(first)).To(Succeed())
+			Eventually(locked).Should(Receive(BeNil()))
+		})
+	})
+
+	Describe("Release", func() {
+		It("Detaches the key from the lease, so it survives revocation", func() {
+			lease, err := st.Grant(ctx, time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(st.Put(ctx, "/master", "pg01", lease)).To(Succeed())
+
+			Expect(st.Release(ctx, "/master", lease)).To(Succeed())
+			Expect(st.Revoke(ctx, lease)).To(Succeed())
+			Expect(getAt("/master", 0).Value).To(Equal("pg01"))
+			Expect(getAt("/master", 0).Lease).To(Equal(store.NoLease))
+		})
+
+		It("Leaves keys attached to other leases", func() {
+			ours, _ := st.Grant(ctx, time.Second)
+			theirs, _ := st.Grant(ctx, time.Second)
+			Expect(st.Put(ctx, "/master", "pg01", theirs)).To(Succeed())
+
+			Expect(st.Release(ctx, "/master", ours)).To(Succeed())
+			Expect(getAt("/master", 0).Lease).To(Equal(theirs))
+		})
+	})
+
+	Describe("SetWithGeneration", func() {
+		It("Writes the generation alongside the value", func() {
+			Expect(st.SetWithGeneration(ctx, "/master", "/generation", "pg01", 3, store.NoLease)).To(Succeed())
+			Expect(getAt("/generation", 0).Value).To(Equal("3"))
+
+			Expect(st.SetWithGeneration(ctx, "/master", "/generation", "pg01", 3, store.NoLease)).To(Succeed())
+			Expect(st.Revision()).To(Equal(int64(2)))
+
+			Expect(st.SetWithGeneration(ctx, "/master", "/generation", "pg02", 4, store.NoLease)).To(Succeed())
+			Expect(getAt("/generation", 0).Value).To(Equal("4"))
+			Expect(getAt("/generation", 0).Revision).To(Equal(getAt("/master", 0).Revision))
+		})
+
+		It("Refuses writers with an older generation", func() {
+			Expect(st.SetWithGeneration(ctx, "/master", "/generation", "pg02", 4, store.NoLease)).To(Succeed())
+
+			err := st.SetWithGeneration(ctx, "/master", "/generation", "pg01", 3, store.NoLease)
+			Expect(err).To(Equal(store.ErrStaleGeneration))
+			Expect(getAt("/master", 0).Value).To(Equal("pg02"))
+		})
+	})
+
+	storetest.Conformance(func() store.Store { return st })
+})
@@ -0,0 +1,264 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+// SchemaVersion is the version of the key layout written by this release. Any change to
+// the keys we own, or the format of their values, should increment this and add a
+// migration that upgrades stores from the previous version.
+const SchemaVersion = 1
+
+// NewerSchemaError is returned when keys were written by a newer release than ours,
+// whose layout we may not understand.
+type NewerSchemaError int
+
+func (e NewerSchemaError) Error() string {
+	return fmt.Sprintf("schema version %d is newer than our %d (is pgcm out of date?)", int(e), SchemaVersion)
+}
+
+// Keys locates every key we own within the store
+type Keys struct {
+	Master     string
+	Generation string
+	Topology   string
+	Restart    string
+	Election   string // prefix of election candidates and leader lock, if electing
+	Schema     string // holds the SchemaVersion of the layout
+}
+
+// Lock is the prefix of the lock taken by failover and maintenance operations
+func (k Keys) Lock() string {
+	return k.Master + "/lock"
+}
+
+// ephemeral reports whether the key is tied to the lease of a running process, such as
+// an election candidate or lock holder. These are meaningless outside of that process,
+// so we never restore them.
+func (k Keys) ephemeral(key string) bool {
+	for _, prefix := range []string{k.Lock() + "/", k.Election + "/"} {
+		if prefix != "/" && strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (k Keys) prefixes() []string {
+	prefixes := []string{}
+	for _, prefix := range []string{k.Master, k.Generation, k.Topology, k.Restart, k.Election, k.Schema} {
+		if prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	return prefixes
+}
+
+// Dump is a snapshot of every key we own, as produced by DumpKeys
+type Dump struct {
+	Version int        `json:"version"` // schema version of the dumped keys
+	Keys    []DumpedKV `json:"keys"`
+}
+
+type DumpedKV struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Leased bool   `json:"leased,omitempty"`
+}
+
+// DumpKeys reads every key we own, including those beneath our keys such as locks and
+// election candidates.
+func DumpKeys(ctx context.Context, store Store, keys Keys) (*Dump, error) {
+	version, err := ReadSchemaVersion(ctx, store, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	dump := &Dump{Version: version, Keys: []DumpedKV{}}
+	seen := map[string]bool{}
+
+	// Our keys share prefixes, such as the master and master-generation keys, so listing
+	// each will return some keys more than once.
+	for _, prefix := range keys.prefixes() {
+		kvs, err := store.List(ctx, prefix)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list %s", prefix)
+		}
+
+		for _, kv := range kvs {
+			if seen[kv.Key] {
+				continue
+			}
+
+			seen[kv.Key] = true
+			dump.Keys = append(dump.Keys, DumpedKV{Key: kv.Key, Value: kv.Value, Leased: kv.Lease != NoLease})
+		}
+	}
+
+	sort.Slice(dump.Keys, func(i, j int) bool { return dump.Keys[i].Key < dump.Keys[j].Key })
+
+	return dump, nil
+}
+
+// RestoreKeys writes the dumped keys into the store, skipping locks and election keys as
+// they belong to processes that no longer hold them. Keys that were leased are written
+// without a lease, and supervise will attach its own once running.
+//
+// Unless overwrite is set we refuse to restore over any existing key, as the store is
+// likely in use. Restored stores should be migrated if the dump came from an older
+// schema.
+func RestoreKeys(ctx context.Context, logger kitlog.Logger, store Store, keys Keys, dump *Dump, overwrite bool) error {
+	if dump.Version > SchemaVersion {
+		return NewerSchemaError(dump.Version)
+	}
+
+	restore := []DumpedKV{}
+	for _, kv := range dump.Keys {
+		if keys.ephemeral(kv.Key) {
+			logger.Log("event", "restore.skip", "key", kv.Key, "msg", "skipping lock or election key")
+			continue
+		}
+
+		restore = append(restore, kv)
+	}
+
+	if !overwrite {
+		for _, kv := range restore {
+			existing, _, err := store.Get(ctx, kv.Key, 0)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get %s", kv.Key)
+			}
+
+			if existing != nil {
+				return fmt.Errorf("refusing to overwrite existing key %s", kv.Key)
+			}
+		}
+	}
+
+	for _, kv := range restore {
+		logger.Log("event", "restore.put", "key", kv.Key)
+		if err := store.Put(ctx, kv.Key, kv.Value, NoLease); err != nil {
+			return errors.Wrapf(err, "failed to restore %s", kv.Key)
+		}
+	}
+
+	if keys.Schema != "" {
+		return store.Put(ctx, keys.Schema, strconv.Itoa(dump.Version), NoLease)
+	}
+
+	return nil
+}
+
+// ReadSchemaVersion returns the schema version of the store. Stores without a version key
+// were either written before we versioned our keys, which we call version zero, or are
+// empty, in which case there is nothing to migrate and we report the current version.
+func ReadSchemaVersion(ctx context.Context, store Store, keys Keys) (int, error) {
+	if keys.Schema == "" {
+		return SchemaVersion, nil
+	}
+
+	kv, _, err := store.Get(ctx, keys.Schema, 0)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get schema version")
+	}
+
+	if kv != nil {
+		version, err := strconv.Atoi(kv.Value)
+		return version, errors.Wrap(err, "failed to parse schema version")
+	}
+
+	master, _, err := store.Get(ctx, keys.Master, 0)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get master")
+	}
+
+	if master != nil {
+		return 0, nil
+	}
+
+	return SchemaVersion, nil
+}
+
+// CheckSchemaVersion ensures we understand the key layout of the store, recording our
+// version if the store has none. Stores at an older version continue to work, as we
+// remain compatible with the previous layout, but should be migrated.
+func CheckSchemaVersion(ctx context.Context, logger kitlog.Logger, store Store, keys Keys) error {
+	version, err := ReadSchemaVersion(ctx, store, keys)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case version > SchemaVersion:
+		return NewerSchemaError(version)
+	case version < SchemaVersion:
+		logger.Log("event", "schema.outdated", "version", version, "current", SchemaVersion,
+			"msg", "store uses an old key layout, run pgcm etcd migrate")
+		return nil
+	}
+
+	return store.CompareAndSet(ctx, keys.Schema, strconv.Itoa(version), NoLease)
+}
+
+// Migration upgrades the store from the previous schema version to Version
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     func(context.Context, kitlog.Logger, Store, Keys) error
+}
+
+// Migrations lists every migration, ordered by version. Version one is the layout at
+// which we introduced versioning, and existing stores already match it.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Record the schema version of stores created before versioning",
+		Migrate:     func(context.Context, kitlog.Logger, Store, Keys) error { return nil },
+	},
+}
+
+// Migrate applies each migration newer than the store's schema version, recording the
+// version after each succeeds so an interrupted migration can be resumed.
+func Migrate(ctx context.Context, logger kitlog.Logger, store Store, keys Keys) error {
+	if keys.Schema == "" {
+		return errors.New("no schema version key configured")
+	}
+
+	version, err := ReadSchemaVersion(ctx, store, keys)
+	if err != nil {
+		return err
+	}
+
+	if version > SchemaVersion {
+		return NewerSchemaError(version)
+	}
+
+	for _, migration := range Migrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		logger.Log("event", "migration.start", "version", migration.Version, "description", migration.Description)
+		if err := migration.Migrate(ctx, logger, store, keys); err != nil {
+			return errors.Wrapf(err, "failed to migrate to version %d", migration.Version)
+		}
+
+		if err := store.Put(ctx, keys.Schema, strconv.Itoa(migration.Version), NoLease); err != nil {
+			return errors.Wrap(err, "failed to record schema version")
+		}
+
+		version = migration.Version
+	}
+
+	logger.Log("event", "migration.complete", "version", version)
+	return nil
+}
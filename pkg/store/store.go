@@ -0,0 +1,89 @@
+// Package store defines the key-value store in which we publish cluster state, along
+// with the streams, filters and election built on top of it. Implementations exist for
+// etcd and Consul.
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LeaseID identifies a lease, to which keys can be attached so they are removed once the
+// lease expires. In etcd this is a lease, in Consul a session.
+type LeaseID string
+
+// NoLease is used to write keys that should never expire
+const NoLease LeaseID = ""
+
+// ErrCompacted is returned when reading or watching from a revision the store no longer
+// retains. Callers should re-read the current value.
+var ErrCompacted = errors.New("revision has been compacted")
+
+// ErrConcurrentUpdate is returned when another writer modifies a key between us reading
+// and writing it. Callers should retry.
+var ErrConcurrentUpdate = errors.New("key was modified concurrently")
+
+// ErrStaleGeneration is returned when writing with a generation older than the one in the
+// store, such as by a writer whose view of the cluster predates the latest promotion.
+var ErrStaleGeneration = errors.New("generation is older than the current generation")
+
+type KeyValue struct {
+	Key      string
+	Value    string
+	Revision int64   // revision at which the key was last modified
+	Lease    LeaseID // lease the key is attached to, if any
+}
+
+// WatchResponse contains changes to a watched key. Deletions are reported as a
+// KeyValue with an empty value. Once a response contains an error, the watch is over.
+type WatchResponse struct {
+	KeyValues []*KeyValue
+	Revision  int64 // store revision as of this response
+	Err       error
+}
+
+// Store is the interface we require from a key-value store. Keys are always absolute,
+// beginning with a /, and implementations apply any namespace.
+type Store interface {
+	// Get returns the key as of the given revision, or the latest if revision is zero.
+	// Missing keys are returned as nil, along with the store revision at which we read.
+	Get(ctx context.Context, key string, revision int64) (*KeyValue, int64, error)
+	// List returns every key beneath the given prefix
+	List(ctx context.Context, prefix string) ([]*KeyValue, error)
+	// Put unconditionally sets the key, attaching it to the lease if given
+	Put(ctx context.Context, key, value string, lease LeaseID) error
+	Delete(ctx context.Context, key string) error
+	// CompareAndSet sets the key if its value differs from what is current. If a lease is
+	// given, we also write if the key has no lease, so keys created without one become
+	// leased.
+	CompareAndSet(ctx context.Context, key, value string, lease LeaseID) error
+	// SetWithGeneration behaves like CompareAndSet, but also records the writer's
+	// generation in generationKey in the same transaction. Generations identify the
+	// promotion the writer observed, such as the Postgres timeline, so writes with a
+	// generation older than the current one fail with ErrStaleGeneration. The generation
+	// key is never leased.
+	SetWithGeneration(ctx context.Context, key, generationKey, value string, generation int64, lease LeaseID) error
+	// Watch streams changes to the key made after the given revision, or from now if
+	// revision is zero. The channel is closed once the context is done, or after
+	// delivering an error.
+	Watch(ctx context.Context, key string, revision int64) <-chan WatchResponse
+	// Grant creates a lease that expires unless kept alive within the TTL
+	Grant(ctx context.Context, ttl time.Duration) (LeaseID, error)
+	// KeepAlive refreshes the lease until the context is done, returning a channel that is
+	// closed once we stop, either because of the context or having failed to refresh.
+	KeepAlive(ctx context.Context, lease LeaseID) (<-chan struct{}, error)
+	// Revoke expires the lease immediately, deleting any attached keys
+	Revoke(ctx context.Context, lease LeaseID) error
+	// Release detaches the key from the lease, if still attached to it, so the key survives
+	// the lease being revoked.
+	Release(ctx context.Context, key string, lease LeaseID) error
+	// Locker returns a mutex on the given key, held for the lifetime of the lease
+	Locker(key string, lease LeaseID) Locker
+}
+
+type Locker interface {
+	Lock(context.Context) error
+	Unlock(context.Context) error
+}
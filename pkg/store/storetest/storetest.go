@@ -0,0 +1,89 @@
+// Package storetest provides specs that every store.Store implementation should pass,
+// ensuring the backends agree on semantics the rest of the manager relies upon.
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// Conformance defines specs against the store returned by newStore, which is called once
+// per spec. Call it from within a Describe so the specs run after any setup.
+func Conformance(newStore func() store.Store) {
+	Describe("Conformance", func() {
+		var (
+			ctx    context.Context
+			cancel func()
+			st     store.Store
+			key    string
+			held   store.LeaseID
+			other  store.LeaseID
+		)
+
+		grant := func() store.LeaseID {
+			lease, err := st.Grant(ctx, 10*time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			return lease
+		}
+
+		get := func(key string) *store.KeyValue {
+			kv, _, err := st.Get(ctx, key, 0)
+			Expect(err).NotTo(HaveOccurred())
+			return kv
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+			st = newStore()
+			key = fmt.Sprintf("/storetest/%d", time.Now().UnixNano())
+
+			held, other = grant(), grant()
+			Expect(st.Put(ctx, key, "pg01", held)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		Context("When the key is held by another lease", func() {
+			It("Put replaces the lease", func() {
+				Expect(st.Put(ctx, key, "pg02", other)).To(Succeed())
+				Expect(get(key).Value).To(Equal("pg02"))
+				Expect(get(key).Lease).To(Equal(other))
+			})
+
+			It("Put without a lease detaches it", func() {
+				Expect(st.Put(ctx, key, "pg02", store.NoLease)).To(Succeed())
+				Expect(get(key).Value).To(Equal("pg02"))
+				Expect(get(key).Lease).To(Equal(store.NoLease))
+			})
+
+			It("CompareAndSet replaces the lease", func() {
+				Expect(st.CompareAndSet(ctx, key, "pg02", other)).To(Succeed())
+				Expect(get(key).Value).To(Equal("pg02"))
+				Expect(get(key).Lease).To(Equal(other))
+			})
+
+			It("SetWithGeneration replaces the lease", func() {
+				generationKey := key + "/generation"
+
+				Expect(st.SetWithGeneration(ctx, key, generationKey, "pg02", 1, other)).To(Succeed())
+				Expect(get(key).Value).To(Equal("pg02"))
+				Expect(get(key).Lease).To(Equal(other))
+				Expect(get(generationKey).Value).To(Equal("1"))
+			})
+
+			It("Revoking the old lease leaves the key once replaced", func() {
+				Expect(st.Put(ctx, key, "pg02", other)).To(Succeed())
+				Expect(st.Revoke(ctx, held)).To(Succeed())
+				Expect(get(key).Value).To(Equal("pg02"))
+			})
+		})
+	})
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	kitlog "github.com/go-kit/kit/log"
+)
+
+// StreamOptions should be passed to NewStream to construct a new streaming channel
+type StreamOptions struct {
+	Ctx          context.Context
+	Keys         []string
+	PollInterval time.Duration
+	GetTimeout   time.Duration
+	Errors       chan<- error // if set, receives watch and poll errors, dropped unless ready
+}
+
+// watchRetryInterval is how long we wait before restarting a watch that has failed
+var watchRetryInterval = time.Second
+
+// NewStream accepts a store with which we watch for changes to our selected keys and
+// push them down the output channel. The advantages to using this interface over what
+// the store already provides is the polling interval, which ensures on boot that we
+// receive the initial value, along with at polling intervals.
+func NewStream(logger kitlog.Logger, store Store, opt StreamOptions) (<-chan *mvccpb.KeyValue, <-chan struct{}) {
+	logger = kitlog.With(logger, "keys", strings.Join(opt.Keys, ","))
+	out, done := make(chan *mvccpb.KeyValue), make(chan struct{})
+
+	ctx, cancel := context.WithCancel(opt.Ctx)
+	var wg sync.WaitGroup
+	wg.Add(len(opt.Keys) + 1)
+
+	// Watch each key individually, pushing each change into the out stream
+	for _, key := range opt.Keys {
+		go func(key string) {
+			defer cancel()
+			defer wg.Done()
+
+			opt.watch(ctx, kitlog.With(logger, "key", key), store, key, out)
+		}(key)
+	}
+
+	// The watch only reports errors that terminate it, such as compaction or loss of the
+	// etcd leader. By manually polling for changes on a regular interval we ensure we'll
+	// eventually see our values even if the watch has silently stalled.
+	go func() {
+		defer cancel()
+		defer wg.Done()
+
+	Poll:
+		logger.Log("event", "poll.start")
+		for _, key := range opt.Keys {
+			kv, _, err := opt.get(ctx, store, key)
+			if err != nil {
+				logger.Log("event", "poll.error", "key", key, "error", err)
+				opt.report(err)
+				continue
+			}
+
+			// Missing keys are emitted with an empty value, just as the watch will emit
+			// deletions, so consumers can act on the key having expired.
+			if len(kv.Value) == 0 {
+				logger.Log("event", "poll.missing_value", "key", key,
+					"msg", "key has no value (is supervise running?)")
+			}
+
+			out <- kv
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Log("event", "poll.stop", "msg", "context expired, stopping stream")
+		case <-time.After(opt.PollInterval):
+			goto Poll
+		}
+	}()
+
+	// Notify the done channel once the wait group completes
+	go func() {
+		wg.Wait()
+
+		close(out)
+		close(done)
+	}()
+
+	return out, done
+}
+
+// watch streams changes to a single key until the context is done. Should the watch
+// fail, we resume from the revision after the last we saw, so we never miss a change
+// that happened while disconnected. If that revision has been compacted we can no
+// longer replay changes, and instead re-read the current value.
+//
+// We read the key before our first watch, as otherwise a watch that fails before seeing
+// any change would leave us no revision to resume from.
+func (opt StreamOptions) watch(ctx context.Context, logger kitlog.Logger, store Store, key string, out chan<- *mvccpb.KeyValue) {
+	var revision int64 // last revision we've seen
+
+	for {
+		kv, current, err := opt.get(ctx, store, key)
+		if err == nil {
+			out <- kv
+			revision = current
+			break
+		}
+
+		logger.Log("event", "watch.seed_error", "error", err)
+		opt.report(err)
+
+		select {
+		case <-ctx.Done():
+			logger.Log("event", "watch.stop", "msg", "context expired, stopping watch")
+			return
+		case <-time.After(watchRetryInterval):
+		}
+	}
+
+	for {
+		logger.Log("event", "watch.start", "revision", revision)
+
+		watchCtx, cancel := context.WithCancel(ctx)
+		for resp := range store.Watch(watchCtx, key, revision) {
+			if resp.Err != nil {
+				logger.Log("event", "watch.error", "error", resp.Err)
+				opt.report(resp.Err)
+
+				if resp.Err == ErrCompacted {
+					kv, current, err := opt.get(ctx, store, key)
+					if err != nil {
+						logger.Log("event", "watch.resync_error", "error", err)
+						opt.report(err)
+						break
+					}
+
+					logger.Log("event", "watch.resync", "revision", current)
+					out <- kv
+					revision = current
+				}
+
+				break
+			}
+
+			for _, kv := range resp.KeyValues {
+				out <- toMvcc(kv)
+			}
+
+			if resp.Revision > revision {
+				revision = resp.Revision
+			}
+		}
+
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			logger.Log("event", "watch.stop", "msg", "context expired, stopping watch")
+			return
+		case <-time.After(watchRetryInterval):
+			logger.Log("event", "watch.resume", "revision", revision)
+		}
+	}
+}
+
+// get reads the current value of key, along with the revision at which we read it.
+// Missing keys are returned with an empty value, modified at that revision.
+func (opt StreamOptions) get(ctx context.Context, store Store, key string) (*mvccpb.KeyValue, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, opt.GetTimeout)
+	defer cancel()
+
+	kv, revision, err := store.Get(ctx, key, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if kv == nil {
+		return &mvccpb.KeyValue{Key: []byte(key), ModRevision: revision}, revision, nil
+	}
+
+	return toMvcc(kv), revision, nil
+}
+
+// report passes err to the caller, if they asked for errors and are ready to receive
+func (opt StreamOptions) report(err error) {
+	if opt.Errors == nil {
+		return
+	}
+
+	select {
+	case opt.Errors <- err:
+	default:
+	}
+}
+
+// toMvcc converts our KeyValue into the type used by our streams, which predate the
+// store and were written against etcd.
+func toMvcc(kv *KeyValue) *mvccpb.KeyValue {
+	return &mvccpb.KeyValue{Key: []byte(kv.Key), Value: []byte(kv.Value), ModRevision: kv.Revision}
+}
@@ -0,0 +1,114 @@
+package store_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store"
+	"github.com/gocardless/pgsql-cluster-manager/pkg/store/memory"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	"github.com/onsi/gomega/types"
+)
+
+var _ = Describe("NewStream", func() {
+	var (
+		ctx    context.Context
+		cancel func()
+		st     *memory.Store
+		kvs    <-chan *mvccpb.KeyValue
+	)
+
+	stream := func() <-chan *mvccpb.KeyValue {
+		kvs, _ := store.NewStream(kitlog.NewNopLogger(), st, store.StreamOptions{
+			Ctx:          ctx,
+			Keys:         []string{"/master"},
+			PollInterval: time.Minute,
+			GetTimeout:   time.Second,
+		})
+
+		return kvs
+	}
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		st = memory.NewStore()
+		kvs = stream()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	put := func(value string) {
+		Expect(st.Put(ctx, "/master", value, store.NoLease)).To(Succeed())
+	}
+
+	matchValue := func(value string) types.GomegaMatcher {
+		return PointTo(MatchFields(IgnoreExtras, Fields{"Value": Equal([]byte(value))}))
+	}
+
+	It("Emits the initial value and subsequent changes", func() {
+		Eventually(kvs).Should(Receive(matchValue("")))
+
+		put("pg01")
+		Eventually(kvs).Should(Receive(matchValue("pg01")))
+	})
+
+	It("Replays changes made while disconnected", func() {
+		Eventually(kvs).Should(Receive(matchValue("")))
+		put("pg01")
+		Eventually(kvs).Should(Receive(matchValue("pg01")))
+
+		st.Disconnect()
+		time.Sleep(100 * time.Millisecond)
+		st.Reconnect()
+
+		// Made before the watch resumes, which should replay both changes
+		put("pg02")
+		put("pg03")
+
+		Eventually(kvs, 3*time.Second).Should(Receive(matchValue("pg02")))
+		Eventually(kvs).Should(Receive(matchValue("pg03")))
+	})
+
+	It("Replays changes made after we started, should the first watch fail", func() {
+		Eventually(kvs).Should(Receive(matchValue("")))
+		put("pg01")
+		Eventually(kvs).Should(Receive(matchValue("pg01")))
+
+		// This stream has yet to see any change through its watch
+		kvs = stream()
+		Eventually(kvs).Should(Receive(matchValue("pg01")))
+
+		st.Disconnect()
+		time.Sleep(100 * time.Millisecond)
+		st.Reconnect()
+
+		put("pg02")
+		put("pg03")
+
+		Eventually(kvs, 3*time.Second).Should(Receive(matchValue("pg02")))
+		Eventually(kvs).Should(Receive(matchValue("pg03")))
+	})
+
+	It("Re-reads the current value once changes have been compacted", func() {
+		Eventually(kvs).Should(Receive(matchValue("")))
+		put("pg01")
+		Eventually(kvs).Should(Receive(matchValue("pg01")))
+
+		st.Disconnect()
+		time.Sleep(100 * time.Millisecond)
+		st.Reconnect()
+
+		put("pg02")
+		put("pg03")
+		st.Compact(0)
+
+		Eventually(kvs, 3*time.Second).Should(Receive(matchValue("pg03")))
+	})
+})